@@ -1,32 +1,60 @@
 package cmd
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"net"
 	"os"
+	"os/signal"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner"
 	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/portdiscovery"
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/scanner"
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
 	"github.com/spf13/cobra"
 )
 
-var config portdiscovery.ScanConfig
-var jsonFileName string
-
 var (
 	// Input flags
 	ipFlag       string
 	ipListFlag   []string
 	ipRangeFlag  string
 	hostnameFlag []string
-	portFlag     []int
-	tcpFlag      bool
-	udpFlag      bool
-	serviceFlag  []string
-	jsonflag     bool
+	// File with one or more targets per line
+	targetsFileFlag    string
+	excludeFlag        []string
+	portFlag           []int
+	portsFlag          string
+	topPortsFlag       int
+	commonFlag         bool
+	tcpFlag            bool
+	udpFlag            bool
+	serviceFlag        []string
+	excludeServiceFlag []string
+	jsonflag           bool
+	// Port scan limits
+	workersFlag     int
+	hostWorkersFlag int
+	rateFlag        int
+	// Timeouts and retries
+	connectTimeoutFlag time.Duration
+	readTimeoutFlag    time.Duration
+	probeTimeoutFlag   time.Duration
+	targetTimeoutFlag  time.Duration
+	retriesFlag        int
+	adaptiveTimingFlag bool
+	// TLS verification
+	caBundleFlag      string
+	clientCertFlag    string
+	clientKeyFlag     string
+	tlsEnumerateFlag  bool
+	startTlsLoginFlag bool
+	// HTTP paths fetched besides the root page
+	httpPathFlag []string
 	// Output file flag
 	outputFileFlag string
 
@@ -42,14 +70,36 @@ var (
 func init() {
 	// Define input flags
 	ScanCmd.Flags().StringVar(&ipFlag, "ip", "", "IP address to scan")
-	ScanCmd.Flags().StringSliceVar(&ipListFlag, "iplist", []string{}, "List of IP addresses to scan")
+	ScanCmd.Flags().StringSliceVar(&ipListFlag, "iplist", []string{}, "List of IP addresses or CIDRs to scan (e.g. 10.0.0.1,10.0.1.0/24)")
 	ScanCmd.Flags().StringVar(&ipRangeFlag, "iprange", "", "IP range to scan (e.g. 192.168.1.1-192.168.1.10)")
 	ScanCmd.Flags().StringSliceVar(&hostnameFlag, "hostname", []string{}, "Hostname to scan")
+	ScanCmd.Flags().StringVar(&targetsFileFlag, "targets-file", "", "File with targets to scan, one or more per line ('-' for stdin)")
+	ScanCmd.Flags().StringSliceVar(&excludeFlag, "exclude", []string{}, "IP addresses, CIDRs, ranges or hostnames to leave out (e.g. 10.0.0.1,10.0.0.128/25)")
 	ScanCmd.Flags().IntSliceVar(&portFlag, "port", []int{}, "Port number(s) to scan")
+	ScanCmd.Flags().StringVar(&portsFlag, "ports", "", "Ports and port ranges to scan (e.g. 1-1024,6443,8000-9000)")
+	ScanCmd.Flags().IntVar(&topPortsFlag, "top-ports", 0, "Scan the N ports most frequently found open")
+	ScanCmd.Flags().BoolVar(&commonFlag, "common", false, "Scan the usual ports of the services the scanner can discover")
 	ScanCmd.Flags().BoolVar(&tcpFlag, "tcp", false, "Scan only TCP ports")
 	ScanCmd.Flags().BoolVar(&udpFlag, "udp", false, "Scan only UDP ports")
-	ScanCmd.Flags().StringSliceVar(&serviceFlag, "service", []string{}, "Service type(s) to scan (e.g. http, ssh)")
+	ScanCmd.Flags().StringSliceVar(&serviceFlag, "service", []string{}, "Service type(s) to probe for (e.g. redis,mongodb)")
+	ScanCmd.Flags().StringSliceVar(&excludeServiceFlag, "exclude-service", []string{}, "Service type(s) never to probe for (e.g. cassandra)")
 	ScanCmd.Flags().BoolVar(&jsonflag, "json", false, "Output results in JSON format")
+	ScanCmd.Flags().IntVar(&workersFlag, "workers", portdiscovery.DefaultWorkers, "Maximal number of ports probed or service discovery probes run at the same time over all targets")
+	ScanCmd.Flags().IntVar(&hostWorkersFlag, "host-workers", portdiscovery.DefaultHostWorkers, "Maximal number of ports probed or service discovery probes run at the same time on a single target")
+	ScanCmd.Flags().IntVar(&rateFlag, "rate", 0, "Maximal number of probes sent per second (0 for unlimited)")
+	defaultTiming := servicediscovery.DefaultTiming()
+	ScanCmd.Flags().DurationVar(&connectTimeoutFlag, "connect-timeout", defaultTiming.ConnectTimeout, "Time to wait for a port to answer or a connection, TLS handshake included, to be established")
+	ScanCmd.Flags().DurationVar(&readTimeoutFlag, "read-timeout", defaultTiming.ReadTimeout, "Time to wait for data on an established connection")
+	ScanCmd.Flags().DurationVar(&probeTimeoutFlag, "probe-timeout", defaultTiming.ProbeTimeout, "Maximal duration of a single service discovery probe")
+	ScanCmd.Flags().DurationVar(&targetTimeoutFlag, "target-timeout", 0, "Maximal time spent on a single target in each scan phase (0 for unlimited)")
+	ScanCmd.Flags().IntVar(&retriesFlag, "retries", 0, "Number of retries of a probe or connection that timed out")
+	ScanCmd.Flags().BoolVar(&adaptiveTimingFlag, "adaptive-timing", false, "Adapt timeouts to the round trip time measured for each target")
+	ScanCmd.Flags().StringVar(&caBundleFlag, "ca-bundle", "", "PEM file of the CAs TLS certificates are verified against, besides the cluster CA and the system roots")
+	ScanCmd.Flags().StringVar(&clientCertFlag, "client-cert", "", "PEM client certificate presented to TLS servers that ask for one")
+	ScanCmd.Flags().StringVar(&clientKeyFlag, "client-key", "", "PEM private key of the client certificate")
+	ScanCmd.Flags().BoolVar(&tlsEnumerateFlag, "tls-enumerate", false, "Try every TLS version and cipher suite on TLS ports and grade them, one handshake each")
+	ScanCmd.Flags().BoolVar(&startTlsLoginFlag, "starttls-login", false, "Attempt a plaintext login to tell whether PostgreSQL and MySQL servers require STARTTLS")
+	ScanCmd.Flags().StringSliceVar(&httpPathFlag, "http-path", []string{}, "Path(s) requested from HTTP servers besides / and /favicon.ico (e.g. /metrics,/version)")
 	// Output file flag
 	ScanCmd.Flags().StringVar(&outputFileFlag, "output", "", "Output file to write results to")
 
@@ -58,8 +108,12 @@ func init() {
 }
 
 func scan(cmd *cobra.Command, args []string) error {
-	discoveryResults := []map[string]interface{}{}
-	config, err := parseArgs(args)
+	target, err := parseArgs(args)
+	if err != nil {
+		return err
+	}
+
+	services, err := scanner.NewServiceFilter(serviceFlag, excludeServiceFlag)
 	if err != nil {
 		return err
 	}
@@ -68,78 +122,148 @@ func scan(cmd *cobra.Command, args []string) error {
 		fmt.Printf("Output file: %s\n", outputFileFlag)
 	}
 
-	// Scan targets
-	scanResults := portdiscovery.ScanTargets(config.Targets, config.TcpOnly, config.UdpOnly, config.Ports, config.Timeout)
-
-	// Print scan results
+	networkScanner := scanner.NewScanner()
+	networkScanner.Timing = servicediscovery.Timing{
+		ConnectTimeout: connectTimeoutFlag,
+		ReadTimeout:    readTimeoutFlag,
+		ProbeTimeout:   probeTimeoutFlag,
+		TargetTimeout:  targetTimeoutFlag,
+		Retries:        retriesFlag,
+		Adaptive:       adaptiveTimingFlag,
+	}
+	networkScanner.Services = services
+	if caBundleFlag != "" {
+		networkScanner.TLS.CABundle, err = servicediscovery.LoadCertPool(caBundleFlag)
+		if err != nil {
+			return err
+		}
+	}
+	if clientCertFlag != "" || clientKeyFlag != "" {
+		if clientCertFlag == "" || clientKeyFlag == "" {
+			return fmt.Errorf("Client certificate and key must be given together")
+		}
+		networkScanner.TLS.ClientCertificate, err = servicediscovery.LoadClientCertificate(clientCertFlag, clientKeyFlag)
+		if err != nil {
+			return err
+		}
+	}
+	networkScanner.TLS.Enumerate = tlsEnumerateFlag
+	networkScanner.TLS.StartTlsLogin = startTlsLoginFlag
+	for _, path := range httpPathFlag {
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("HTTP path %q must start with /", path)
+		}
+	}
+	networkScanner.HTTP.Paths = httpPathFlag
+	networkScanner.Workers = workersFlag
+	networkScanner.HostWorkers = hostWorkersFlag
+	networkScanner.Rate = rateFlag
 	if !jsonflag {
-		portdiscovery.PrintResults(scanResults)
+		networkScanner.PortsDiscovered = portdiscovery.PrintResults
 	}
 
-	// Iterate through each scan result and perform service discovery
-	for _, target := range scanResults {
-		// Perform service discovery for open TCP ports
-		for _, port := range target.TCPPorts {
-			discoveryResult, err := ScanTargets(context.Background(), target.Host, port)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error while discovering services on %s:%d: %s\n", target.Host, port, err)
-				continue
-			}
+	// Interrupting the scan stops it and keeps the results found so far
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+	defer stop()
 
-			// Print discovered services
-			fmt.Fprintf(os.Stderr, "Services discovered on %s:%d:\n", target.Host, port)
-			fmt.Fprintf(os.Stderr, "Session Layer: %s\n", discoveryResult.SessionLayer)
-			fmt.Fprintf(os.Stderr, "Presentation Layer: %s\n", discoveryResult.PresentationLayer)
-			fmt.Fprintf(os.Stderr, "Application Layer: %s\n", discoveryResult.ApplicationLayer)
-			fmt.Fprintf(os.Stderr, "Authenticated: %v\n", discoveryResult.IsAuthenticated)
-			fmt.Fprintf(os.Stderr, "Properties: %s\n", discoveryResult.Properties)
-
-			// Store discovery results in a map
-			resultMap := map[string]interface{}{
-				"host":              target.Host,
-				"port":              port,
-				"type":              "tcp",
-				"sessionlayer":      discoveryResult.SessionLayer,
-				"presentationlayer": discoveryResult.PresentationLayer,
-				"applicationlayer":  discoveryResult.ApplicationLayer,
-				"service":           discoveryResult.ApplicationLayer,
-				"authenticated":     discoveryResult.IsAuthenticated,
-				"properties":        discoveryResult.Properties,
-			}
+	// Scan targets and discover the services of their open ports
+	var scanErrors []error
+	serviceResults, err := networkScanner.ScanContext(ctx, target)
+	if err != nil && serviceResults == nil && ctx.Err() == nil {
+		// The targets or ports could not be expanded, nothing was scanned
+		return err
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error while scanning: %s\n", err)
+		scanErrors = append(scanErrors, splitErrors(err)...)
+	}
+
+	for _, result := range serviceResults {
+		port, _ := resultPort(result)
 
-			// Append results to discoveryResults slice
-			discoveryResults = append(discoveryResults, resultMap)
+		// Print discovered services
+		fmt.Fprintf(os.Stderr, "Services discovered on %s:\n", net.JoinHostPort(result.Host, strconv.Itoa(port)))
+		fmt.Fprintf(os.Stderr, "Status: %s\n", strings.ToLower(result.Status))
+		fmt.Fprintf(os.Stderr, "Session Layer: %s\n", result.SessionLayer)
+		fmt.Fprintf(os.Stderr, "Presentation Layer: %s\n", result.PresentationLayer)
+		fmt.Fprintf(os.Stderr, "Application Layer: %s\n", result.ApplicationLayer)
+		fmt.Fprintf(os.Stderr, "Authentication: %s\n", authenticationText(result))
+		fmt.Fprintf(os.Stderr, "Properties: %s\n", result.Properties)
+		if result.SSH != nil {
+			fmt.Fprintf(os.Stderr, "SSH: %s %s, auth methods: %s\n", result.SSH.Software, result.SSH.SoftwareVersion, strings.Join(result.SSH.AuthMethods, ", "))
+			if len(result.SSH.WeakAlgorithms) > 0 {
+				fmt.Fprintf(os.Stderr, "Weak SSH algorithms: %s\n", strings.Join(result.SSH.WeakAlgorithms, ", "))
+			}
 		}
-		// Perform service discovery for open UDP ports
-		for _, port := range target.UDPPorts {
-			discoveryResult, err := ScanTargets(context.Background(), target.Host, port)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error while discovering services on %s:%d: %s\n", target.Host, port, err)
-				continue
+		if result.HTTP != nil {
+			fmt.Fprintf(os.Stderr, "HTTP: %d", result.HTTP.StatusCode)
+			if result.HTTP.Server != "" {
+				fmt.Fprintf(os.Stderr, ", server %s", result.HTTP.Server)
 			}
-
-			// Print discovered services
-			fmt.Fprintf(os.Stderr, "Services discovered on %s:%d:\n", target.Host, port)
-			fmt.Fprintf(os.Stderr, "Session Layer: %s\n", discoveryResult.SessionLayer)
-			fmt.Fprintf(os.Stderr, "Presentation Layer: %s\n", discoveryResult.PresentationLayer)
-			fmt.Fprintf(os.Stderr, "Application Layer: %s\n", discoveryResult.ApplicationLayer)
-			fmt.Fprintf(os.Stderr, "Authenticated: %v\n", discoveryResult.IsAuthenticated)
-			fmt.Fprintf(os.Stderr, "Properties: %s\n", discoveryResult.Properties)
-			// Store discovery results in a map
-			resultMap := map[string]interface{}{
-				"host":              target.Host,
-				"port":              port,
-				"type":              "udp",
-				"sessionlayer":      discoveryResult.SessionLayer,
-				"presentationlayer": discoveryResult.PresentationLayer,
-				"applicationlayer":  discoveryResult.ApplicationLayer,
-				"service":           discoveryResult.ApplicationLayer,
-				"authenticated":     discoveryResult.IsAuthenticated,
-				"properties":        discoveryResult.Properties,
+			if result.HTTP.Title != "" {
+				fmt.Fprintf(os.Stderr, ", title %q", result.HTTP.Title)
+			}
+			fmt.Fprintln(os.Stderr)
+			for _, path := range result.HTTP.Paths {
+				if path.Error != "" {
+					fmt.Fprintf(os.Stderr, "HTTP %s: %s\n", path.Path, path.Error)
+				} else {
+					fmt.Fprintf(os.Stderr, "HTTP %s: %d\n", path.Path, path.StatusCode)
+				}
+			}
+		}
+		if result.HTTP2 != nil {
+			fmt.Fprintf(os.Stderr, "HTTP/2: %s", result.HTTP2.Mode)
+			if result.HTTP2.StatusCode != 0 {
+				fmt.Fprintf(os.Stderr, ", %d", result.HTTP2.StatusCode)
+			}
+			if result.HTTP2.Server != "" {
+				fmt.Fprintf(os.Stderr, ", server %s", result.HTTP2.Server)
+			}
+			fmt.Fprintln(os.Stderr)
+		}
+		if result.WebSocket != nil {
+			for _, endpoint := range result.WebSocket.Endpoints {
+				switch {
+				case endpoint.CredentialsRequired:
+					fmt.Fprintf(os.Stderr, "WebSocket %s: credentials required (%d)\n", endpoint.Path, endpoint.StatusCode)
+				case len(endpoint.Subprotocols) > 0:
+					fmt.Fprintf(os.Stderr, "WebSocket %s: upgraded, subprotocols %s\n", endpoint.Path, strings.Join(endpoint.Subprotocols, ", "))
+				default:
+					fmt.Fprintf(os.Stderr, "WebSocket %s: upgraded\n", endpoint.Path)
+				}
+			}
+		}
+		if result.StartTLS != nil {
+			fmt.Fprintf(os.Stderr, "STARTTLS: offered %t, required %t\n", result.StartTLS.Offered, result.StartTLS.Required)
+		}
+		if result.TLS != nil && result.TLS.ClientCertificateRequest != nil {
+			request := result.TLS.ClientCertificateRequest
+			if request.MTLSRequired == nil {
+				fmt.Fprintf(os.Stderr, "TLS: client certificate requested, handshake failed without one\n")
+			} else if *request.MTLSRequired {
+				fmt.Fprintf(os.Stderr, "TLS: mTLS required\n")
+			} else {
+				fmt.Fprintf(os.Stderr, "TLS: client certificate requested\n")
+			}
+			if len(request.AcceptableCAs) > 0 {
+				fmt.Fprintf(os.Stderr, "Acceptable client certificate CAs: %s\n", strings.Join(request.AcceptableCAs, "; "))
+			}
+		}
+		if result.TLS != nil && result.TLS.Enumeration != nil {
+			enumeration := result.TLS.Enumeration
+			fmt.Fprintf(os.Stderr, "TLS grade: %s, versions: %s\n", enumeration.Grade, strings.Join(enumeration.Versions, ", "))
+			for _, reason := range enumeration.GradeReasons {
+				fmt.Fprintf(os.Stderr, "TLS weakness: %s\n", reason)
 			}
-
-			// Append results to discoveryResults slice
-			discoveryResults = append(discoveryResults, resultMap)
+		}
+		if len(result.Matches) > 1 {
+			for _, match := range result.Matches[1:] {
+				fmt.Fprintf(os.Stderr, "Other match: %s (confidence %d)\n", match.Service, match.Confidence)
+			}
+		}
+		for _, resultErr := range result.Errors {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", resultErr)
 		}
 	}
 
@@ -150,104 +274,149 @@ func scan(cmd *cobra.Command, args []string) error {
 		if outputFileFlag != "" {
 			// Open output file
 			var err error
-			outputFile, err = os.OpenFile(outputFileFlag, os.O_CREATE|os.O_WRONLY, 0644)
+			outputFile, err = os.OpenFile(outputFileFlag, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 			if err != nil {
 				return err
 			}
 			defer outputFile.Close()
 		}
-		// Encode discoveryResults slice as JSON and write to file
+		// Encode the versioned report as JSON and write it to the file
+		report := networkscanner.NewScanReport(serviceResults, scanErrors)
 		jsonEncoder := json.NewEncoder(outputFile)
-		err = jsonEncoder.Encode(discoveryResults)
+		err = jsonEncoder.Encode(report)
 		if err != nil {
 			return err
 		}
 
-		fmt.Printf("JSON data stored in file: %s\n", jsonFileName)
+		if outputFileFlag != "" {
+			fmt.Fprintf(os.Stderr, "JSON data stored in file: %s\n", outputFileFlag)
+		}
 	}
 
 	return nil
 }
 
-// Function to check if the string is an IP address range
-func isIPRange(ip string) bool {
-	if strings.Contains(ip, "-") {
-		// Split IP address range
-		ipRange := strings.Split(ip, "-")
-		startIP := net.ParseIP(ipRange[0])
-		endIP := net.ParseIP(ipRange[1])
-		if startIP == nil || endIP == nil {
-			return false
-		}
-		return true
+// resultPort returns the port and transport of a per-port scan result
+func resultPort(result networkscanner.ScanResult) (int, string) {
+	if len(result.UDPPorts) > 0 {
+		return result.UDPPorts[0], "udp"
 	}
-	return false
+	if len(result.TCPPorts) > 0 {
+		return result.TCPPorts[0], "tcp"
+	}
+	return 0, ""
 }
 
-func parseArgs(args []string) (*portdiscovery.ScanConfig, error) {
-	config := &portdiscovery.ScanConfig{}
+// splitErrors returns the errors joined in err, or err itself
+func splitErrors(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
 
-	if len(args) < 1 {
-		return nil, fmt.Errorf("Usage: scan [--tcp|--udp] <host or ip_address or ip_range> [ports...]")
+func authenticationText(result networkscanner.ScanResult) string {
+	if result.Authenticated == "" {
+		return "-"
 	}
+	if result.AuthenticationReason == "" {
+		return strings.ToLower(result.Authenticated)
+	}
+	return fmt.Sprintf("%s (%s)", strings.ToLower(result.Authenticated), result.AuthenticationReason)
+}
 
-	targetStr := args[0]
-	if isIPRange(targetStr) { // check if target is a range of IP addresses
-		ipRange := strings.Split(targetStr, "-")
-		startIP := net.ParseIP(ipRange[0])
-		endIP := net.ParseIP(ipRange[1])
-		if startIP == nil || endIP == nil {
-			return nil, fmt.Errorf("Invalid IP address range.")
-		}
-		for ip := startIP; ip.String() <= endIP.String(); portdiscovery.IncIP(ip) {
-			if ip.To4() == nil {
-				fmt.Fprintf(os.Stderr, "IPv6 address not supported: %s\n", ip.String())
-				continue
-			}
-			target := portdiscovery.ScanTarget{IPStart: ip}
-			config.Targets = append(config.Targets, target)
-		}
-	} else {
-		target := portdiscovery.ScanTarget{Hostname: targetStr}
-		if ip := net.ParseIP(target.Hostname); ip != nil {
-			if ip.To4() == nil {
-				return nil, fmt.Errorf("IPv6 address not supported.")
-			}
-			target.IPStart = ip
-		} else {
-			// Resolve hostname
-			addrs, err := net.LookupHost(target.Hostname)
+func parseArgs(args []string) (networkscanner.TargetDescription, error) {
+	target := networkscanner.TargetDescription{TargetType: networkscanner.TARGET_TYPE_SPECS}
+
+	// Positional arguments are targets followed by ports. All target flags
+	// and arguments are merged into a single target set, and all port flags
+	// and arguments into a single port set.
+	targetSpecs := []string{}
+	portLists := [][]int{portFlag}
+	for _, arg := range args {
+		if portSpecPattern.MatchString(arg) {
+			ports, err := portdiscovery.ParsePorts(arg)
 			if err != nil {
-				return nil, fmt.Errorf("Failed to resolve hostname: %s", target.Hostname)
-			}
-			target.IPStart = net.ParseIP(addrs[0])
-			if target.IPStart.To4() == nil {
-				return nil, fmt.Errorf("IPv6 address not supported.")
+				return target, err
 			}
+			portLists = append(portLists, ports)
+			continue
 		}
-		config.Targets = append(config.Targets, target)
+		if len(portLists) > 1 {
+			return target, fmt.Errorf("Invalid port number: %s", arg)
+		}
+		targetSpecs = append(targetSpecs, arg)
 	}
-
-	if len(args) > 1 {
-		for _, portStr := range args[1:] {
-			port, err := strconv.Atoi(portStr)
-			if err != nil {
-				return nil, fmt.Errorf("Invalid port number: %s", portStr)
-			}
-			if port < 1 || port > 65535 {
-				return nil, fmt.Errorf("Port number out of range: %s", portStr)
-			}
-			config.Ports = append(config.Ports, port)
+	for _, port := range portFlag {
+		if port < 1 || port > 65535 {
+			return target, fmt.Errorf("Port number out of range: %d", port)
 		}
 	}
+	if portsFlag != "" {
+		ports, err := portdiscovery.ParsePorts(portsFlag)
+		if err != nil {
+			return target, err
+		}
+		portLists = append(portLists, ports)
+	}
+	if topPortsFlag < 0 {
+		return target, fmt.Errorf("Number of top ports cannot be negative")
+	}
+	if topPortsFlag > 0 {
+		portLists = append(portLists, portdiscovery.TopPorts(topPortsFlag))
+	}
+	if commonFlag {
+		portLists = append(portLists, scanner.CommonPorts())
+	}
+	// No ports at all means every port
+	target.Ports = portdiscovery.MergePorts(portLists...)
+	if ipFlag != "" {
+		targetSpecs = append(targetSpecs, ipFlag)
+	}
+	targetSpecs = append(targetSpecs, ipListFlag...)
+	if ipRangeFlag != "" {
+		targetSpecs = append(targetSpecs, ipRangeFlag)
+	}
+	targetSpecs = append(targetSpecs, hostnameFlag...)
+	if targetsFileFlag != "" {
+		fileSpecs, err := readTargetsFile(targetsFileFlag)
+		if err != nil {
+			return target, err
+		}
+		targetSpecs = append(targetSpecs, fileSpecs...)
+	}
+
+	if len(targetSpecs) < 1 {
+		return target, fmt.Errorf("Usage: scan [--tcp|--udp] <host or ip_address or ip_range or cidr>[,...] [ports or port ranges...]")
+	}
 
-	// Parse TCP and UDP flags
-	if tcpFlag && !udpFlag {
-		config.TcpOnly = true
+	target.Specs = targetSpecs
+	target.Exclude = excludeFlag
+	if connectTimeoutFlag <= 0 || readTimeoutFlag <= 0 || probeTimeoutFlag <= 0 {
+		return target, fmt.Errorf("Timeouts must be positive durations (e.g. 500ms, 2s)")
 	}
-	if udpFlag && !tcpFlag {
-		config.UdpOnly = true
+	if targetTimeoutFlag < 0 || retriesFlag < 0 {
+		return target, fmt.Errorf("Target timeout and retries cannot be negative")
 	}
 
-	return config, nil
+	// Neither or both flags scan TCP and UDP
+	target.TcpPorts = tcpFlag
+	target.UdpPorts = udpFlag
+
+	return target, nil
+}
+
+// Positional arguments made of digits, commas and dashes are port specifications
+var portSpecPattern = regexp.MustCompile(`^[0-9][0-9,-]*$`)
+
+func readTargetsFile(fileName string) ([]string, error) {
+	if fileName == "-" {
+		return portdiscovery.ReadTargetSpecs(os.Stdin)
+	}
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return portdiscovery.ReadTargetSpecs(file)
 }
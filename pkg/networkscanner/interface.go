@@ -1,6 +1,9 @@
 package networkscanner
 
-import "net"
+import (
+	"net"
+	"time"
+)
 
 ////////////////////////////////////////////////////////////////////////////////////////
 // Interface definition for network scanner and service discovery
@@ -11,12 +14,25 @@ const (
 	TARGET_TYPE_IP_LIST                           = "IP_LIST"
 	TARGET_TYPE_IP_RANGE                          = "IP_RANGE"
 	TARGET_TYPE_HOSTNAME                          = "HOSTNAME"
+	TARGET_TYPE_SPECS                             = "SPECS" // Addresses, CIDRs, ranges and hostnames given as text
 	PORT_TYPE_SINGLE                              = "SINGLE"
 	PORT_TYPE_LIST                                = "LIST"
 	PORT_TYPE_RANGE                               = "RANGE"
+	PORT_TYPE_TOP                                 = "TOP"    // The TopPorts most frequently open ports
+	PORT_TYPE_COMMON                              = "COMMON" // Ports of the services known to the discovery registries
 	AUTHENTICATION_STATUS_AUTHENTICATED           = "AUTHENTICATED"
 	AUTHENTICATION_STATUS_UNAUTHENTICATED         = "UNAUTHENTICATED"
 	AUTHENTICATION_STATUS_PARTIALLY_AUTHENTICATED = "PARTIALLY_AUTHENTICATED"
+	AUTHENTICATION_STATUS_UNKNOWN                 = "UNKNOWN"
+	PORT_STATE_OPEN                               = "OPEN"
+	PORT_STATE_OPEN_FILTERED                      = "OPEN_FILTERED" // No answer, the port is either open or filtered
+	PORT_STATE_CLOSED                             = "CLOSED"
+	DISCOVERY_STATUS_IDENTIFIED                   = "IDENTIFIED"   // An application layer service or an SSH server was detected
+	DISCOVERY_STATUS_UNIDENTIFIED                 = "UNIDENTIFIED" // Discovery ran but no service was detected
+	DISCOVERY_STATUS_ERROR                        = "ERROR"        // Discovery failed or was cut short, see Errors
+	PROBE_LAYER_SESSION                           = "SESSION"
+	PROBE_LAYER_PRESENTATION                      = "PRESENTATION"
+	PROBE_LAYER_APPLICATION                       = "APPLICATION"
 )
 
 // Struct defining targets of the network scanner
@@ -26,26 +42,64 @@ type TargetDescription struct {
 	IPStart    net.IP
 	IPEnd      net.IP
 	Hostname   string
+	Specs      []string // Targets of TARGET_TYPE_SPECS, see portdiscovery.ParseTargets
+	Exclude    []string // Specifications left out of TARGET_TYPE_SPECS targets
 	PortType   string
 	Ports      []int
 	PortStart  int
 	PortEnd    int
+	TopPorts   int
 	TcpPorts   bool
 	UdpPorts   bool
 }
 
 // Struct defining the result of the network scanner
 type ScanResult struct {
-	Host              string
-	IP                net.IP
-	TCPPorts          []int
-	UDPPorts          []int
-	Service           string // Maybe we need to break this down into more fields (HTTP, Kubelete etc.)
-	Authenticated     string
-	SecureProtocol    bool // TLS/SSL
-	SessionLayer      string
-	PresentationLayer string
-	ApplicationLayer  string
+	Host                 string
+	IP                   net.IP
+	TCPPorts             []int
+	UDPPorts             []int
+	UDPPortStates        map[int]string // PORT_STATE_* of each port in UDPPorts
+	Service              string         // Maybe we need to break this down into more fields (HTTP, Kubelete etc.)
+	Authenticated        string         // AUTHENTICATION_STATUS_* of the service, empty if none was detected
+	AuthenticationReason string
+	SecureProtocol       bool // TLS/SSL
+	SessionLayer         string
+	PresentationLayer    string
+	ApplicationLayer     string
+	Properties           map[string]interface{}
+	RoundTripTime        time.Duration     // Smoothed round trip time measured by the port scan
+	DiscoveryDuration    time.Duration     // Time spent on service discovery
+	TLS                  *TLSDetails       // Negotiated TLS session, if the session layer is TLS or STARTTLS
+	StartTLS             *StartTLSDetails  // In-band TLS upgrade, if the application protocol has one
+	SSH                  *SSHDetails       // SSH server, if the session layer is SSH
+	HTTP                 *HTTPDetails      // Answer of the HTTP server, if HTTP was detected
+	HTTP2                *HTTP2Details     // HTTP/2 connection, if HTTP/2 was detected
+	WebSocket            *WebSocketDetails // Paths upgrading to WebSocket, if any was found
+	Errors               []string          // Errors of service discovery on the port
+	Matches              []ServiceMatch    // Every service detected on the port, best match first
+	Status               string            // DISCOVERY_STATUS_* of the port
+	Probes               []ProbeRecord     // Discovery probes run on the port, layer by layer
+}
+
+// Struct defining a single discovery probe run on a port
+type ProbeRecord struct {
+	Layer    string // PROBE_LAYER_*
+	Name     string
+	Duration time.Duration
+	Detected bool
+	TimedOut bool
+	Error    string // Empty if the probe ran to completion
+}
+
+// Struct defining a service detected on a port, with how sure the detection is
+type ServiceMatch struct {
+	Service              string
+	Confidence           int    // From 0 to 100
+	Authenticated        string // AUTHENTICATION_STATUS_* of the service
+	AuthenticationReason string
+	Evidence             []string
+	Properties           map[string]interface{}
 }
 
 // Interface for network scanner
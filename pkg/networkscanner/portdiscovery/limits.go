@@ -0,0 +1,173 @@
+package portdiscovery
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// File descriptors kept free for the rest of the process
+const reservedFileDescriptors = 64
+
+// workerCount returns the number of workers to use. Every worker holds at
+// most one socket, a port probe or a service discovery probe, so the count is
+// kept below the open file limit.
+func workerCount(requested int) int {
+	workers := requested
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	if limit := fileDescriptorLimit(); limit > 0 {
+		available := limit - reservedFileDescriptors
+		if available < 1 {
+			available = 1
+		}
+		if workers > available {
+			workers = available
+		}
+	}
+	return workers
+}
+
+// rateLimiter spaces probes evenly to stay below a number of probes per second
+type rateLimiter struct {
+	ticker *time.Ticker
+}
+
+// newRateLimiter returns a limiter for rate probes per second, or nil, which
+// does not limit, if rate is not positive or above one probe per nanosecond
+func newRateLimiter(rate int) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	interval := time.Second / time.Duration(rate)
+	if interval <= 0 {
+		return nil
+	}
+	return &rateLimiter{ticker: time.NewTicker(interval)}
+}
+
+// wait blocks until the next probe may be sent or ctx is done
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	select {
+	case <-l.ticker.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *rateLimiter) stop() {
+	if l != nil {
+		l.ticker.Stop()
+	}
+}
+
+// WorkerPool bounds the work running at the same time over all targets and
+// on a single target, and spaces it to stay below a number of starts per
+// second. Port discovery and service discovery both take a worker per probe;
+// sharing the pool keeps a whole scan within the same limits.
+type WorkerPool struct {
+	workers     chan struct{}
+	hostWorkers int
+	limiter     *rateLimiter
+
+	mu    sync.Mutex
+	hosts map[string]*targetWorkers
+}
+
+// Workers of a single target, dropped once no Acquire holds or waits for
+// them
+type targetWorkers struct {
+	workers chan struct{}
+	users   int
+}
+
+// NewWorkerPool returns a pool of workers over all targets, of which
+// hostWorkers per target, started at most rate times per second. Values
+// that are not positive use DefaultWorkers, DefaultHostWorkers and no rate
+// limit. The number of workers is lowered to fit the file descriptor limit.
+func NewWorkerPool(workers int, hostWorkers int, rate int) *WorkerPool {
+	if hostWorkers <= 0 {
+		hostWorkers = DefaultHostWorkers
+	}
+	return &WorkerPool{
+		workers:     make(chan struct{}, workerCount(workers)),
+		hostWorkers: hostWorkers,
+		limiter:     newRateLimiter(rate),
+		hosts:       map[string]*targetWorkers{},
+	}
+}
+
+// Size returns the number of workers over all targets
+func (p *WorkerPool) Size() int {
+	return cap(p.workers)
+}
+
+// Acquire waits for a worker of host and of the pool, then for the rate
+// limit. Every successful Acquire must be followed by a Release.
+func (p *WorkerPool) Acquire(ctx context.Context, host string) error {
+	hostWorkers := p.joinHost(host)
+	select {
+	case hostWorkers <- struct{}{}:
+	case <-ctx.Done():
+		p.leaveHost(host)
+		return ctx.Err()
+	}
+	select {
+	case p.workers <- struct{}{}:
+	case <-ctx.Done():
+		<-hostWorkers
+		p.leaveHost(host)
+		return ctx.Err()
+	}
+	if err := p.limiter.wait(ctx); err != nil {
+		p.Release(host)
+		return err
+	}
+	return nil
+}
+
+// Release gives back the workers taken by Acquire
+func (p *WorkerPool) Release(host string) {
+	<-p.workers
+	p.mu.Lock()
+	hostWorkers := p.hosts[host].workers
+	p.mu.Unlock()
+	<-hostWorkers
+	p.leaveHost(host)
+}
+
+// Stop releases the resources of the rate limit
+func (p *WorkerPool) Stop() {
+	p.limiter.stop()
+}
+
+// joinHost returns the workers of host, created on first use, and counts
+// the caller as one of their users until leaveHost
+func (p *WorkerPool) joinHost(host string) chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	hostWorkers, ok := p.hosts[host]
+	if !ok {
+		hostWorkers = &targetWorkers{workers: make(chan struct{}, p.hostWorkers)}
+		p.hosts[host] = hostWorkers
+	}
+	hostWorkers.users++
+	return hostWorkers.workers
+}
+
+// leaveHost drops the workers of host once their last user left, so that
+// the pool does not grow with every target of a scan
+func (p *WorkerPool) leaveHost(host string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	hostWorkers := p.hosts[host]
+	hostWorkers.users--
+	if hostWorkers.users == 0 {
+		delete(p.hosts, host)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package portdiscovery
+
+// fileDescriptorLimit returns 0 where the open file limit is not known
+func fileDescriptorLimit() int {
+	return 0
+}
@@ -0,0 +1,43 @@
+package portdiscovery
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestNewRateLimiter(t *testing.T) {
+	for _, rate := range []int{-1, 0, 2e9, math.MaxInt} {
+		if limiter := newRateLimiter(rate); limiter != nil {
+			limiter.stop()
+			t.Errorf("newRateLimiter(%d) limits, want no limit", rate)
+		}
+	}
+	limiter := newRateLimiter(1e9)
+	if limiter == nil {
+		t.Fatal("newRateLimiter(1e9) does not limit")
+	}
+	limiter.stop()
+}
+
+func TestWorkerPoolDropsReleasedHosts(t *testing.T) {
+	pool := NewWorkerPool(4, 1, 0)
+	defer pool.Stop()
+
+	if err := pool.Acquire(context.Background(), "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	// The only worker of the host is taken, a second Acquire gives up
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := pool.Acquire(ctx, "10.0.0.1"); err == nil {
+		t.Fatal("Acquire of a busy host succeeded with a done context")
+	}
+	if len(pool.hosts) != 1 {
+		t.Errorf("%d hosts while one is acquired, want 1", len(pool.hosts))
+	}
+	pool.Release("10.0.0.1")
+	if len(pool.hosts) != 0 {
+		t.Errorf("%d hosts after the last release, want 0", len(pool.hosts))
+	}
+}
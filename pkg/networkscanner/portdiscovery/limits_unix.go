@@ -0,0 +1,17 @@
+//go:build unix
+
+package portdiscovery
+
+import "syscall"
+
+// fileDescriptorLimit returns the soft limit of open files of the process
+func fileDescriptorLimit() int {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return 0
+	}
+	if limit.Cur > 1<<20 {
+		return 1 << 20
+	}
+	return int(limit.Cur)
+}
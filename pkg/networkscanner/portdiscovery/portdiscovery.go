@@ -1,9 +1,15 @@
 package portdiscovery
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner"
@@ -12,9 +18,29 @@ import (
 type ScanConfig struct {
 	Targets []ScanTarget
 	Ports   []int
+	// Time to wait for a port to answer a single probe
 	Timeout time.Duration
 	TcpOnly bool
 	UdpOnly bool
+	// Additional probes sent to a port that did not answer in time
+	Retries int
+	// Derive the probe timeout of each target from its measured round trip
+	// time, with Timeout as the upper bound reference
+	Adaptive bool
+	// Time spent probing a single target, counted from its first probe,
+	// unlimited if not set
+	TargetTimeout time.Duration
+	// Maximal number of ports probed at the same time over all targets,
+	// DefaultWorkers if not set. It is lowered to fit the file descriptor limit.
+	Workers int
+	// Maximal number of ports probed at the same time on a single target,
+	// DefaultHostWorkers if not set
+	HostWorkers int
+	// Maximal number of probes sent per second, unlimited if not set
+	Rate int
+	// Workers shared with other work of the scan. If set, it replaces
+	// Workers, HostWorkers and Rate.
+	Pool *WorkerPool
 }
 
 type ScanTarget struct {
@@ -23,78 +49,179 @@ type ScanTarget struct {
 }
 
 // Struct defining the result of the network scanner
-func SccanTarget(target ScanTarget, proto string, ports []int, timeout time.Duration, results chan<- networkscanner.ScanResult, wg *sync.WaitGroup) {
+func SccanTarget(ctx context.Context, target ScanTarget, proto string, ports []int, timeout time.Duration, results chan<- networkscanner.ScanResult, wg *sync.WaitGroup) {
 	defer wg.Done()
-	portsOpen := scanIP(target.IPStart.String(), proto, ports, timeout)
-	if len(portsOpen.TCPPorts) > 0 || len(portsOpen.UDPPorts) > 0 {
-		result := networkscanner.ScanResult{
-			Host:     target.Hostname,
-			IP:       target.IPStart,
-			TCPPorts: portsOpen.TCPPorts,
-			UDPPorts: portsOpen.UDPPorts,
-		}
+	config := ScanConfig{
+		Targets: []ScanTarget{target},
+		Ports:   ports,
+		Timeout: timeout,
+		TcpOnly: proto == "tcp",
+		UdpOnly: proto == "udp",
+	}
+	for _, result := range ScanTargets(ctx, config) {
 		results <- result
 	}
 }
 
-func ScanTargets(targets []ScanTarget, tcpOnly bool, udpOnly bool, ports []int, timeout time.Duration) []networkscanner.ScanResult {
-	var wg sync.WaitGroup
-	results := make(chan networkscanner.ScanResult, len(targets))
+// ScanTargets scans the targets of config for open ports and returns one
+// result per target that has any. All probes share a single pool of workers,
+// and ports are visited round robin over the targets so that no host gets
+// more than HostWorkers concurrent probes while others wait. When ctx is
+// cancelled the scan stops and the open ports found so far are returned.
+func ScanTargets(ctx context.Context, config ScanConfig) []networkscanner.ScanResult {
+	var protos []string
+	switch {
+	case config.TcpOnly:
+		protos = []string{"tcp"}
+	case config.UdpOnly:
+		protos = []string{"udp"}
+	default:
+		protos = []string{"tcp", "udp"}
+	}
+	ports := config.Ports
+	// If no ports are specified, scan all ports
+	if len(ports) == 0 {
+		for port := 1; port <= maxPort; port++ {
+			ports = append(ports, port)
+		}
+	}
+
+	pool := config.Pool
+	if pool == nil {
+		pool = NewWorkerPool(config.Workers, config.HostWorkers, config.Rate)
+		defer pool.Stop()
+	}
 
-	for _, target := range targets {
+	// One state per target tracks its round trip time and time budget
+	targets := make([]*targetState, len(config.Targets))
+	for i := range targets {
+		targets[i] = &targetState{}
+		defer targets[i].done()
+	}
+
+	// Jobs are generated lazily, port by port over all targets
+	jobs := make(chan portJob)
+	go func() {
+		defer close(jobs)
+		for _, proto := range protos {
+			for _, port := range ports {
+				for target := range config.Targets {
+					select {
+					case jobs <- portJob{target: target, proto: proto, port: port}:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	openPorts := make(chan portJobResult)
+	var wg sync.WaitGroup
+	for i := 0; i < pool.Size(); i++ {
 		wg.Add(1)
-		go func(target ScanTarget) {
+		go func() {
 			defer wg.Done()
-			switch {
-			case !tcpOnly && !udpOnly:
-				tcpPortsOpen := scanIP(target.IPStart.String(), "tcp", ports, timeout)
-				udpPortsOpen := scanIP(target.IPStart.String(), "udp", ports, timeout)
-				if len(tcpPortsOpen.TCPPorts) > 0 || len(udpPortsOpen.UDPPorts) > 0 {
-					result := networkscanner.ScanResult{
-						Host:     target.Hostname,
-						IP:       target.IPStart,
-						TCPPorts: tcpPortsOpen.TCPPorts,
-						UDPPorts: udpPortsOpen.UDPPorts,
-					}
-					results <- result
+			for job := range jobs {
+				target := targets[job.target]
+				targetCtx := target.context(ctx, config.TargetTimeout)
+				ip := config.Targets[job.target].IPStart.String()
+				if pool.Acquire(targetCtx, ip) != nil {
+					continue
 				}
-			case tcpOnly:
-				tcpPortsOpen := scanIP(target.IPStart.String(), "tcp", ports, timeout)
-				if len(tcpPortsOpen.TCPPorts) > 0 {
-					result := networkscanner.ScanResult{
-						Host:     target.Hostname,
-						IP:       target.IPStart,
-						TCPPorts: tcpPortsOpen.TCPPorts,
-					}
-					results <- result
+				timeout := config.Timeout
+				if config.Adaptive {
+					timeout = target.rtt.timeout(timeout)
 				}
-			case udpOnly:
-				udpPortsOpen := scanIP(target.IPStart.String(), "udp", ports, timeout)
-				if len(udpPortsOpen.UDPPorts) > 0 {
-					result := networkscanner.ScanResult{
-						Host:     target.Hostname,
-						IP:       target.IPStart,
-						UDPPorts: udpPortsOpen.UDPPorts,
-					}
-					results <- result
+				state, rtt := scanPort(targetCtx, ip, job.port, job.proto, timeout, config.Retries)
+				if rtt > 0 {
+					target.rtt.observe(rtt)
+				}
+				pool.Release(ip)
+				if state != networkscanner.PORT_STATE_CLOSED {
+					openPorts <- portJobResult{portJob: job, state: state}
 				}
 			}
-		}(target)
+		}()
 	}
 
+	// Start a goroutine to wait for all workers to finish
 	go func() {
 		wg.Wait()
-		close(results)
+		close(openPorts)
 	}()
 
+	// Collect the open ports from the channel
+	results := make([]networkscanner.ScanResult, len(config.Targets))
+	for open := range openPorts {
+		result := &results[open.target]
+		switch open.proto {
+		case "tcp":
+			result.TCPPorts = append(result.TCPPorts, open.port)
+		case "udp":
+			result.UDPPorts = append(result.UDPPorts, open.port)
+			if result.UDPPortStates == nil {
+				result.UDPPortStates = map[int]string{}
+			}
+			result.UDPPortStates[open.port] = open.state
+		}
+	}
+
 	var scanResults []networkscanner.ScanResult
-	for result := range results {
+	for i, result := range results {
+		if len(result.TCPPorts) == 0 && len(result.UDPPorts) == 0 {
+			continue
+		}
+		result.Host = config.Targets[i].Hostname
+		result.IP = config.Targets[i].IPStart
+		result.RoundTripTime = targets[i].rtt.estimate()
+		sort.Ints(result.TCPPorts)
+		sort.Ints(result.UDPPorts)
 		scanResults = append(scanResults, result)
 	}
 
 	return scanResults
 }
 
+// portJob is a single port to probe on one of the targets
+type portJob struct {
+	target int
+	proto  string
+	port   int
+}
+
+type portJobResult struct {
+	portJob
+	state string
+}
+
+// targetState is shared by the workers probing the same target
+type targetState struct {
+	rtt rttEstimator
+
+	once   sync.Once
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// context returns the context of the probes against the target. With a
+// target timeout it expires that long after the first probe started.
+func (t *targetState) context(ctx context.Context, timeout time.Duration) context.Context {
+	if timeout <= 0 {
+		return ctx
+	}
+	t.once.Do(func() {
+		t.ctx, t.cancel = context.WithTimeout(ctx, timeout)
+	})
+	return t.ctx
+}
+
+func (t *targetState) done() {
+	if t.cancel != nil {
+		t.cancel()
+	}
+}
+
 // Increment IP address
 func IncIP(ip net.IP) {
 	for j := len(ip) - 1; j >= 0; j-- {
@@ -106,86 +233,12 @@ func IncIP(ip net.IP) {
 	}
 }
 
-// Define the maximum port number and the number of goroutines to use
-const maxPort = 65535
-const numGoroutines = 8
-
-/* scanIP scans the specified IP address for open TCP and UDP ports.
- If no ports are specified, it scans all ports. Returns a ScanResult
-struct containing the IP address and open TCP and UDP ports. */
-
-func scanIP(ip string, proto string, ports []int, timeout time.Duration) networkscanner.ScanResult {
-	// Create a channel to collect open ports and a done channel for synchronization
-	openPorts := make(chan int)
-	done := make(chan struct{})
-	defer close(done)
-
-	// Parse the IP address
-	ipAddr := net.ParseIP(ip)
-	if ipAddr == nil {
-		// Invalid IP address
-		fmt.Printf("%s is not a valid IP address\n", ip)
-		return networkscanner.ScanResult{}
-	}
-
-	// Start a fixed number of goroutines for scanning ports
-	var wg sync.WaitGroup
-	semaphore := make(chan struct{}, numGoroutines)
-	for _, port := range ports {
-		wg.Add(1)
-		semaphore <- struct{}{}
-		go func(port int) {
-			defer func() {
-				wg.Done()
-				<-semaphore
-			}()
-			if isOpen(ip, port, proto, timeout) {
-				//fmt.Printf("%s:%d/%s is open\n", ip, port, proto)
-				openPorts <- port
-			}
-		}(port)
-	}
-
-	// If no ports are specified, scan all ports
-	if len(ports) == 0 {
-		for port := 1; port <= maxPort; port++ {
-			wg.Add(1)
-			go func(port int) {
-				defer wg.Done()
-				if isOpen(ip, port, proto, timeout) {
-					//fmt.Printf("%s:%d/%s is open\n", ip, port, proto)
-					openPorts <- port
-				}
-			}(port)
-		}
-	}
-
-	// Start a goroutine to wait for all other goroutines to finish
-	go func() {
-		wg.Wait()
-		close(openPorts)
-	}()
-
-	// Collect the open ports from the channel
-	openTCPPorts := []int{}
-	openUDPPorts := []int{}
-	for port := range openPorts {
-		switch proto {
-		case "tcp":
-			openTCPPorts = append(openTCPPorts, port)
-		case "udp":
-			openUDPPorts = append(openUDPPorts, port)
-		}
-	}
-
-	// Create and return a ScanResult struct
-	result := networkscanner.ScanResult{
-		IP:       ipAddr,
-		TCPPorts: openTCPPorts,
-		UDPPorts: openUDPPorts,
-	}
-	return result
-}
+// Define the maximum port number and the default number of goroutines to use
+const (
+	maxPort            = 65535
+	DefaultWorkers     = 256
+	DefaultHostWorkers = 8
+)
 
 func PrintResults(results []networkscanner.ScanResult) {
 	for _, result := range results {
@@ -195,7 +248,15 @@ func PrintResults(results []networkscanner.ScanResult) {
 				fmt.Printf("TCP: %v\n", result.TCPPorts)
 			}
 			if len(result.UDPPorts) > 0 {
-				fmt.Printf("UDP: %v\n", result.UDPPorts)
+				udpPorts := []string{}
+				for _, port := range result.UDPPorts {
+					if result.UDPPortStates[port] == networkscanner.PORT_STATE_OPEN_FILTERED {
+						udpPorts = append(udpPorts, fmt.Sprintf("%d(open|filtered)", port))
+					} else {
+						udpPorts = append(udpPorts, strconv.Itoa(port))
+					}
+				}
+				fmt.Printf("UDP: [%s]\n", strings.Join(udpPorts, " "))
 			}
 		} else {
 			fmt.Printf("%s (%s) has an empty list of open ports.\n", result.Host, result.IP.String())
@@ -203,13 +264,35 @@ func PrintResults(results []networkscanner.ScanResult) {
 	}
 }
 
-// isOpen checks if the specified TCP or UDP port is open on the specified IP address.
-// Returns true if the port is open, false otherwise.
-func isOpen(ip string, port int, proto string, timeout time.Duration) bool {
-	conn, err := net.DialTimeout(proto, fmt.Sprintf("%s:%d", ip, port), timeout)
-	if err != nil {
-		return false
+// scanPort returns the state of a TCP or UDP port on the specified IP address,
+// and the round trip time of the probe if the target answered
+func scanPort(ctx context.Context, ip string, port int, proto string, timeout time.Duration, retries int) (string, time.Duration) {
+	if proto == "udp" {
+		return udpPortState(ctx, ip, port, timeout, retries)
+	}
+	return tcpPortState(ctx, ip, port, timeout, retries)
+}
+
+// tcpPortState connects to the specified TCP port, again up to retries times
+// if the connection attempt timed out. Both an accepted and a refused
+// connection measure the round trip time.
+func tcpPortState(ctx context.Context, ip string, port int, timeout time.Duration, retries int) (string, time.Duration) {
+	dialer := net.Dialer{Timeout: timeout}
+	for attempt := 0; attempt <= retries; attempt++ {
+		start := time.Now()
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip, strconv.Itoa(port)))
+		rtt := time.Since(start)
+		if err == nil {
+			conn.Close()
+			return networkscanner.PORT_STATE_OPEN, rtt
+		}
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			return networkscanner.PORT_STATE_CLOSED, rtt
+		}
+		var netErr net.Error
+		if ctx.Err() != nil || !errors.As(err, &netErr) || !netErr.Timeout() {
+			break
+		}
 	}
-	conn.Close()
-	return true
+	return networkscanner.PORT_STATE_CLOSED, 0
 }
@@ -0,0 +1,125 @@
+package portdiscovery
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// topPorts lists the TCP ports most often found open, most frequent first
+var topPorts = []int{
+	80, 23, 443, 21, 22, 25, 3389, 110, 445, 139, 143, 53, 135, 3306, 8080, 1723,
+	111, 995, 993, 5900, 1025, 587, 8888, 199, 1720, 465, 548, 113, 81, 6001, 10000, 514,
+	5060, 179, 1026, 2000, 8443, 8000, 32768, 554, 26, 1433, 49152, 2001, 515, 8008, 49154, 1027,
+	5666, 646, 5000, 5631, 631, 49153, 8081, 2049, 88, 79, 5800, 106, 2121, 1110, 49155, 6000,
+	513, 990, 5357, 427, 49156, 543, 544, 5101, 144, 7, 389, 8009, 3128, 444, 9999, 5009,
+	7070, 5190, 3000, 5432, 1900, 3986, 13, 1029, 9, 5051, 6646, 49157, 1028, 873, 1755, 2717,
+	4899, 9100, 119, 37, 1000, 3001, 5001, 82, 10010, 1030, 9090, 2107, 1024, 2103, 6004, 1801,
+	5050, 19, 8031, 1041, 255, 2967, 1049, 1048, 1053, 3703, 1056, 1065, 1064, 1054, 17, 808,
+	3689, 1031, 1044, 1071, 5901, 100, 9102, 8010, 2869, 1039, 5120, 4001, 9000, 2105, 636, 1038,
+	2601, 7000, 1, 1066, 1069, 625, 311, 280, 254, 4000, 5003, 1761, 2002, 2005, 1998, 1032,
+	1050, 6112, 3690, 1521, 2161, 6002, 1080, 2401, 4045, 902, 7937, 787, 1058, 2383, 32771, 1059,
+	1040, 1033, 50000, 5555, 10001, 1494, 593, 2301, 3, 3268, 7938, 1234, 1022, 1074, 8002, 1036,
+	1035, 9001, 1037, 464, 497, 1935, 6666, 2003, 6543, 1352, 24, 3269, 1111, 407, 500, 20,
+	2006, 3260, 15000, 1218, 1034, 4444, 264, 2004, 33, 1042, 42510, 999, 3052, 1023, 1068, 222,
+	7100, 888, 563, 1717, 2008, 992, 32770, 7001, 32772, 2007, 8082, 5550, 2009, 5801, 1043, 512,
+	2701, 7019, 50001, 1700, 4662, 2065, 2010, 42, 9535, 2602, 3333, 161, 5100, 5002, 2604, 4002,
+	6059, 1047, 8192, 8193, 2702, 6789, 9595, 1051, 9594, 9593, 16993, 16992, 5226, 5225, 32769, 3283,
+}
+
+// ParsePorts parses a port specification such as "1-1024,6443,8000-9000"
+// into a sorted list of distinct ports
+func ParsePorts(spec string) ([]int, error) {
+	seen := map[int]bool{}
+	var ports []int
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		start, end, err := parsePortRange(part)
+		if err != nil {
+			return nil, err
+		}
+		for port := start; port <= end; port++ {
+			if !seen[port] {
+				seen[port] = true
+				ports = append(ports, port)
+			}
+		}
+	}
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("no ports in %q", spec)
+	}
+	sort.Ints(ports)
+	return ports, nil
+}
+
+func parsePortRange(spec string) (int, int, error) {
+	bounds := strings.SplitN(spec, "-", 2)
+	start, err := parsePort(bounds[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	end := start
+	if len(bounds) == 2 {
+		if end, err = parsePort(bounds[1]); err != nil {
+			return 0, 0, err
+		}
+	}
+	if start > end {
+		return 0, 0, fmt.Errorf("invalid port range %q", spec)
+	}
+	return start, end, nil
+}
+
+func parsePort(spec string) (int, error) {
+	port, err := strconv.Atoi(strings.TrimSpace(spec))
+	if err != nil {
+		return 0, fmt.Errorf("invalid port %q", spec)
+	}
+	if port < 1 || port > maxPort {
+		return 0, fmt.Errorf("port number out of range: %d", port)
+	}
+	return port, nil
+}
+
+// TopPorts returns the n ports most often found open, most frequent first.
+// Past the frequency table the remaining ports follow in numeric order.
+func TopPorts(n int) []int {
+	if n > maxPort {
+		n = maxPort
+	}
+	if n <= len(topPorts) {
+		return append([]int{}, topPorts[:n]...)
+	}
+
+	ports := append([]int{}, topPorts...)
+	listed := map[int]bool{}
+	for _, port := range topPorts {
+		listed[port] = true
+	}
+	for port := 1; len(ports) < n; port++ {
+		if !listed[port] {
+			ports = append(ports, port)
+		}
+	}
+	return ports
+}
+
+// MergePorts returns the distinct ports of all lists, sorted
+func MergePorts(lists ...[]int) []int {
+	seen := map[int]bool{}
+	var ports []int
+	for _, list := range lists {
+		for _, port := range list {
+			if !seen[port] {
+				seen[port] = true
+				ports = append(ports, port)
+			}
+		}
+	}
+	sort.Ints(ports)
+	return ports
+}
@@ -0,0 +1,107 @@
+package portdiscovery
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParsePorts(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []int
+		err  bool
+	}{
+		{spec: "80", want: []int{80}},
+		{spec: "443,80,8080", want: []int{80, 443, 8080}},
+		{spec: "8000-8003", want: []int{8000, 8001, 8002, 8003}},
+		{spec: " 22 , 20-22 ,", want: []int{20, 21, 22}},
+		{spec: "1-1,65535", want: []int{1, 65535}},
+		{spec: "65534-65535", want: []int{65534, 65535}},
+		{spec: "0", err: true},
+		{spec: "65536", err: true},
+		{spec: "0-10", err: true},
+		{spec: "65530-65536", err: true},
+		{spec: "-1", err: true},
+		{spec: "10-1", err: true},
+		{spec: "http", err: true},
+		{spec: "80-", err: true},
+		{spec: "1-2-3", err: true},
+		{spec: "", err: true},
+		{spec: ",,", err: true},
+	}
+	for _, test := range tests {
+		ports, err := ParsePorts(test.spec)
+		if test.err {
+			if err == nil {
+				t.Errorf("ParsePorts(%q) = %v, want an error", test.spec, ports)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParsePorts(%q): %v", test.spec, err)
+			continue
+		}
+		if !slices.Equal(ports, test.want) {
+			t.Errorf("ParsePorts(%q) = %v, want %v", test.spec, ports, test.want)
+		}
+	}
+
+	ports, err := ParsePorts("1-65535")
+	if err != nil || len(ports) != maxPort || ports[0] != 1 || ports[len(ports)-1] != maxPort {
+		t.Errorf("ParsePorts(\"1-65535\") = %d ports, error %v", len(ports), err)
+	}
+}
+
+func TestTopPorts(t *testing.T) {
+	if ports := TopPorts(0); len(ports) != 0 {
+		t.Errorf("TopPorts(0) = %v", ports)
+	}
+	if ports := TopPorts(3); !slices.Equal(ports, []int{80, 23, 443}) {
+		t.Errorf("TopPorts(3) = %v, want [80 23 443]", ports)
+	}
+	if ports := TopPorts(len(topPorts)); !slices.Equal(ports, topPorts) {
+		t.Errorf("TopPorts(%d) is not the frequency table", len(topPorts))
+	}
+
+	// Past the table, the ports left follow in numeric order
+	ports := TopPorts(len(topPorts) + 3)
+	if !slices.Equal(ports[:len(topPorts)], topPorts) || !slices.Equal(ports[len(topPorts):], []int{2, 4, 5}) {
+		t.Errorf("TopPorts(%d) ends with %v, want [2 4 5]", len(ports), ports[len(topPorts):])
+	}
+
+	for _, n := range []int{maxPort, maxPort + 1} {
+		ports := TopPorts(n)
+		if len(ports) != maxPort {
+			t.Errorf("TopPorts(%d) = %d ports, want %d", n, len(ports), maxPort)
+		}
+		sorted := slices.Clone(ports)
+		slices.Sort(sorted)
+		if len(slices.Compact(sorted)) != maxPort || sorted[0] != 1 {
+			t.Errorf("TopPorts(%d) is not every port once", n)
+		}
+	}
+
+	// The result is a copy
+	TopPorts(1)[0] = 0
+	if topPorts[0] != 80 {
+		t.Error("TopPorts returns the frequency table itself")
+	}
+}
+
+func TestMergePorts(t *testing.T) {
+	tests := []struct {
+		lists [][]int
+		want  []int
+	}{
+		{lists: nil, want: nil},
+		{lists: [][]int{{}, nil}, want: nil},
+		{lists: [][]int{{443, 80}}, want: []int{80, 443}},
+		{lists: [][]int{{22, 80}, {80, 443}, {22}}, want: []int{22, 80, 443}},
+		{lists: [][]int{{65535}, {1}}, want: []int{1, 65535}},
+	}
+	for _, test := range tests {
+		if got := MergePorts(test.lists...); !slices.Equal(got, test.want) {
+			t.Errorf("MergePorts(%v) = %v, want %v", test.lists, got, test.want)
+		}
+	}
+}
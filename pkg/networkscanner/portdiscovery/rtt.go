@@ -0,0 +1,64 @@
+package portdiscovery
+
+import (
+	"sync"
+	"time"
+)
+
+// Bounds of the adaptive probe timeout
+const (
+	minAdaptiveTimeout   = 50 * time.Millisecond
+	adaptiveTimeoutLimit = 10
+)
+
+// rttEstimator keeps a smoothed round trip time of a target from the probes
+// that got an answer, the same way TCP does (RFC 6298)
+type rttEstimator struct {
+	mu      sync.Mutex
+	srtt    time.Duration
+	rttvar  time.Duration
+	samples int
+}
+
+func (e *rttEstimator) observe(rtt time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.samples == 0 {
+		e.srtt = rtt
+		e.rttvar = rtt / 2
+	} else {
+		delta := e.srtt - rtt
+		if delta < 0 {
+			delta = -delta
+		}
+		e.rttvar = (3*e.rttvar + delta) / 4
+		e.srtt = (7*e.srtt + rtt) / 8
+	}
+	e.samples++
+}
+
+// estimate returns the smoothed round trip time, zero before any answer
+func (e *rttEstimator) estimate() time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.srtt
+}
+
+// timeout returns the probe timeout for the target: base until a round trip
+// was measured, then srtt + 4*rttvar kept between minAdaptiveTimeout and ten
+// times base
+func (e *rttEstimator) timeout(base time.Duration) time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.samples == 0 {
+		return base
+	}
+	timeout := e.srtt + 4*e.rttvar
+	if timeout < minAdaptiveTimeout {
+		timeout = minAdaptiveTimeout
+	}
+	if base > 0 && timeout > adaptiveTimeoutLimit*base {
+		timeout = adaptiveTimeoutLimit * base
+	}
+	return timeout
+}
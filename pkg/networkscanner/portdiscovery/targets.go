@@ -0,0 +1,189 @@
+package portdiscovery
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+)
+
+// ipRange is an inclusive range of addresses, both ends in 16-byte form
+type ipRange struct {
+	start net.IP
+	end   net.IP
+}
+
+func (r ipRange) contains(ip net.IP) bool {
+	ip = ip.To16()
+	return bytes.Compare(ip, r.start) >= 0 && bytes.Compare(ip, r.end) <= 0
+}
+
+// targetSpec is a single parsed target specification. Hostnames can resolve
+// to several addresses, both IPv4 and IPv6.
+type targetSpec struct {
+	hostname string
+	ips      []ipRange
+}
+
+// Largest number of addresses a single range or CIDR may expand to
+const maxRangeSize = 1 << 24
+
+// ParseTargets expands target specifications into a deduplicated list of scan
+// targets, in the order they were given. A specification is an IP address, a
+// CIDR (10.0.0.0/24), a range (10.0.0.1-10.0.0.20) or a hostname, and several
+// of them can be joined with commas. Addresses matched by any of the excludes,
+// which use the same syntax, are left out.
+func ParseTargets(specs []string, excludes []string) ([]ScanTarget, error) {
+	var excluded []ipRange
+	for _, spec := range splitSpecs(excludes) {
+		parsed, err := parseTargetSpec(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude %q: %w", spec, err)
+		}
+		excluded = append(excluded, parsed.ips...)
+	}
+
+	var targets []ScanTarget
+	seen := map[string]bool{}
+	for _, spec := range splitSpecs(specs) {
+		parsed, err := parseTargetSpec(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target %q: %w", spec, err)
+		}
+		var ips []net.IP
+		for _, r := range parsed.ips {
+			rangeIPs, err := ExpandIPRange(r.start, r.end)
+			if err != nil {
+				return nil, err
+			}
+			ips = append(ips, rangeIPs...)
+		}
+	nextIP:
+		for _, ip := range ips {
+			if seen[ip.String()] {
+				continue
+			}
+			for _, r := range excluded {
+				if r.contains(ip) {
+					continue nextIP
+				}
+			}
+			seen[ip.String()] = true
+
+			hostname := parsed.hostname
+			if hostname == "" {
+				hostname = ip.String()
+			}
+			targets = append(targets, ScanTarget{Hostname: hostname, IPStart: ip})
+		}
+	}
+	return targets, nil
+}
+
+// ReadTargetSpecs reads target specifications from r, one or more per line.
+// Empty lines and lines starting with # are skipped.
+func ReadTargetSpecs(r io.Reader) ([]string, error) {
+	var specs []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		specs = append(specs, strings.Fields(line)...)
+	}
+	return specs, scanner.Err()
+}
+
+// ExpandIPRange returns every address from start to end, both included.
+// Both ends must be of the same address family.
+func ExpandIPRange(start, end net.IP) ([]net.IP, error) {
+	if (start.To4() == nil) != (end.To4() == nil) {
+		return nil, fmt.Errorf("IP range %s-%s mixes IPv4 and IPv6", start, end)
+	}
+	start, end = start.To16(), end.To16()
+	if start == nil || end == nil || bytes.Compare(start, end) > 0 {
+		return nil, fmt.Errorf("invalid IP range %s-%s", start, end)
+	}
+	size := new(big.Int).Sub(new(big.Int).SetBytes(end), new(big.Int).SetBytes(start))
+	if size.Cmp(big.NewInt(maxRangeSize)) >= 0 {
+		return nil, fmt.Errorf("IP range %s-%s is too large to scan", start, end)
+	}
+
+	var ips []net.IP
+	for ip := append(net.IP{}, start...); ; IncIP(ip) {
+		ips = append(ips, append(net.IP{}, ip...))
+		if ip.Equal(end) {
+			break
+		}
+	}
+	return ips, nil
+}
+
+func splitSpecs(specs []string) []string {
+	var result []string
+	for _, spec := range specs {
+		for _, part := range strings.Split(spec, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				result = append(result, part)
+			}
+		}
+	}
+	return result
+}
+
+func parseTargetSpec(spec string) (targetSpec, error) {
+	switch {
+	case strings.Contains(spec, "/"):
+		_, ipNet, err := net.ParseCIDR(spec)
+		if err != nil {
+			return targetSpec{}, err
+		}
+		start := ipNet.IP.To16()
+		end := append(net.IP{}, start...)
+		mask := ipNet.Mask
+		offset := len(end) - len(mask)
+		for i := range mask {
+			end[offset+i] |= ^mask[i]
+		}
+		return targetSpec{ips: []ipRange{{start: start, end: end}}}, nil
+	case strings.Contains(spec, "-") && net.ParseIP(strings.SplitN(spec, "-", 2)[0]) != nil:
+		bounds := strings.SplitN(spec, "-", 2)
+		start, end := net.ParseIP(bounds[0]), net.ParseIP(bounds[1])
+		if start == nil || end == nil {
+			return targetSpec{}, fmt.Errorf("invalid IP address range")
+		}
+		if (start.To4() == nil) != (end.To4() == nil) {
+			return targetSpec{}, fmt.Errorf("range mixes IPv4 and IPv6 addresses")
+		}
+		if bytes.Compare(start.To16(), end.To16()) > 0 {
+			return targetSpec{}, fmt.Errorf("range start is after range end")
+		}
+		return targetSpec{ips: []ipRange{{start: start.To16(), end: end.To16()}}}, nil
+	}
+
+	// A port joined to the host would otherwise be looked up as part of a
+	// hostname
+	if _, port, err := net.SplitHostPort(spec); err == nil {
+		return targetSpec{}, fmt.Errorf("unexpected port %s, ports are given apart from targets", port)
+	}
+
+	// Bracketed IPv6 literals are accepted as well, as in URLs
+	if ip := net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(spec, "["), "]")); ip != nil {
+		return targetSpec{ips: []ipRange{{start: ip.To16(), end: ip.To16()}}}, nil
+	}
+
+	// Resolve hostname, both A and AAAA records
+	addrs, err := net.LookupIP(spec)
+	if err != nil {
+		return targetSpec{}, fmt.Errorf("failed to resolve hostname: %w", err)
+	}
+	parsed := targetSpec{hostname: spec}
+	for _, ip := range addrs {
+		parsed.ips = append(parsed.ips, ipRange{start: ip.To16(), end: ip.To16()})
+	}
+	return parsed, nil
+}
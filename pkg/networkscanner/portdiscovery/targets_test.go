@@ -0,0 +1,125 @@
+package portdiscovery
+
+import (
+	"net"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func targetIPs(targets []ScanTarget) []string {
+	var ips []string
+	for _, target := range targets {
+		ips = append(ips, target.IPStart.String())
+	}
+	return ips
+}
+
+func TestParseTargets(t *testing.T) {
+	tests := []struct {
+		name     string
+		specs    []string
+		excludes []string
+		want     []string
+	}{
+		{name: "address", specs: []string{"10.0.0.1"}, want: []string{"10.0.0.1"}},
+		{name: "cidr", specs: []string{"10.0.0.0/30"}, want: []string{"10.0.0.0", "10.0.0.1", "10.0.0.2", "10.0.0.3"}},
+		{name: "host cidr", specs: []string{"10.0.0.7/32"}, want: []string{"10.0.0.7"}},
+		{name: "range", specs: []string{"10.0.0.254-10.0.1.1"}, want: []string{"10.0.0.254", "10.0.0.255", "10.0.1.0", "10.0.1.1"}},
+		{name: "single address range", specs: []string{"10.0.0.1-10.0.0.1"}, want: []string{"10.0.0.1"}},
+		{name: "comma joined", specs: []string{"10.0.0.1, 10.0.0.3,,10.0.0.2"}, want: []string{"10.0.0.1", "10.0.0.3", "10.0.0.2"}},
+		{name: "deduplicated", specs: []string{"10.0.0.1", "10.0.0.0/31"}, want: []string{"10.0.0.1", "10.0.0.0"}},
+		{name: "excluded address", specs: []string{"10.0.0.0/30"}, excludes: []string{"10.0.0.1"}, want: []string{"10.0.0.0", "10.0.0.2", "10.0.0.3"}},
+		{name: "excluded range", specs: []string{"10.0.0.0/30"}, excludes: []string{"10.0.0.1-10.0.0.2"}, want: []string{"10.0.0.0", "10.0.0.3"}},
+		{name: "everything excluded", specs: []string{"10.0.0.0/30"}, excludes: []string{"10.0.0.0/24"}, want: nil},
+		{name: "ipv6", specs: []string{"2001:db8::1"}, want: []string{"2001:db8::1"}},
+		{name: "bracketed ipv6", specs: []string{"[2001:db8::1]"}, want: []string{"2001:db8::1"}},
+		{name: "ipv6 cidr", specs: []string{"2001:db8::/127"}, want: []string{"2001:db8::", "2001:db8::1"}},
+		{name: "ipv6 range", specs: []string{"2001:db8::ffff-2001:db8::1:0"}, want: []string{"2001:db8::ffff", "2001:db8::1:0"}},
+		{name: "ipv6 exclusion", specs: []string{"2001:db8::/126"}, excludes: []string{"2001:db8::2/127"}, want: []string{"2001:db8::", "2001:db8::1"}},
+		{name: "ipv4 exclusion of ipv6", specs: []string{"2001:db8::1"}, excludes: []string{"0.0.0.0/0"}, want: []string{"2001:db8::1"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			targets, err := ParseTargets(test.specs, test.excludes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := targetIPs(targets); !slices.Equal(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+			for _, target := range targets {
+				if target.Hostname != target.IPStart.String() {
+					t.Errorf("hostname %q of address %s", target.Hostname, target.IPStart)
+				}
+			}
+		})
+	}
+}
+
+func TestParseTargetsErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		specs    []string
+		excludes []string
+		err      string
+	}{
+		{name: "ipv4 /0", specs: []string{"0.0.0.0/0"}, err: "too large"},
+		{name: "ipv6 /0", specs: []string{"::/0"}, err: "too large"},
+		{name: "too large cidr", specs: []string{"10.0.0.0/7"}, err: "too large"},
+		{name: "bad prefix length", specs: []string{"10.0.0.0/33"}, err: "invalid target"},
+		{name: "reversed range", specs: []string{"10.0.0.2-10.0.0.1"}, err: "range start is after range end"},
+		{name: "mixed range", specs: []string{"10.0.0.1-2001:db8::1"}, err: "mixes IPv4 and IPv6"},
+		{name: "bad range end", specs: []string{"10.0.0.1-10.0.0"}, err: "invalid IP address range"},
+		{name: "address and port", specs: []string{"10.0.0.1:80"}, err: "unexpected port 80"},
+		{name: "ipv6 and port", specs: []string{"[2001:db8::1]:443"}, err: "unexpected port 443"},
+		{name: "bad exclude", specs: []string{"10.0.0.1"}, excludes: []string{"10.0.0.0/40"}, err: "invalid exclude"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseTargets(test.specs, test.excludes)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("error %v, want one containing %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestExpandIPRange(t *testing.T) {
+	tests := []struct {
+		name       string
+		start, end string
+		count      int
+		err        bool
+	}{
+		{name: "single", start: "10.0.0.1", end: "10.0.0.1", count: 1},
+		{name: "across octets", start: "10.0.0.255", end: "10.0.2.0", count: 258},
+		{name: "last ipv4 address", start: "255.255.255.254", end: "255.255.255.255", count: 2},
+		{name: "ipv6", start: "2001:db8::", end: "2001:db8::ff", count: 256},
+		{name: "reversed", start: "10.0.0.2", end: "10.0.0.1", err: true},
+		{name: "mixed families", start: "10.0.0.1", end: "::1", err: true},
+		// One address more than maxRangeSize
+		{name: "above the bound", start: "10.0.0.0", end: "11.0.0.0", err: true},
+		{name: "ipv6 above the bound", start: "2001:db8::", end: "2001:db8::1:0:0", err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ips, err := ExpandIPRange(net.ParseIP(test.start), net.ParseIP(test.end))
+			if test.err {
+				if err == nil {
+					t.Errorf("expanded to %d addresses, want an error", len(ips))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ips) != test.count {
+				t.Fatalf("%d addresses, want %d", len(ips), test.count)
+			}
+			if first, last := ips[0].String(), ips[len(ips)-1].String(); first != test.start || last != test.end {
+				t.Errorf("expanded to %s-%s, want %s-%s", first, last, test.start, test.end)
+			}
+		})
+	}
+}
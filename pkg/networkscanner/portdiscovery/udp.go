@@ -0,0 +1,137 @@
+package portdiscovery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner"
+)
+
+// Time to wait for a UDP answer when no timeout is configured
+const defaultUDPTimeout = time.Second
+
+// udpPayloads holds a request for well known UDP services that makes the
+// service answer. Ports not listed here get an empty datagram.
+var udpPayloads = map[int][]byte{
+	// DNS: query for the root NS records
+	53: dnsQuery,
+	// TFTP: read request for a file that does not exist, answered with an error
+	69: append([]byte{0x00, 0x01}, []byte("kubescape.txt\x00octet\x00")...),
+	// Portmapper: RPC NULL call to program 100000 version 2
+	111: {
+		0x6b, 0x73, 0x6e, 0x73, // xid
+		0x00, 0x00, 0x00, 0x00, // call
+		0x00, 0x00, 0x00, 0x02, // RPC version 2
+		0x00, 0x01, 0x86, 0xa0, // program 100000
+		0x00, 0x00, 0x00, 0x02, // program version 2
+		0x00, 0x00, 0x00, 0x00, // procedure NULL
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // credentials AUTH_NULL
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // verifier AUTH_NULL
+	},
+	// NTP: version 4 client request
+	123: append([]byte{0xe3}, make([]byte, 47)...),
+	// NetBIOS name service: node status request for the wildcard name
+	137: append(append([]byte{
+		0x6b, 0x73, 0x00, 0x10, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x20,
+	}, []byte("CKAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA")...), 0x00, 0x00, 0x21, 0x00, 0x01),
+	// SNMP: v1 get-request of sysDescr.0 with the "public" community
+	161: snmpGetRequest,
+	// QUIC: long header packet with a reserved version, answered with version negotiation
+	443: quicVersionProbe(),
+	// SSDP: discovery request
+	1900: []byte("M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nMAN: \"ssdp:discover\"\r\nMX: 1\r\nST: ssdp:all\r\n\r\n"),
+	// mDNS: same query as DNS
+	5353: dnsQuery,
+	// CoAP: GET /.well-known/core
+	5683: append([]byte{0x40, 0x01, 0x6b, 0x73, 0xbb}, []byte(".well-known\x04core")...),
+	// Memcached: UDP frame header followed by a version command
+	11211: append([]byte{0x6b, 0x73, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00}, []byte("version\r\n")...),
+}
+
+var dnsQuery = []byte{
+	0x6b, 0x73, // transaction ID
+	0x01, 0x00, // standard query, recursion desired
+	0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // one question
+	0x00,       // root name
+	0x00, 0x02, // type NS
+	0x00, 0x01, // class IN
+}
+
+var snmpGetRequest = []byte{
+	0x30, 0x29, // message
+	0x02, 0x01, 0x00, // version 1
+	0x04, 0x06, 'p', 'u', 'b', 'l', 'i', 'c', // community
+	0xa0, 0x1c, // get-request
+	0x02, 0x04, 0x6b, 0x73, 0x6e, 0x73, // request ID
+	0x02, 0x01, 0x00, // error status
+	0x02, 0x01, 0x00, // error index
+	0x30, 0x0e, // variable bindings
+	0x30, 0x0c, // variable binding
+	0x06, 0x08, 0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x01, 0x00, // 1.3.6.1.2.1.1.1.0
+	0x05, 0x00, // null value
+}
+
+// quicVersionProbe builds a QUIC long header packet padded to the minimal
+// initial packet size, so servers do not drop it
+func quicVersionProbe() []byte {
+	packet := []byte{
+		0xc0,                   // long header
+		0x1a, 0x2a, 0x3a, 0x4a, // reserved version
+		0x08, 0x6b, 0x73, 0x6e, 0x73, 0x6b, 0x73, 0x6e, 0x73, // destination connection ID
+		0x00, // no source connection ID
+	}
+	return append(packet, make([]byte, 1200-len(packet))...)
+}
+
+// udpPortState sends the payload known for the port, or an empty datagram,
+// and classifies the port by what comes back: any answer means open, an ICMP
+// port unreachable means closed and silence means open|filtered. Datagrams
+// get lost, so a silent port is probed again up to retries times. The round
+// trip time is returned when the target answered.
+func udpPortState(ctx context.Context, ip string, port int, timeout time.Duration, retries int) (string, time.Duration) {
+	if timeout <= 0 {
+		timeout = defaultUDPTimeout
+	}
+
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "udp", net.JoinHostPort(ip, strconv.Itoa(port)))
+	if err != nil {
+		return networkscanner.PORT_STATE_CLOSED, 0
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	buf := make([]byte, 1500)
+	for attempt := 0; attempt <= retries; attempt++ {
+		start := time.Now()
+		conn.SetDeadline(start.Add(timeout))
+
+		// An ICMP error of an earlier datagram can already fail the write
+		if _, err := conn.Write(udpPayloads[port]); err != nil {
+			if errors.Is(err, syscall.ECONNREFUSED) {
+				return networkscanner.PORT_STATE_CLOSED, time.Since(start)
+			}
+			return networkscanner.PORT_STATE_OPEN_FILTERED, 0
+		}
+
+		_, err = conn.Read(buf)
+		switch {
+		case err == nil:
+			return networkscanner.PORT_STATE_OPEN, time.Since(start)
+		case ctx.Err() != nil:
+			// A cancelled scan does not report ports it could not finish
+			return networkscanner.PORT_STATE_CLOSED, 0
+		case errors.Is(err, syscall.ECONNREFUSED):
+			return networkscanner.PORT_STATE_CLOSED, time.Since(start)
+		}
+	}
+	return networkscanner.PORT_STATE_OPEN_FILTERED, 0
+}
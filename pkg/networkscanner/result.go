@@ -0,0 +1,425 @@
+package networkscanner
+
+import (
+	"bytes"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+////////////////////////////////////////////////////////////////////////////////////////
+// Versioned result schema, published as schema/scan-result.schema.json
+////////////////////////////////////////////////////////////////////////////////////////
+
+// Version of the result schema. The major version changes when fields are
+// removed or change meaning, the minor version when fields are added.
+const RESULT_SCHEMA_VERSION = "1.0"
+
+// Struct defining the JSON document written by a scan
+type ScanReport struct {
+	SchemaVersion string          `json:"schemaVersion"`
+	Results       []ServiceResult `json:"results"`
+	// Errors not tied to a single port, such as an interrupted scan
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Struct defining what was found on a single open port
+type ServiceResult struct {
+	Host              string                 `json:"host"`
+	IP                string                 `json:"ip"`
+	Port              int                    `json:"port"`
+	Transport         string                 `json:"transport"` // tcp or udp
+	State             string                 `json:"state"`     // open or open_filtered
+	Status            string                 `json:"status"`    // identified, unidentified or error
+	SessionLayer      string                 `json:"sessionLayer,omitempty"`
+	PresentationLayer string                 `json:"presentationLayer,omitempty"`
+	ApplicationLayer  string                 `json:"applicationLayer,omitempty"`
+	Authentication    *AuthenticationResult  `json:"authentication,omitempty"`
+	TLS               *TLSDetails            `json:"tls,omitempty"`
+	StartTLS          *StartTLSDetails       `json:"startTls,omitempty"`
+	SSH               *SSHDetails            `json:"ssh,omitempty"`
+	HTTP              *HTTPDetails           `json:"http,omitempty"`
+	HTTP2             *HTTP2Details          `json:"http2,omitempty"`
+	WebSocket         *WebSocketDetails      `json:"webSocket,omitempty"`
+	Product           *ProductDetails        `json:"product,omitempty"`
+	Matches           []MatchResult          `json:"matches,omitempty"`
+	Timings           Timings                `json:"timings"`
+	Probes            []ProbeResult          `json:"probes,omitempty"`
+	Properties        map[string]interface{} `json:"properties,omitempty"` // Probe specific details
+	Errors            []string               `json:"errors,omitempty"`
+}
+
+type AuthenticationResult struct {
+	Status string `json:"status"` // Lower case AUTHENTICATION_STATUS_* value
+	Reason string `json:"reason,omitempty"`
+}
+
+// Struct defining a ServiceMatch in reports
+type MatchResult struct {
+	Service        string                 `json:"service"`
+	Confidence     int                    `json:"confidence"` // From 0 to 100
+	Authentication AuthenticationResult   `json:"authentication"`
+	Evidence       []string               `json:"evidence"`
+	Properties     map[string]interface{} `json:"properties,omitempty"`
+}
+
+// Struct defining the TLS session negotiated with a port
+type TLSDetails struct {
+	Version      string               `json:"version"`
+	CipherSuite  string               `json:"cipherSuite"`
+	ALPN         string               `json:"alpn,omitempty"`
+	ServerName   string               `json:"serverName,omitempty"`   // SNI sent by the scanner
+	Certificates []CertificateDetails `json:"certificates,omitempty"` // Leaf certificate first
+	// Whether the chain leads to the CA bundle, the cluster CA or the
+	// system roots, and which of them
+	Trusted           bool   `json:"trusted"`
+	TrustedBy         string `json:"trustedBy,omitempty"`
+	VerificationError string `json:"verificationError,omitempty"`
+	// A certificate of the chain is outside of its validity period
+	Expired bool `json:"expired"`
+	// The leaf certificate is signed by its own key
+	SelfSigned bool `json:"selfSigned"`
+	// The leaf certificate is not valid for the server name or address
+	HostnameMismatch bool `json:"hostnameMismatch"`
+	// A certificate of the chain has an RSA key below 2048 bits, an ECDSA
+	// key below 256 bits or a DSA key
+	WeakKey bool `json:"weakKey"`
+	// Client certificate asked for by the server, nil if it did not ask
+	ClientCertificateRequest *TLSClientCertificateRequest `json:"clientCertificateRequest,omitempty"`
+	// Versions and cipher suites accepted by the server, if enumerated
+	Enumeration *TLSEnumeration `json:"enumeration,omitempty"`
+}
+
+// Struct defining the client certificate request of a TLS server
+type TLSClientCertificateRequest struct {
+	// Whether the handshake is refused without a client certificate, nil if
+	// the server failed it in a way that does not tell
+	MTLSRequired  *bool    `json:"mtlsRequired,omitempty"`
+	AcceptableCAs []string `json:"acceptableCAs,omitempty"`
+	// Whether the client certificate given to the scanner was accepted, nil
+	// if none was given
+	ClientCertificateAccepted *bool `json:"clientCertificateAccepted,omitempty"`
+}
+
+// Struct defining the TLS versions and cipher suites a port accepts
+type TLSEnumeration struct {
+	Versions               []string            `json:"versions"`     // Oldest first
+	CipherSuites           map[string][]string `json:"cipherSuites"` // By version
+	ServerCipherPreference bool                `json:"serverCipherPreference"`
+	WeakCipherSuites       []string            `json:"weakCipherSuites,omitempty"`
+	Grade                  string              `json:"grade"` // A, B, C or F
+	GradeReasons           []string            `json:"gradeReasons,omitempty"`
+}
+
+type CertificateDetails struct {
+	Subject            string    `json:"subject"`
+	Issuer             string    `json:"issuer"`
+	SerialNumber       string    `json:"serialNumber"`
+	DNSNames           []string  `json:"dnsNames,omitempty"`
+	IPAddresses        []string  `json:"ipAddresses,omitempty"`
+	NotBefore          time.Time `json:"notBefore"`
+	NotAfter           time.Time `json:"notAfter"`
+	SignatureAlgorithm string    `json:"signatureAlgorithm"`
+	PublicKeyAlgorithm string    `json:"publicKeyAlgorithm"`
+	KeySize            int       `json:"keySize,omitempty"` // In bits
+	SHA256Fingerprint  string    `json:"sha256Fingerprint"`
+}
+
+// Struct defining whether an application protocol upgrades to TLS in-band
+type StartTLSDetails struct {
+	Offered bool `json:"offered"`
+	// Only known for some protocols, false when unknown
+	Required bool `json:"required"`
+}
+
+// Struct defining what an HTTP server answered to GET /
+type HTTPDetails struct {
+	Version    string              `json:"version"`
+	StatusCode int                 `json:"statusCode"`
+	Headers    map[string][]string `json:"headers"`
+	Server     string              `json:"server,omitempty"`
+	PoweredBy  string              `json:"poweredBy,omitempty"`
+	Cookies    []HTTPCookie        `json:"cookies,omitempty"`
+	// Locations redirected to, in order. Redirects within the server are
+	// followed, and the title and body hash are those of the last page.
+	Redirects   []string `json:"redirects,omitempty"`
+	AuthSchemes []string `json:"authSchemes,omitempty"` // Of the WWW-Authenticate challenges
+	Title       string   `json:"title,omitempty"`
+	BodyHash    string   `json:"bodyHash,omitempty"` // Hex SHA-256
+	BodyLength  int      `json:"bodyLength"`
+	// Shodan compatible MurmurHash3 of /favicon.ico
+	FaviconHash *int32             `json:"faviconHash,omitempty"`
+	Paths       []HTTPPathResponse `json:"paths,omitempty"`
+}
+
+// Struct defining a cookie set by an HTTP server, without its value
+type HTTPCookie struct {
+	Name     string `json:"name"`
+	Secure   bool   `json:"secure"`
+	HttpOnly bool   `json:"httpOnly"`
+	SameSite string `json:"sameSite,omitempty"`
+}
+
+// Struct defining what an HTTP server answered for one of the requested
+// paths
+type HTTPPathResponse struct {
+	Path       string `json:"path"`
+	StatusCode int    `json:"statusCode,omitempty"`
+	Title      string `json:"title,omitempty"`
+	BodyHash   string `json:"bodyHash,omitempty"`
+	BodyLength int    `json:"bodyLength"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Struct defining an HTTP/2 connection and the answer to GET / over it
+type HTTP2Details struct {
+	Mode string `json:"mode"` // h2, h2c-prior-knowledge or h2c-upgrade
+	// Settings the server sent in its SETTINGS frame, by name such as
+	// MAX_CONCURRENT_STREAMS
+	Settings    map[string]uint32 `json:"settings"`
+	StatusCode  int               `json:"statusCode,omitempty"`
+	Server      string            `json:"server,omitempty"`
+	ContentType string            `json:"contentType,omitempty"`
+}
+
+// Struct defining the paths of an HTTP server that accept WebSocket upgrades
+type WebSocketDetails struct {
+	Endpoints []WebSocketEndpoint `json:"endpoints"`
+}
+
+// Struct defining a path that upgraded to WebSocket, or refused to for lack
+// of credentials
+type WebSocketEndpoint struct {
+	Path       string `json:"path"`
+	StatusCode int    `json:"statusCode"` // 101 when upgraded
+	Upgraded   bool   `json:"upgraded"`
+	// Subprotocols the server selected among those offered by the scanner
+	Subprotocols        []string `json:"subprotocols,omitempty"`
+	CredentialsRequired bool     `json:"credentialsRequired"`
+}
+
+// Struct defining what an SSH server tells before authentication
+type SSHDetails struct {
+	ProtocolVersion        string   `json:"protocolVersion"`
+	Software               string   `json:"software"`
+	SoftwareVersion        string   `json:"softwareVersion,omitempty"`
+	Comments               string   `json:"comments,omitempty"`
+	KexAlgorithms          []string `json:"kexAlgorithms"`
+	HostKeyAlgorithms      []string `json:"hostKeyAlgorithms"`
+	Ciphers                []string `json:"ciphers"`
+	MACs                   []string `json:"macs"`
+	Compressions           []string `json:"compressions"`
+	WeakAlgorithms         []string `json:"weakAlgorithms,omitempty"`
+	HostKeyType            string   `json:"hostKeyType,omitempty"`
+	HostKeyFingerprint     string   `json:"hostKeyFingerprint,omitempty"` // SHA256:..., as printed by ssh-keygen
+	AuthMethods            []string `json:"authMethods,omitempty"`
+	PasswordAuthentication bool     `json:"passwordAuthentication"`
+	NoneAuthentication     bool     `json:"noneAuthentication"` // Logged in without credentials
+}
+
+type ProductDetails struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// Struct defining a discovery probe run on a port
+type ProbeResult struct {
+	Layer      string  `json:"layer"` // session, presentation or application
+	Name       string  `json:"name"`
+	DurationMs float64 `json:"durationMs"`
+	Detected   bool    `json:"detected"`
+	TimedOut   bool    `json:"timedOut"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// Durations in milliseconds
+type Timings struct {
+	RoundTripMs float64 `json:"roundTripMs,omitempty"` // Smoothed round trip time of the port scan
+	DiscoveryMs float64 `json:"discoveryMs"`           // Service discovery on the port
+}
+
+// NewScanReport converts per-port scan results into the versioned report
+func NewScanReport(results []ScanResult, errs []error) ScanReport {
+	report := ScanReport{
+		SchemaVersion: RESULT_SCHEMA_VERSION,
+		Results:       []ServiceResult{},
+	}
+	for _, result := range results {
+		report.Results = append(report.Results, NewServiceResult(result))
+	}
+	for _, err := range errs {
+		report.Errors = append(report.Errors, err.Error())
+	}
+	return report
+}
+
+// NewServiceResult converts the result of a single port, as returned by
+// NetworkScanner.Scan, into its schema form
+func NewServiceResult(result ScanResult) ServiceResult {
+	serviceResult := ServiceResult{
+		Host:              result.Host,
+		IP:                result.IP.String(),
+		SessionLayer:      result.SessionLayer,
+		PresentationLayer: result.PresentationLayer,
+		ApplicationLayer:  result.ApplicationLayer,
+		TLS:               result.TLS,
+		StartTLS:          result.StartTLS,
+		SSH:               result.SSH,
+		HTTP:              result.HTTP,
+		HTTP2:             result.HTTP2,
+		WebSocket:         result.WebSocket,
+		Timings: Timings{
+			RoundTripMs: milliseconds(result.RoundTripTime),
+			DiscoveryMs: milliseconds(result.DiscoveryDuration),
+		},
+		Status:     strings.ToLower(result.Status),
+		Properties: result.Properties,
+		Errors:     result.Errors,
+	}
+
+	switch {
+	case len(result.UDPPorts) > 0:
+		serviceResult.Port = result.UDPPorts[0]
+		serviceResult.Transport = "udp"
+		serviceResult.State = strings.ToLower(result.UDPPortStates[serviceResult.Port])
+	case len(result.TCPPorts) > 0:
+		serviceResult.Port = result.TCPPorts[0]
+		serviceResult.Transport = "tcp"
+		serviceResult.State = strings.ToLower(PORT_STATE_OPEN)
+	}
+
+	if result.Authenticated != "" {
+		serviceResult.Authentication = &AuthenticationResult{
+			Status: strings.ToLower(result.Authenticated),
+			Reason: result.AuthenticationReason,
+		}
+	}
+
+	for _, match := range result.Matches {
+		serviceResult.Matches = append(serviceResult.Matches, MatchResult{
+			Service:    match.Service,
+			Confidence: match.Confidence,
+			Authentication: AuthenticationResult{
+				Status: strings.ToLower(match.Authenticated),
+				Reason: match.AuthenticationReason,
+			},
+			Evidence:   match.Evidence,
+			Properties: match.Properties,
+		})
+	}
+
+	for _, probe := range result.Probes {
+		serviceResult.Probes = append(serviceResult.Probes, ProbeResult{
+			Layer:      strings.ToLower(probe.Layer),
+			Name:       probe.Name,
+			DurationMs: milliseconds(probe.Duration),
+			Detected:   probe.Detected,
+			TimedOut:   probe.TimedOut,
+			Error:      probe.Error,
+		})
+	}
+
+	switch {
+	case result.ApplicationLayer != "":
+		serviceResult.Product = &ProductDetails{Name: result.ApplicationLayer}
+		if version, ok := result.Properties["version"].(string); ok {
+			serviceResult.Product.Version = version
+		}
+	case result.SSH != nil:
+		serviceResult.Product = &ProductDetails{Name: result.SSH.Software, Version: result.SSH.SoftwareVersion}
+	}
+
+	return serviceResult
+}
+
+// NewTLSDetails describes a negotiated TLS connection. The verification
+// of the chain against trust anchors and the server name is left to the
+// caller.
+func NewTLSDetails(state tls.ConnectionState) *TLSDetails {
+	details := &TLSDetails{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ALPN:        state.NegotiatedProtocol,
+		ServerName:  state.ServerName,
+	}
+	now := time.Now()
+	for _, certificate := range state.PeerCertificates {
+		certificateDetails := NewCertificateDetails(certificate)
+		details.Certificates = append(details.Certificates, certificateDetails)
+		if now.Before(certificate.NotBefore) || now.After(certificate.NotAfter) {
+			details.Expired = true
+		}
+		if isWeakKey(certificate.PublicKeyAlgorithm, certificateDetails.KeySize) {
+			details.WeakKey = true
+		}
+	}
+	if len(state.PeerCertificates) > 0 {
+		leaf := state.PeerCertificates[0]
+		details.SelfSigned = bytes.Equal(leaf.RawIssuer, leaf.RawSubject) && leaf.CheckSignatureFrom(leaf) == nil
+	}
+	return details
+}
+
+func NewCertificateDetails(certificate *x509.Certificate) CertificateDetails {
+	details := CertificateDetails{
+		Subject:            certificate.Subject.String(),
+		Issuer:             certificate.Issuer.String(),
+		SerialNumber:       certificate.SerialNumber.String(),
+		DNSNames:           certificate.DNSNames,
+		NotBefore:          certificate.NotBefore.UTC(),
+		NotAfter:           certificate.NotAfter.UTC(),
+		SignatureAlgorithm: certificate.SignatureAlgorithm.String(),
+		PublicKeyAlgorithm: certificate.PublicKeyAlgorithm.String(),
+		KeySize:            keySize(certificate.PublicKey),
+		SHA256Fingerprint:  fingerprint(certificate),
+	}
+	for _, ip := range certificate.IPAddresses {
+		details.IPAddresses = append(details.IPAddresses, ip.String())
+	}
+	return details
+}
+
+// keySize returns the size of a public key in bits, 0 if unknown
+func keySize(publicKey any) int {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return key.N.BitLen()
+	case *ecdsa.PublicKey:
+		return key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return 256
+	case *dsa.PublicKey:
+		return key.P.BitLen()
+	}
+	return 0
+}
+
+func isWeakKey(algorithm x509.PublicKeyAlgorithm, size int) bool {
+	switch algorithm {
+	case x509.RSA:
+		return size < 2048
+	case x509.ECDSA:
+		return size < 256
+	case x509.DSA:
+		return true
+	}
+	return false
+}
+
+func fingerprint(certificate *x509.Certificate) string {
+	sum := sha256.Sum256(certificate.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func milliseconds(d time.Duration) float64 {
+	ms := float64(d) / float64(time.Millisecond)
+	// Keep microsecond precision in the output
+	return float64(int64(ms*1000)) / 1000
+}
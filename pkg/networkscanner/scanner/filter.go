@@ -0,0 +1,88 @@
+package scanner
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery/applicationlayerdiscovery"
+)
+
+// ServiceFilter selects the application layer probes that run, by their
+// Protocol() name. Names are compared ignoring case, spaces and punctuation,
+// so "kubernetes-api-server" selects the "Kubernetes API server" probe. The
+// zero value runs every probe.
+type ServiceFilter struct {
+	// Only these probes run if not empty
+	Include []string
+	// These probes never run
+	Exclude []string
+}
+
+// NewServiceFilter returns a filter for the given names and fails on names
+// that no application probe has
+func NewServiceFilter(include, exclude []string) (ServiceFilter, error) {
+	known := map[string]bool{}
+	for _, item := range applicationlayerdiscovery.ApplicationDiscoveryList {
+		known[normalizeServiceName(item.Discovery.Protocol())] = true
+	}
+	for _, name := range append(append([]string{}, include...), exclude...) {
+		if !known[normalizeServiceName(name)] {
+			return ServiceFilter{}, fmt.Errorf("unknown service %q, known services are: %s", name, strings.Join(ServiceNames(), ", "))
+		}
+	}
+	return ServiceFilter{Include: include, Exclude: exclude}, nil
+}
+
+// ServiceNames returns the Protocol() names of all application probes
+func ServiceNames() []string {
+	var names []string
+	for _, item := range applicationlayerdiscovery.ApplicationDiscoveryList {
+		names = append(names, item.Discovery.Protocol())
+	}
+	return names
+}
+
+// Allows reports whether the probe with the given protocol name may run
+func (f ServiceFilter) Allows(protocol string) bool {
+	protocol = normalizeServiceName(protocol)
+	for _, name := range f.Exclude {
+		if normalizeServiceName(name) == protocol {
+			return false
+		}
+	}
+	if len(f.Include) == 0 {
+		return true
+	}
+	for _, name := range f.Include {
+		if normalizeServiceName(name) == protocol {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeServiceName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
+
+// hintedFilter narrows filter to the application probes over transport that
+// list port in their CommonPorts. ok is false when filter allows none of
+// them.
+func hintedFilter(filter ServiceFilter, port int, transport servicediscovery.TransportProtocol) (hinted ServiceFilter, ok bool) {
+	hinted.Exclude = filter.Exclude
+	for _, item := range applicationlayerdiscovery.ApplicationDiscoveryList {
+		protocol := item.Discovery.Protocol()
+		if item.Reqirement == string(transport) && slices.Contains(item.CommonPorts, port) && filter.Allows(protocol) {
+			hinted.Include = append(hinted.Include, protocol)
+		}
+	}
+	return hinted, len(hinted.Include) > 0
+}
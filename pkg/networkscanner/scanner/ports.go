@@ -0,0 +1,25 @@
+package scanner
+
+import (
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/portdiscovery"
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery/applicationlayerdiscovery"
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery/presentationlayerdiscovery"
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery/sessionlayerdiscovery"
+)
+
+// CommonPorts returns the ports on which the services of every discovery
+// registry usually listen, sorted. A protocol added to any of the lists with
+// its CommonPorts is picked up here.
+func CommonPorts() []int {
+	var lists [][]int
+	for _, item := range sessionlayerdiscovery.SessionDiscoveryList {
+		lists = append(lists, item.CommonPorts)
+	}
+	for _, item := range presentationlayerdiscovery.PresentationDiscoveryList {
+		lists = append(lists, item.CommonPorts)
+	}
+	for _, item := range applicationlayerdiscovery.ApplicationDiscoveryList {
+		lists = append(lists, item.CommonPorts)
+	}
+	return portdiscovery.MergePorts(lists...)
+}
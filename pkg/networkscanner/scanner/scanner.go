@@ -0,0 +1,474 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner"
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/portdiscovery"
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
+)
+
+const maxPort = 65535
+
+// Scanner is the library implementation of networkscanner.NetworkScanner.
+// It runs port discovery on the described targets and then layered service
+// discovery on every open port it finds.
+type Scanner struct {
+	// Timeouts and retries of port and service discovery. The connect
+	// timeout is also the timeout of a single port probe.
+	Timing servicediscovery.Timing
+	// Application layer probes to run, all of them by default
+	Services ServiceFilter
+	// Trust anchors of TLS certificate verification, client certificate,
+	// and the opt-in TLS enumeration and STARTTLS login checks. The server
+	// name is set per target, from its hostname.
+	TLS servicediscovery.TlsOptions
+	// Paths requested from HTTP servers besides the root page and favicon
+	HTTP servicediscovery.HttpOptions
+	// Concurrency over all targets and per target, and probes per second,
+	// of the port scan and of service discovery, which take a worker per
+	// probe. Zero values use the portdiscovery defaults.
+	Workers     int
+	HostWorkers int
+	Rate        int
+	// Called by ScanContext with the open ports of every target once port
+	// discovery is over, before service discovery starts
+	PortsDiscovered func([]networkscanner.ScanResult)
+}
+
+var _ networkscanner.NetworkScanner = &Scanner{}
+
+func NewScanner() *Scanner {
+	return &Scanner{
+		Timing: servicediscovery.DefaultTiming(),
+		TLS:    servicediscovery.TlsOptions{ClusterCA: servicediscovery.LoadClusterCA()},
+	}
+}
+
+// Scan implements networkscanner.NetworkScanner. One ScanResult is returned
+// per open port, with either TCPPorts or UDPPorts holding that single port.
+func (s *Scanner) Scan(target networkscanner.TargetDescription) ([]networkscanner.ScanResult, error) {
+	return s.ScanContext(context.Background(), target)
+}
+
+// ScanContext is Scan with a context. Cancelling the context or reaching its
+// deadline stops all port and service discovery; the results gathered so far
+// are returned together with the context error.
+func (s *Scanner) ScanContext(ctx context.Context, target networkscanner.TargetDescription) ([]networkscanner.ScanResult, error) {
+	targets, err := ExpandTargets(target)
+	if err != nil {
+		return nil, err
+	}
+	ports, err := ExpandPorts(target)
+	if err != nil {
+		return nil, err
+	}
+
+	tcpOnly := target.TcpPorts && !target.UdpPorts
+	udpOnly := target.UdpPorts && !target.TcpPorts
+	// Both phases share the workers, so service discovery is held to the
+	// same limits as the port scan
+	pool := s.newWorkerPool()
+	defer pool.Stop()
+	portResults, err := s.discoverPorts(ctx, pool, targets, ports, tcpOnly, udpOnly)
+	if s.PortsDiscovered != nil {
+		s.PortsDiscovered(portResults)
+	}
+	results, discoveryErr := s.discoverServices(ctx, pool, portResults)
+	if err != nil {
+		return results, err
+	}
+	return results, discoveryErr
+}
+
+func (s *Scanner) newWorkerPool() *portdiscovery.WorkerPool {
+	return portdiscovery.NewWorkerPool(s.Workers, s.HostWorkers, s.Rate)
+}
+
+// DiscoverPorts returns one result per target with the open TCP and UDP ports.
+// An empty port list scans all ports.
+func (s *Scanner) DiscoverPorts(ctx context.Context, targets []portdiscovery.ScanTarget, ports []int, tcpOnly bool, udpOnly bool) ([]networkscanner.ScanResult, error) {
+	pool := s.newWorkerPool()
+	defer pool.Stop()
+	return s.discoverPorts(ctx, pool, targets, ports, tcpOnly, udpOnly)
+}
+
+func (s *Scanner) discoverPorts(ctx context.Context, pool *portdiscovery.WorkerPool, targets []portdiscovery.ScanTarget, ports []int, tcpOnly bool, udpOnly bool) ([]networkscanner.ScanResult, error) {
+	timing := s.Timing.WithDefaults()
+	config := portdiscovery.ScanConfig{
+		Targets:       targets,
+		Ports:         ports,
+		Timeout:       timing.ConnectTimeout,
+		TcpOnly:       tcpOnly,
+		UdpOnly:       udpOnly,
+		Retries:       timing.Retries,
+		Adaptive:      timing.Adaptive,
+		TargetTimeout: timing.TargetTimeout,
+		Pool:          pool,
+	}
+	return portdiscovery.ScanTargets(ctx, config), ctx.Err()
+}
+
+// DiscoverServices runs service discovery on every open port of the given
+// port discovery results and returns one result per port, with the
+// DISCOVERY_STATUS_* of the port and the probes that ran on it. Ports are
+// discovered concurrently and returned target by target in port order.
+// Every probe, and so every connection, takes a worker within the Workers
+// and HostWorkers limits and the Rate of the scanner.
+// Ports on which discovery failed keep the error in their result, and the
+// errors are also joined in the returned error.
+// If ctx is done, the partial results of the ports being discovered are kept
+// and the ports left are returned with the error status.
+// A target that runs out of its target timeout is reported as an error and
+// discovery goes on with the other targets.
+// UDP ports that never answered the port scan, which may well be filtered,
+// only get the application probes that list the port in their CommonPorts.
+func (s *Scanner) DiscoverServices(ctx context.Context, portResults []networkscanner.ScanResult) ([]networkscanner.ScanResult, error) {
+	pool := s.newWorkerPool()
+	defer pool.Stop()
+	return s.discoverServices(ctx, pool, portResults)
+}
+
+func (s *Scanner) discoverServices(ctx context.Context, pool *portdiscovery.WorkerPool, portResults []networkscanner.ScanResult) ([]networkscanner.ScanResult, error) {
+	targets := make([]*targetDiscovery, len(portResults))
+	for i, target := range portResults {
+		targets[i] = s.newTargetDiscovery(ctx, target)
+		defer targets[i].done()
+	}
+
+	// Ports are handed out round robin over the targets, so that the
+	// ports waiting for the workers of a busy target do not hold up the
+	// others
+	type portJob struct {
+		target *targetDiscovery
+		index  int
+	}
+	jobs := make(chan portJob)
+	go func() {
+		defer close(jobs)
+		for index := 0; ; index++ {
+			left := false
+			for _, target := range targets {
+				if index >= len(target.ports) {
+					continue
+				}
+				left = true
+				// Once ctx is done, the workers report the ports left as
+				// interrupted
+				jobs <- portJob{target: target, index: index}
+			}
+			if !left {
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < pool.Size(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				target := job.target
+				// The probes of the port take their workers from the pool
+				targetCtx := contextWithProbeWorkers(target.context(), pool, target.host)
+				target.discover(targetCtx, job.index)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var results []networkscanner.ScanResult
+	var errs []error
+	for _, target := range targets {
+		results = append(results, target.results...)
+		for _, err := range target.errs {
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if target.ctx != nil && target.ctx.Err() != nil && ctx.Err() == nil {
+			errs = append(errs, fmt.Errorf("%s: target timeout of %s exceeded", target.host, target.timing.TargetTimeout))
+		}
+	}
+	if ctx.Err() != nil {
+		return results, ctx.Err()
+	}
+
+	return results, errors.Join(errs...)
+}
+
+// targetDiscovery is the service discovery of the open ports of a single
+// target, shared by the workers discovering them
+type targetDiscovery struct {
+	target networkscanner.ScanResult
+	// Timeouts adapted to the round trip time of the target
+	timing servicediscovery.Timing
+	filter ServiceFilter
+	// Discovery connects to the address found open rather than the
+	// hostname, which may resolve to several addresses
+	host string
+	// Context of the scan and the context of the target, with its timing,
+	// TLS and HTTP options and the target timeout counted from the first
+	// port discovered
+	scanCtx context.Context
+	once    sync.Once
+	ctx     context.Context
+	cancel  context.CancelFunc
+	// Open ports, TCP ones first, with the result and the error of each.
+	// Every port is discovered by a single worker.
+	ports   []targetPort
+	results []networkscanner.ScanResult
+	errs    []error
+}
+
+type targetPort struct {
+	port      int
+	transport servicediscovery.TransportProtocol
+}
+
+func (s *Scanner) newTargetDiscovery(ctx context.Context, target networkscanner.ScanResult) *targetDiscovery {
+	discovery := &targetDiscovery{
+		target: target,
+		timing: s.Timing.WithDefaults().Adapt(target.RoundTripTime),
+		filter: s.Services,
+		host:   target.IP.String(),
+	}
+	for _, port := range target.TCPPorts {
+		discovery.ports = append(discovery.ports, targetPort{port: port, transport: servicediscovery.TCP})
+	}
+	for _, port := range target.UDPPorts {
+		discovery.ports = append(discovery.ports, targetPort{port: port, transport: servicediscovery.UDP})
+	}
+	discovery.results = make([]networkscanner.ScanResult, len(discovery.ports))
+	discovery.errs = make([]error, len(discovery.ports))
+
+	targetCtx := servicediscovery.ContextWithTiming(ctx, discovery.timing)
+	tlsOptions := s.TLS
+	if net.ParseIP(target.Host) == nil {
+		tlsOptions.ServerName = target.Host
+	}
+	targetCtx = servicediscovery.ContextWithTlsOptions(targetCtx, tlsOptions)
+	discovery.scanCtx = servicediscovery.ContextWithHttpOptions(targetCtx, s.HTTP)
+	return discovery
+}
+
+// context returns the context of the discovery of the target. With a target
+// timeout it expires that long after the first port started.
+func (t *targetDiscovery) context() context.Context {
+	t.once.Do(func() {
+		t.ctx, t.cancel = t.scanCtx, func() {}
+		if t.timing.TargetTimeout > 0 {
+			t.ctx, t.cancel = context.WithTimeout(t.scanCtx, t.timing.TargetTimeout)
+		}
+	})
+	return t.ctx
+}
+
+func (t *targetDiscovery) done() {
+	if t.cancel != nil {
+		t.cancel()
+	}
+}
+
+// discover runs service discovery on the port at index and stores its
+// result, or an interrupted result if targetCtx is already done
+func (t *targetDiscovery) discover(targetCtx context.Context, index int) {
+	port, transport := t.ports[index].port, t.ports[index].transport
+	filter := t.filter
+	probe := true
+	if transport == servicediscovery.UDP && t.target.UDPPortStates[port] == networkscanner.PORT_STATE_OPEN_FILTERED {
+		// Nothing tells such ports apart from filtered ones, they only get
+		// the probes meant for them
+		filter, probe = hintedFilter(filter, port, transport)
+	}
+
+	// Why discovery of a port was cut short or skipped
+	interruption := func() string {
+		if ctx := t.scanCtx; ctx.Err() != nil {
+			return fmt.Sprintf("service discovery interrupted: %s", ctx.Err())
+		}
+		return fmt.Sprintf("target timeout of %s exceeded", t.timing.TargetTimeout)
+	}
+
+	var result networkscanner.ScanResult
+	switch {
+	case targetCtx.Err() != nil:
+		// Kept so that the port is not mistaken for a closed one
+		result = newScanResult(t.target, DiscoveryResult{})
+		result.Errors = append(result.Errors, interruption())
+	case !probe:
+		result = newScanResult(t.target, DiscoveryResult{})
+	default:
+		start := time.Now()
+		discoveryResult, err := DiscoverService(targetCtx, t.host, port, transport, filter)
+		result = newScanResult(t.target, discoveryResult)
+		result.DiscoveryDuration = time.Since(start)
+		switch {
+		case targetCtx.Err() != nil:
+			result.Errors = append(result.Errors, interruption())
+		case err != nil:
+			t.errs[index] = fmt.Errorf("%s: %w", net.JoinHostPort(t.host, strconv.Itoa(port)), err)
+			result.Errors = append(result.Errors, err.Error())
+		}
+	}
+	result.Status = discoveryStatus(result)
+	if transport == servicediscovery.UDP {
+		result.UDPPorts = []int{port}
+		result.UDPPortStates = map[int]string{port: t.target.UDPPortStates[port]}
+	} else {
+		result.TCPPorts = []int{port}
+	}
+	t.results[index] = result
+}
+
+func newScanResult(target networkscanner.ScanResult, discoveryResult DiscoveryResult) networkscanner.ScanResult {
+	result := networkscanner.ScanResult{
+		Host:              target.Host,
+		IP:                target.IP,
+		Service:           discoveryResult.ApplicationLayer,
+		SecureProtocol:    discoveryResult.SessionLayer == string(servicediscovery.TLS) || discoveryResult.SessionLayer == string(servicediscovery.STARTTLS),
+		SessionLayer:      discoveryResult.SessionLayer,
+		PresentationLayer: discoveryResult.PresentationLayer,
+		ApplicationLayer:  discoveryResult.ApplicationLayer,
+		Properties:        discoveryResult.Properties,
+		RoundTripTime:     target.RoundTripTime,
+		Matches:           discoveryResult.Matches,
+		TLS:               discoveryResult.TLS,
+		StartTLS:          discoveryResult.StartTLS,
+		SSH:               discoveryResult.SSH,
+		HTTP:              discoveryResult.HTTP,
+		HTTP2:             discoveryResult.HTTP2,
+		WebSocket:         discoveryResult.WebSocket,
+		Probes:            discoveryResult.Probes,
+	}
+	if discoveryResult.ApplicationLayer != "" || discoveryResult.SSH != nil || mtlsRefused(discoveryResult.TLS) {
+		result.Authenticated = authenticationStatus(discoveryResult.Authentication)
+		result.AuthenticationReason = discoveryResult.Authentication.Reason
+	}
+	return result
+}
+
+// discoveryStatus returns the DISCOVERY_STATUS_* of a port. A detected
+// service wins over errors of the other probes.
+func discoveryStatus(result networkscanner.ScanResult) string {
+	switch {
+	case result.ApplicationLayer != "", result.SSH != nil:
+		return networkscanner.DISCOVERY_STATUS_IDENTIFIED
+	case len(result.Errors) > 0:
+		return networkscanner.DISCOVERY_STATUS_ERROR
+	default:
+		return networkscanner.DISCOVERY_STATUS_UNIDENTIFIED
+	}
+}
+
+// ExpandTargets turns a target description into the list of hosts to scan.
+func ExpandTargets(target networkscanner.TargetDescription) ([]portdiscovery.ScanTarget, error) {
+	var targets []portdiscovery.ScanTarget
+	switch target.TargetType {
+	case networkscanner.TARGET_TYPE_IP:
+		if target.IPStart == nil {
+			return nil, fmt.Errorf("no IP address given for target type %s", target.TargetType)
+		}
+		targets = append(targets, portdiscovery.ScanTarget{Hostname: target.IPStart.String(), IPStart: target.IPStart})
+	case networkscanner.TARGET_TYPE_IP_LIST:
+		if len(target.IPs) == 0 {
+			return nil, fmt.Errorf("no IP addresses given for target type %s", target.TargetType)
+		}
+		for _, ip := range target.IPs {
+			targets = append(targets, portdiscovery.ScanTarget{Hostname: ip.String(), IPStart: ip})
+		}
+	case networkscanner.TARGET_TYPE_IP_RANGE:
+		if target.IPStart == nil || target.IPEnd == nil {
+			return nil, fmt.Errorf("IP range needs both a start and an end address")
+		}
+		ips, err := portdiscovery.ExpandIPRange(target.IPStart, target.IPEnd)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			targets = append(targets, portdiscovery.ScanTarget{Hostname: ip.String(), IPStart: ip})
+		}
+	case networkscanner.TARGET_TYPE_HOSTNAME:
+		if target.Hostname == "" {
+			return nil, fmt.Errorf("no hostname given for target type %s", target.TargetType)
+		}
+		if target.IPStart != nil {
+			targets = append(targets, portdiscovery.ScanTarget{Hostname: target.Hostname, IPStart: target.IPStart})
+			break
+		}
+		// Every IPv4 and IPv6 address of the hostname is scanned
+		addrs, err := net.LookupIP(target.Hostname)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve hostname %s: %w", target.Hostname, err)
+		}
+		for _, ip := range addrs {
+			targets = append(targets, portdiscovery.ScanTarget{Hostname: target.Hostname, IPStart: ip})
+		}
+	case networkscanner.TARGET_TYPE_SPECS:
+		specTargets, err := portdiscovery.ParseTargets(target.Specs, target.Exclude)
+		if err != nil {
+			return nil, err
+		}
+		if len(specTargets) == 0 {
+			return nil, fmt.Errorf("no targets left to scan after exclusions")
+		}
+		targets = specTargets
+	default:
+		return nil, fmt.Errorf("unknown target type: %q", target.TargetType)
+	}
+	return targets, nil
+}
+
+// ExpandPorts turns the port part of a target description into a port list.
+// An empty list means all ports.
+func ExpandPorts(target networkscanner.TargetDescription) ([]int, error) {
+	var ports []int
+	switch target.PortType {
+	case "":
+		ports = target.Ports
+	case networkscanner.PORT_TYPE_SINGLE:
+		switch {
+		case len(target.Ports) > 0:
+			ports = target.Ports[:1]
+		case target.PortStart != 0:
+			ports = []int{target.PortStart}
+		default:
+			return nil, fmt.Errorf("no port given for port type %s", target.PortType)
+		}
+	case networkscanner.PORT_TYPE_LIST:
+		if len(target.Ports) == 0 {
+			return nil, fmt.Errorf("no ports given for port type %s", target.PortType)
+		}
+		ports = target.Ports
+	case networkscanner.PORT_TYPE_RANGE:
+		if target.PortStart > target.PortEnd {
+			return nil, fmt.Errorf("invalid port range %d-%d", target.PortStart, target.PortEnd)
+		}
+		for port := target.PortStart; port <= target.PortEnd; port++ {
+			ports = append(ports, port)
+		}
+	case networkscanner.PORT_TYPE_TOP:
+		if target.TopPorts < 1 {
+			return nil, fmt.Errorf("number of top ports must be positive for port type %s", target.PortType)
+		}
+		ports = portdiscovery.TopPorts(target.TopPorts)
+	case networkscanner.PORT_TYPE_COMMON:
+		ports = CommonPorts()
+	default:
+		return nil, fmt.Errorf("unknown port type: %q", target.PortType)
+	}
+
+	for _, port := range ports {
+		if port < 1 || port > maxPort {
+			return nil, fmt.Errorf("port number out of range: %d", port)
+		}
+	}
+	return ports, nil
+}
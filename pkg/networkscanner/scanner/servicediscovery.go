@@ -0,0 +1,644 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner"
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/portdiscovery"
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery/applicationlayerdiscovery"
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery/presentationlayerdiscovery"
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery/sessionlayerdiscovery"
+)
+
+type DiscoveryResult struct {
+	SessionLayer      string
+	PresentationLayer string
+	ApplicationLayer  string
+	Authentication    servicediscovery.Authentication
+	Properties        map[string]interface{}
+	// Negotiated TLS session, if the session layer is TLS or STARTTLS
+	TLS *networkscanner.TLSDetails
+	// In-band TLS upgrade, if the application protocol has one
+	StartTLS *networkscanner.StartTLSDetails
+	// SSH server, if the session layer is SSH
+	SSH *networkscanner.SSHDetails
+	// Answer of the HTTP server, if HTTP was detected
+	HTTP *networkscanner.HTTPDetails
+	// HTTP/2 connection, if HTTP/2 was detected
+	HTTP2 *networkscanner.HTTP2Details
+	// Paths upgrading to WebSocket, if any was found
+	WebSocket *networkscanner.WebSocketDetails
+	// Every application layer detection, best match first. The fields
+	// above hold the first one.
+	Matches []networkscanner.ServiceMatch
+	// Probes run on each layer, in list order
+	Probes []networkscanner.ProbeRecord
+}
+
+// Names of the probe records of the TLS version and cipher suite
+// enumeration and of the STARTTLS upgrade
+const (
+	tlsEnumerationProbe = "tls-enumeration"
+	startTlsProbe       = "starttls"
+)
+
+// DiscoverService walks the session, presentation and application layers of
+// host:port and reports what was detected on each of them. Only discoveries
+// that run over the given transport protocol are tried, and only application
+// probes allowed by the filter.
+//
+// On every layer the probes run concurrently, each over its own session
+// handler, and when several of them detect their protocol, the one listed
+// first in its discovery list wins. When ctx carries a worker pool, every
+// probe first waits for a worker of the host.
+// Application probes whose CommonPorts contain the port run first; the
+// others run only if none of those detected anything. All application
+// detections are kept as matches, ranked by confidence and then list order.
+//
+// The versions and cipher suites of TLS sessions are enumerated first when
+// the TLS options of ctx ask for it.
+//
+// When the application protocol of a plain TCP session can be upgraded to
+// TLS in-band, the upgrade is tried last. If the server offers it, the
+// session layer is reported as STARTTLS with the details of the upgraded
+// session.
+//
+// Nothing is discovered over TLS sessions that require a client certificate
+// the scanner does not have or that is refused; mutual TLS is reported as
+// the authentication instead.
+//
+// Nothing is discovered over SSH sessions, which need credentials; the
+// authentication of the SSH server is reported instead.
+//
+// An error is returned when none of the session layer probes could reach
+// the port; the error of every probe is kept in the probe records.
+func DiscoverService(ctx context.Context, host string, port int, transport servicediscovery.TransportProtocol, filter ServiceFilter) (result DiscoveryResult, err error) {
+	sessionDiscoveryResult, probes := discoverSessionLayer(ctx, host, port, transport)
+	result.Probes = append(result.Probes, probes...)
+	if sessionDiscoveryResult == nil {
+		log.Debugf("No session layer protocol detected")
+		if ctx.Err() != nil {
+			return result, ctx.Err()
+		}
+		return result, sessionLayerError(probes)
+	}
+	result.SessionLayer = fmt.Sprintf("%v", sessionDiscoveryResult.Protocol())
+	if tlsResult, ok := sessionDiscoveryResult.(servicediscovery.ITlsSessionLayerDiscoveryResult); ok {
+		var probes []networkscanner.ProbeRecord
+		result.TLS, probes = discoverTLSDetails(ctx, tlsResult)
+		result.Probes = append(result.Probes, probes...)
+	}
+	if mtlsRefused(result.TLS) {
+		reason := "mTLS required, no client certificate given"
+		if result.TLS.ClientCertificateRequest.ClientCertificateAccepted != nil {
+			reason = "mTLS required, client certificate refused"
+		}
+		result.Authentication = servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATED, Reason: reason}
+		return result, ctx.Err()
+	}
+	if sshResult, ok := sessionDiscoveryResult.(servicediscovery.ISshSessionLayerDiscoveryResult); ok {
+		info := sshResult.GetServerInfo()
+		result.SSH = newSSHDetails(info)
+		result.Authentication = sshAuthentication(info)
+		return result, ctx.Err()
+	}
+
+	presentationDiscoveryResults, probes := discoverPresentationLayer(ctx, transport, sessionDiscoveryResult)
+	result.Probes = append(result.Probes, probes...)
+	var presentationDiscoveryResult presentationLayerDiscoveryResult
+	if len(presentationDiscoveryResults) > 0 {
+		presentationDiscoveryResult = presentationDiscoveryResults[0]
+		result.PresentationLayer = fmt.Sprintf("%v", presentationDiscoveryResult.Protocol())
+	}
+	for _, presentationResult := range presentationDiscoveryResults {
+		switch presentationResult := presentationResult.(type) {
+		case servicediscovery.IHttpPresentationDiscoveryResult:
+			result.HTTP = newHTTPDetails(presentationResult.GetFingerprint())
+		case servicediscovery.IHttp2PresentationDiscoveryResult:
+			result.HTTP2 = newHTTP2Details(presentationResult.GetHttp2Info())
+			// Discovery handshakes offer no protocol, h2 is only negotiated
+			// by the HTTP/2 probe
+			if result.TLS != nil && result.HTTP2.Mode == servicediscovery.HTTP2_MODE_TLS {
+				result.TLS.ALPN = "h2"
+			}
+		case servicediscovery.IWebSocketPresentationDiscoveryResult:
+			result.WebSocket = newWebSocketDetails(presentationResult.GetWebSocketEndpoints())
+		}
+	}
+
+	matches, probes := discoverApplicationLayer(ctx, port, transport, filter, sessionDiscoveryResult, presentationDiscoveryResult)
+	result.Probes = append(result.Probes, probes...)
+	if len(matches) > 0 {
+		result.ApplicationLayer = fmt.Sprintf("%v", matches[0].result.Protocol())
+		result.Authentication = matches[0].result.GetAuthentication()
+		result.Properties = matches[0].result.GetProperties()
+	}
+	for _, match := range matches {
+		result.Matches = append(result.Matches, match.serviceMatch())
+	}
+
+	if result.SessionLayer == string(servicediscovery.NO_SESSION_LAYER) && sessionlayerdiscovery.SupportsStartTls(result.ApplicationLayer) {
+		discoverStartTLS(ctx, host, port, &result)
+	}
+
+	// Whatever was detected before a cancellation is still returned
+	return result, ctx.Err()
+}
+
+// discoverTLSDetails describes the TLS session of a session layer result,
+// enumerating its versions and cipher suites if the TLS options of ctx ask
+// for it, and returns the records of the probes it ran
+func discoverTLSDetails(ctx context.Context, tlsResult servicediscovery.ITlsSessionLayerDiscoveryResult) (*networkscanner.TLSDetails, []networkscanner.ProbeRecord) {
+	options := servicediscovery.TlsOptionsFromContext(ctx)
+	details := networkscanner.NewTLSDetails(tlsResult.GetConnectionState())
+	verification := tlsResult.GetVerification()
+	details.Trusted = verification.Trusted
+	details.TrustedBy = verification.TrustedBy
+	details.VerificationError = verification.Error
+	details.HostnameMismatch = verification.HostnameMismatch
+	if request := tlsResult.GetClientCertificateRequest(); request != nil {
+		details.ClientCertificateRequest = newTLSClientCertificateRequest(*request, options)
+	}
+
+	if !options.Enumerate {
+		return details, nil
+	}
+	release, err := acquireProbeWorker(ctx)
+	if err != nil {
+		return details, []networkscanner.ProbeRecord{newProbeRecord(ctx, networkscanner.PROBE_LAYER_SESSION, tlsEnumerationProbe, time.Now(), false, err)}
+	}
+	defer release()
+	start := time.Now()
+	enumeration, err := tlsResult.Enumerate(ctx)
+	record := newProbeRecord(ctx, networkscanner.PROBE_LAYER_SESSION, tlsEnumerationProbe, start, err == nil, err)
+	if err != nil {
+		log.Debugf("TLS enumeration failed: %v", err)
+	} else {
+		details.Enumeration = newTLSEnumeration(enumeration)
+	}
+	return details, []networkscanner.ProbeRecord{record}
+}
+
+// discoverStartTLS tries the in-band TLS upgrade of the application protocol
+// of a plain TCP session. When the server offers it, the session layer of
+// the result becomes STARTTLS and the upgraded session is described like
+// direct TLS.
+func discoverStartTLS(ctx context.Context, host string, port int, result *DiscoveryResult) {
+	release, err := acquireProbeWorker(ctx)
+	if err != nil {
+		result.Probes = append(result.Probes, newProbeRecord(ctx, networkscanner.PROBE_LAYER_SESSION, startTlsProbe, time.Now(), false, err))
+		return
+	}
+	probeCtx, cancel := probeContext(ctx)
+	defer cancel()
+	start := time.Now()
+	status, tlsResult, err := sessionlayerdiscovery.DiscoverStartTls(probeCtx, host, port, result.ApplicationLayer)
+	// The enumeration of the upgraded session takes a worker of its own
+	release()
+	result.Probes = append(result.Probes, newProbeRecord(probeCtx, networkscanner.PROBE_LAYER_SESSION, startTlsProbe, start, tlsResult != nil, err))
+	result.StartTLS = &networkscanner.StartTLSDetails{Offered: status.Offered, Required: status.Required}
+	if err != nil {
+		log.Debugf("STARTTLS discovery failed: %v", err)
+		return
+	}
+	if tlsResult == nil {
+		return
+	}
+
+	result.SessionLayer = string(tlsResult.Protocol())
+	var probes []networkscanner.ProbeRecord
+	result.TLS, probes = discoverTLSDetails(ctx, tlsResult)
+	result.Probes = append(result.Probes, probes...)
+}
+
+// discoverSessionLayer returns the first session layer protocol of the list
+// detected on host:port, nil if there is none, and the records of the probes
+// it ran
+func discoverSessionLayer(ctx context.Context, host string, port int, transport servicediscovery.TransportProtocol) (sessionLayerDiscoveryResult, []networkscanner.ProbeRecord) {
+	results := make([]sessionLayerDiscoveryResult, len(sessionlayerdiscovery.SessionDiscoveryList))
+	records := make([]networkscanner.ProbeRecord, len(sessionlayerdiscovery.SessionDiscoveryList))
+	var sessionWg sync.WaitGroup
+	for i, sessionDiscoveryItem := range sessionlayerdiscovery.SessionDiscoveryList {
+		if sessionDiscoveryItem.Reqirement != string(transport) {
+			continue
+		}
+		sessionWg.Add(1)
+		go func(i int, sessionDiscoveryItem sessionlayerdiscovery.SessionLayerDiscoveryListItem) {
+			defer sessionWg.Done()
+			release, err := acquireProbeWorker(ctx)
+			if err != nil {
+				records[i] = newProbeRecord(ctx, networkscanner.PROBE_LAYER_SESSION, string(sessionDiscoveryItem.Protocol), time.Now(), false, err)
+				return
+			}
+			defer release()
+			probeCtx, cancel := probeContext(ctx)
+			defer cancel()
+			start := time.Now()
+			sessionDiscoveryResult, err := sessionDiscoveryItem.Discovery.SessionLayerDiscover(probeCtx, host, port)
+			detected := err == nil && sessionDiscoveryResult != nil && sessionDiscoveryResult.GetIsDetected()
+			records[i] = newProbeRecord(probeCtx, networkscanner.PROBE_LAYER_SESSION, string(sessionDiscoveryItem.Protocol), start, detected, err)
+			if err != nil {
+				if err != io.EOF {
+					log.Debugf("Error while discovering session layer protocol: %v", err)
+				}
+				return
+			}
+			results[i] = sessionDiscoveryResult
+		}(i, sessionDiscoveryItem)
+	}
+	sessionWg.Wait()
+
+	for _, result := range results {
+		if result != nil && result.GetIsDetected() {
+			return result, ranProbes(records)
+		}
+	}
+	return nil, ranProbes(records)
+}
+
+// sessionLayerError describes why no session layer protocol was detected,
+// nil if every probe ran without error
+func sessionLayerError(probes []networkscanner.ProbeRecord) error {
+	var failures []string
+	for _, probe := range probes {
+		if probe.Error != "" {
+			failures = append(failures, fmt.Sprintf("%s: %s", probe.Name, probe.Error))
+		}
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	return fmt.Errorf("no session layer protocol detected (%s)", strings.Join(failures, "; "))
+}
+
+// discoverPresentationLayer returns the presentation layer protocols detected
+// over the session in list order, and the records of the probes it ran. A
+// server may speak several of them, such as HTTP/1.1 and HTTP/2, the first
+// one is the presentation layer of the service.
+func discoverPresentationLayer(ctx context.Context, transport servicediscovery.TransportProtocol, sessionDiscoveryResult sessionLayerDiscoveryResult) ([]presentationLayerDiscoveryResult, []networkscanner.ProbeRecord) {
+	results := make([]presentationLayerDiscoveryResult, len(presentationlayerdiscovery.PresentationDiscoveryList))
+	records := make([]networkscanner.ProbeRecord, len(presentationlayerdiscovery.PresentationDiscoveryList))
+	var presentationWg sync.WaitGroup
+	for i, presentationDiscoveryItem := range presentationlayerdiscovery.PresentationDiscoveryList {
+		if presentationDiscoveryItem.Reqirement != string(transport) {
+			continue
+		}
+		presentationWg.Add(1)
+		go func(i int, presentationDiscoveryItem presentationlayerdiscovery.PresentationLayerDiscoveryListItem) {
+			defer presentationWg.Done()
+			release, err := acquireProbeWorker(ctx)
+			if err != nil {
+				records[i] = newProbeRecord(ctx, networkscanner.PROBE_LAYER_PRESENTATION, string(presentationDiscoveryItem.Discovery.Protocol()), time.Now(), false, err)
+				return
+			}
+			defer release()
+			probeCtx, cancel := probeContext(ctx)
+			defer cancel()
+			start := time.Now()
+			var presentationDiscoveryResult presentationLayerDiscoveryResult
+			sessionHandler, err := sessionDiscoveryResult.GetSessionHandler()
+			if err == nil {
+				presentationDiscoveryResult, err = presentationDiscoveryItem.Discovery.Discover(probeCtx, sessionHandler)
+			}
+			detected := err == nil && presentationDiscoveryResult != nil && presentationDiscoveryResult.GetIsDetected()
+			records[i] = newProbeRecord(probeCtx, networkscanner.PROBE_LAYER_PRESENTATION, string(presentationDiscoveryItem.Discovery.Protocol()), start, detected, err)
+			if err != nil {
+				if err != io.EOF {
+					log.Debugf("Error while discovering presentation layer protocol: %v", err)
+				}
+				return
+			}
+			results[i] = presentationDiscoveryResult
+		}(i, presentationDiscoveryItem)
+	}
+	presentationWg.Wait()
+
+	var detected []presentationLayerDiscoveryResult
+	for _, result := range results {
+		if result != nil && result.GetIsDetected() {
+			detected = append(detected, result)
+		}
+	}
+	return detected, ranProbes(records)
+}
+
+// applicationMatch is an application layer detection and its ranking
+type applicationMatch struct {
+	result     applicationLayerDiscoveryResult
+	confidence int
+	evidence   []string
+}
+
+func (m applicationMatch) serviceMatch() networkscanner.ServiceMatch {
+	authentication := m.result.GetAuthentication()
+	return networkscanner.ServiceMatch{
+		Service:              m.result.Protocol(),
+		Confidence:           m.confidence,
+		Authenticated:        authenticationStatus(authentication),
+		AuthenticationReason: authentication.Reason,
+		Evidence:             m.evidence,
+		Properties:           m.result.GetProperties(),
+	}
+}
+
+// authenticationStatus returns the status as an AUTHENTICATION_STATUS_*
+// value, unknown if the probe left it unset
+func authenticationStatus(authentication servicediscovery.Authentication) string {
+	if authentication.Status == "" {
+		return networkscanner.AUTHENTICATION_STATUS_UNKNOWN
+	}
+	return string(authentication.Status)
+}
+
+// Confidence added to a detection on one of the CommonPorts of its probe
+const commonPortConfidence = 10
+
+// discoverApplicationLayer returns the application layer protocols detected
+// over the session, ranked by confidence and then by list order, and the
+// records of the probes it ran. The probes hinted by the port run first, the
+// remaining ones only as a fallback.
+func discoverApplicationLayer(ctx context.Context, port int, transport servicediscovery.TransportProtocol, filter ServiceFilter, sessionDiscoveryResult sessionLayerDiscoveryResult, presentationDiscoveryResult presentationLayerDiscoveryResult) ([]applicationMatch, []networkscanner.ProbeRecord) {
+	var hinted, others []int
+	for i, applicationDiscoveryItem := range applicationlayerdiscovery.ApplicationDiscoveryList {
+		if applicationDiscoveryItem.Reqirement != string(transport) || !filter.Allows(applicationDiscoveryItem.Discovery.Protocol()) {
+			continue
+		}
+		if slices.Contains(applicationDiscoveryItem.CommonPorts, port) {
+			hinted = append(hinted, i)
+		} else {
+			others = append(others, i)
+		}
+	}
+
+	phases := []struct {
+		probes []int
+		hinted bool
+	}{
+		{probes: hinted, hinted: true},
+		{probes: others, hinted: false},
+	}
+	var records []networkscanner.ProbeRecord
+	for _, phase := range phases {
+		if ctx.Err() != nil {
+			return nil, records
+		}
+		var matches []applicationMatch
+		results, phaseRecords := runApplicationProbes(ctx, phase.probes, sessionDiscoveryResult, presentationDiscoveryResult)
+		records = append(records, phaseRecords...)
+		for _, result := range results {
+			matches = append(matches, newApplicationMatch(result, port, phase.hinted))
+		}
+		if len(matches) > 0 {
+			// Stable, so equal confidences keep the list order
+			sort.SliceStable(matches, func(i, j int) bool {
+				return matches[i].confidence > matches[j].confidence
+			})
+			return matches, records
+		}
+	}
+	return nil, records
+}
+
+func newApplicationMatch(result applicationLayerDiscoveryResult, port int, hinted bool) applicationMatch {
+	match := applicationMatch{
+		result:     result,
+		confidence: result.GetConfidence(),
+		evidence:   append([]string{}, result.GetEvidence()...),
+	}
+	if hinted {
+		match.confidence = min(match.confidence+commonPortConfidence, 100)
+		match.evidence = append(match.evidence, fmt.Sprintf("port %d is a common %s port", port, result.Protocol()))
+	}
+	return match
+}
+
+// runApplicationProbes runs the application probes at the given list indexes
+// concurrently and returns their detections and records in list order
+func runApplicationProbes(ctx context.Context, probes []int, sessionDiscoveryResult sessionLayerDiscoveryResult, presentationDiscoveryResult presentationLayerDiscoveryResult) ([]applicationLayerDiscoveryResult, []networkscanner.ProbeRecord) {
+	results := make([]applicationLayerDiscoveryResult, len(probes))
+	records := make([]networkscanner.ProbeRecord, len(probes))
+	var applicationWg sync.WaitGroup
+	for i, probe := range probes {
+		applicationWg.Add(1)
+		go func(i int, applicationDiscoveryItem applicationlayerdiscovery.ApplicationDiscoveryListItem) {
+			defer applicationWg.Done()
+			release, err := acquireProbeWorker(ctx)
+			if err != nil {
+				records[i] = newProbeRecord(ctx, networkscanner.PROBE_LAYER_APPLICATION, applicationDiscoveryItem.Discovery.Protocol(), time.Now(), false, err)
+				return
+			}
+			defer release()
+			probeCtx, cancel := probeContext(ctx)
+			defer cancel()
+			start := time.Now()
+			var applicationDiscoveryResult applicationLayerDiscoveryResult
+			sessionHandler, err := sessionDiscoveryResult.GetSessionHandler()
+			if err == nil {
+				applicationDiscoveryResult, err = applicationDiscoveryItem.Discovery.Discover(probeCtx, sessionHandler, presentationDiscoveryResult)
+			}
+			detected := err == nil && applicationDiscoveryResult != nil && applicationDiscoveryResult.GetIsDetected()
+			records[i] = newProbeRecord(probeCtx, networkscanner.PROBE_LAYER_APPLICATION, applicationDiscoveryItem.Discovery.Protocol(), start, detected, err)
+			if err != nil {
+				log.Debugf("Error while discovering application layer protocol %s: %v", applicationDiscoveryItem.Discovery.Protocol(), err)
+				return
+			}
+			results[i] = applicationDiscoveryResult
+		}(i, applicationlayerdiscovery.ApplicationDiscoveryList[probe])
+	}
+	applicationWg.Wait()
+
+	var detected []applicationLayerDiscoveryResult
+	for _, result := range results {
+		if result != nil && result.GetIsDetected() {
+			detected = append(detected, result)
+		}
+	}
+	return detected, records
+}
+
+// newProbeRecord describes a probe that started at start and returned err.
+// The probe timed out if its context ran out or its connection timed out.
+func newProbeRecord(probeCtx context.Context, layer string, name string, start time.Time, detected bool, err error) networkscanner.ProbeRecord {
+	record := networkscanner.ProbeRecord{
+		Layer:    layer,
+		Name:     name,
+		Duration: time.Since(start),
+		Detected: detected,
+		TimedOut: errors.Is(probeCtx.Err(), context.DeadlineExceeded),
+	}
+	if err != nil {
+		record.Error = err.Error()
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			record.TimedOut = true
+		}
+	}
+	return record
+}
+
+// ranProbes drops the records of the list entries that were not run
+func ranProbes(records []networkscanner.ProbeRecord) []networkscanner.ProbeRecord {
+	var ran []networkscanner.ProbeRecord
+	for _, record := range records {
+		if record.Layer != "" {
+			ran = append(ran, record)
+		}
+	}
+	return ran
+}
+
+// probeContext bounds a single discovery probe by the probe timeout of the
+// timing carried by ctx
+func probeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, servicediscovery.TimingFromContext(ctx).ProbeTimeout)
+}
+
+type probeWorkersKey struct{}
+
+// Pool the probes of a host take their workers from
+type probeWorkers struct {
+	pool *portdiscovery.WorkerPool
+	host string
+}
+
+// contextWithProbeWorkers returns a copy of ctx in which every probe takes a
+// worker of host from pool. Probes open their own connections, so this
+// keeps service discovery within the file descriptor and rate limits of the
+// pool.
+func contextWithProbeWorkers(ctx context.Context, pool *portdiscovery.WorkerPool, host string) context.Context {
+	return context.WithValue(ctx, probeWorkersKey{}, probeWorkers{pool: pool, host: host})
+}
+
+// acquireProbeWorker waits for a worker of the pool of ctx and returns the
+// function giving it back. Without a pool, probes are not limited.
+func acquireProbeWorker(ctx context.Context) (release func(), err error) {
+	workers, ok := ctx.Value(probeWorkersKey{}).(probeWorkers)
+	if !ok {
+		return func() {}, nil
+	}
+	if err := workers.pool.Acquire(ctx, workers.host); err != nil {
+		return nil, err
+	}
+	return func() { workers.pool.Release(workers.host) }, nil
+}
+
+func newTLSClientCertificateRequest(request servicediscovery.TlsClientCertificateRequest, options servicediscovery.TlsOptions) *networkscanner.TLSClientCertificateRequest {
+	details := &networkscanner.TLSClientCertificateRequest{
+		MTLSRequired:  request.Required,
+		AcceptableCAs: request.AcceptableCAs,
+	}
+	if options.ClientCertificate != nil {
+		details.ClientCertificateAccepted = &request.Accepted
+	}
+	return details
+}
+
+// mtlsRefused tells whether the TLS session requires a client certificate
+// and the scanner has no accepted one, so no connection can be opened over it
+func mtlsRefused(details *networkscanner.TLSDetails) bool {
+	if details == nil || details.ClientCertificateRequest == nil {
+		return false
+	}
+	request := details.ClientCertificateRequest
+	return request.MTLSRequired != nil && *request.MTLSRequired && (request.ClientCertificateAccepted == nil || !*request.ClientCertificateAccepted)
+}
+
+func newTLSEnumeration(enumeration servicediscovery.TlsEnumeration) *networkscanner.TLSEnumeration {
+	return &networkscanner.TLSEnumeration{
+		Versions:               enumeration.Versions,
+		CipherSuites:           enumeration.CipherSuites,
+		ServerCipherPreference: enumeration.ServerCipherPreference,
+		WeakCipherSuites:       enumeration.WeakCipherSuites,
+		Grade:                  enumeration.Grade,
+		GradeReasons:           enumeration.GradeReasons,
+	}
+}
+
+func newHTTPDetails(fingerprint servicediscovery.HttpFingerprint) *networkscanner.HTTPDetails {
+	details := &networkscanner.HTTPDetails{
+		Version:     fingerprint.Version,
+		StatusCode:  fingerprint.StatusCode,
+		Headers:     fingerprint.Headers,
+		Server:      fingerprint.Server,
+		PoweredBy:   fingerprint.PoweredBy,
+		Redirects:   fingerprint.Redirects,
+		AuthSchemes: fingerprint.AuthSchemes,
+		Title:       fingerprint.Title,
+		BodyHash:    fingerprint.BodyHash,
+		BodyLength:  fingerprint.BodyLength,
+		FaviconHash: fingerprint.FaviconHash,
+	}
+	for _, cookie := range fingerprint.Cookies {
+		details.Cookies = append(details.Cookies, networkscanner.HTTPCookie(cookie))
+	}
+	for _, path := range fingerprint.Paths {
+		details.Paths = append(details.Paths, networkscanner.HTTPPathResponse(path))
+	}
+	return details
+}
+
+func newHTTP2Details(info servicediscovery.Http2Info) *networkscanner.HTTP2Details {
+	return &networkscanner.HTTP2Details{
+		Mode:        info.Mode,
+		Settings:    info.Settings,
+		StatusCode:  info.StatusCode,
+		Server:      info.Server,
+		ContentType: info.ContentType,
+	}
+}
+
+func newWebSocketDetails(endpoints []servicediscovery.WebSocketEndpoint) *networkscanner.WebSocketDetails {
+	details := &networkscanner.WebSocketDetails{}
+	for _, endpoint := range endpoints {
+		details.Endpoints = append(details.Endpoints, networkscanner.WebSocketEndpoint(endpoint))
+	}
+	return details
+}
+
+func newSSHDetails(info servicediscovery.SshServerInfo) *networkscanner.SSHDetails {
+	return &networkscanner.SSHDetails{
+		ProtocolVersion:        info.ProtocolVersion,
+		Software:               info.Software,
+		SoftwareVersion:        info.SoftwareVersion,
+		Comments:               info.Comments,
+		KexAlgorithms:          info.KexAlgorithms,
+		HostKeyAlgorithms:      info.HostKeyAlgorithms,
+		Ciphers:                info.Ciphers,
+		MACs:                   info.MACs,
+		Compressions:           info.Compressions,
+		WeakAlgorithms:         info.WeakAlgorithms,
+		HostKeyType:            info.HostKeyType,
+		HostKeyFingerprint:     info.HostKeyFingerprint,
+		AuthMethods:            info.AuthMethods,
+		PasswordAuthentication: slices.Contains(info.AuthMethods, "password"),
+		NoneAuthentication:     info.NoneAuthentication,
+	}
+}
+
+func sshAuthentication(info servicediscovery.SshServerInfo) servicediscovery.Authentication {
+	switch {
+	case info.NoneAuthentication:
+		return servicediscovery.Authentication{Status: servicediscovery.UNAUTHENTICATED, Reason: "none authentication accepted"}
+	case len(info.AuthMethods) > 0:
+		return servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATED, Reason: "offers " + strings.Join(info.AuthMethods, ", ")}
+	default:
+		return servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN, Reason: "authentication check failed"}
+	}
+}
+
+// Short names of the discovery result interfaces
+type sessionLayerDiscoveryResult = servicediscovery.ISessionLayerDiscoveryResult
+type presentationLayerDiscoveryResult = servicediscovery.IPresentationDiscoveryResult
+type applicationLayerDiscoveryResult = servicediscovery.IApplicationDiscoveryResult
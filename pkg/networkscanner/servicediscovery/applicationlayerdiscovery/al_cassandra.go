@@ -1,7 +1,7 @@
 package applicationlayerdiscovery
 
 import (
-	"time"
+	"context"
 
 	"github.com/gocql/gocql"
 	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
@@ -15,9 +15,11 @@ const (
 )
 
 type CassandraDiscoveryResult struct {
-	IsDetected      bool
-	properties      map[string]interface{}
-	isAuthenticated bool
+	IsDetected     bool
+	properties     map[string]interface{}
+	authentication servicediscovery.Authentication
+	confidence     int
+	evidence       []string
 }
 
 type CassandraDiscovery struct{}
@@ -26,8 +28,16 @@ func (r *CassandraDiscoveryResult) Protocol() string {
 	return "cassandra"
 }
 
-func (r *CassandraDiscoveryResult) GetIsAuthRequired() bool {
-	return false
+func (r *CassandraDiscoveryResult) GetAuthentication() servicediscovery.Authentication {
+	return r.authentication
+}
+
+func (r *CassandraDiscoveryResult) GetConfidence() int {
+	return r.confidence
+}
+
+func (r *CassandraDiscoveryResult) GetEvidence() []string {
+	return r.evidence
 }
 
 func (r *CassandraDiscoveryResult) GetIsDetected() bool {
@@ -42,7 +52,7 @@ func (d *CassandraDiscovery) Protocol() string {
 	return "cassandra"
 }
 
-func (d *CassandraDiscovery) Discover(sessionHandler servicediscovery.ISessionHandler, presentationLayerDiscoveryResult servicediscovery.IPresentationDiscoveryResult) (servicediscovery.IApplicationDiscoveryResult, error) {
+func (d *CassandraDiscovery) Discover(ctx context.Context, sessionHandler servicediscovery.ISessionHandler, presentationLayerDiscoveryResult servicediscovery.IPresentationDiscoveryResult) (servicediscovery.IApplicationDiscoveryResult, error) {
 	// Set the Cassandra cluster hosts
 	clusterHosts := []string{sessionHandler.GetHost()}
 	// Create a cluster configuration
@@ -54,22 +64,27 @@ func (d *CassandraDiscovery) Discover(sessionHandler servicediscovery.ISessionHa
 		Username: Username,
 		Password: Password,
 	}
-	cluster.Timeout = time.Millisecond * 500
+	timing := servicediscovery.TimingFromContext(ctx)
+	cluster.Timeout = timing.ReadTimeout
+	cluster.ConnectTimeout = timing.ConnectTimeout
+	cluster.Dialer = newContextDialer(ctx, timing.ConnectTimeout)
 
 	// Create a session
 	session, err := cluster.CreateSession()
 	if err != nil {
 		return &CassandraDiscoveryResult{
-			IsDetected:      false,
-			isAuthenticated: true,
-			properties:      nil, // Set properties to nil as it's not used in this case
+			IsDetected:     false,
+			authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN},
+			properties:     nil, // Set properties to nil as it's not used in this case
 		}, err
 	}
 	defer session.Close()
 
 	return &CassandraDiscoveryResult{
-		IsDetected:      true,
-		isAuthenticated: false,
-		properties:      nil, // Set properties to nil as it's not used in this case
+		IsDetected:     true,
+		confidence:     servicediscovery.CONFIDENCE_HIGH,
+		evidence:       []string{"CQL session established with the default credentials"},
+		authentication: servicediscovery.Authentication{Status: servicediscovery.UNAUTHENTICATED, Reason: "session established with the default credentials"},
+		properties:     nil, // Set properties to nil as it's not used in this case
 	}, nil
 }
@@ -0,0 +1,47 @@
+package applicationlayerdiscovery
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// contextDialer is handed to client libraries that do not take a context
+// themselves. Every connection it opens is closed as soon as the probe
+// context is done, so a cancelled scan does not wait for library timeouts.
+type contextDialer struct {
+	ctx     context.Context
+	timeout time.Duration
+}
+
+func newContextDialer(ctx context.Context, timeout time.Duration) *contextDialer {
+	return &contextDialer{ctx: ctx, timeout: timeout}
+}
+
+func (d *contextDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	// The library's own context and the probe context both abort the dial
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(d.ctx, cancel)
+	defer stop()
+
+	dialer := net.Dialer{Timeout: d.timeout}
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	context.AfterFunc(d.ctx, func() {
+		conn.Close()
+	})
+	return conn, nil
+}
+
+func (d *contextDialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(d.ctx, network, addr)
+}
+
+func (d *contextDialer) DialTimeout(network, addr string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(d.ctx, timeout)
+	defer cancel()
+	return d.DialContext(ctx, network, addr)
+}
@@ -0,0 +1,122 @@
+package applicationlayerdiscovery
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
+)
+
+const (
+	DNSProtocolName = "dns"
+	dnsQueryID      = 0x6b73
+	dnsHeaderSize   = 12
+)
+
+// Standard query for the NS records of the root zone, recursion desired
+var dnsRootQuery = []byte{
+	0x6b, 0x73, // ID
+	0x01, 0x00, // standard query, recursion desired
+	0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // one question
+	0x00,       // root name
+	0x00, 0x02, // type NS
+	0x00, 0x01, // class IN
+}
+
+var dnsResponseCodes = map[int]string{
+	0: "NOERROR",
+	1: "FORMERR",
+	2: "SERVFAIL",
+	3: "NXDOMAIN",
+	4: "NOTIMP",
+	5: "REFUSED",
+}
+
+type DNSDiscoveryResult struct {
+	isDetected     bool
+	properties     map[string]interface{}
+	authentication servicediscovery.Authentication
+	confidence     int
+	evidence       []string
+}
+
+func (r *DNSDiscoveryResult) Protocol() string {
+	return DNSProtocolName
+}
+
+func (r *DNSDiscoveryResult) GetIsDetected() bool {
+	return r.isDetected
+}
+
+func (r *DNSDiscoveryResult) GetProperties() map[string]interface{} {
+	return r.properties
+}
+
+func (r *DNSDiscoveryResult) GetAuthentication() servicediscovery.Authentication {
+	return r.authentication
+}
+
+func (r *DNSDiscoveryResult) GetConfidence() int {
+	return r.confidence
+}
+
+func (r *DNSDiscoveryResult) GetEvidence() []string {
+	return r.evidence
+}
+
+type DNSDiscovery struct {
+}
+
+func (d *DNSDiscovery) Protocol() string {
+	return DNSProtocolName
+}
+
+func (d *DNSDiscovery) Discover(ctx context.Context, sessionHandler servicediscovery.ISessionHandler, presentationLayerDiscoveryResult servicediscovery.IPresentationDiscoveryResult) (servicediscovery.IApplicationDiscoveryResult, error) {
+	response, err := exchangeDatagram(ctx, sessionHandler, dnsRootQuery, isDNSResponse)
+	if err != nil {
+		return &DNSDiscoveryResult{
+			isDetected:     false,
+			authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN},
+		}, err
+	}
+
+	flags := binary.BigEndian.Uint16(response[2:4])
+	responseCode := int(flags & 0x000f)
+	responseCodeName, ok := dnsResponseCodes[responseCode]
+	if !ok {
+		responseCodeName = fmt.Sprintf("RCODE%d", responseCode)
+	}
+
+	result := &DNSDiscoveryResult{
+		isDetected: true,
+		confidence: servicediscovery.CONFIDENCE_HIGH,
+		evidence:   []string{fmt.Sprintf("DNS response with the query ID and code %s", responseCodeName)},
+		properties: map[string]interface{}{
+			"responseCode":       responseCodeName,
+			"recursionAvailable": flags&0x0080 != 0,
+			"answers":            int(binary.BigEndian.Uint16(response[6:8])),
+		},
+	}
+
+	switch responseCodeName {
+	case "REFUSED":
+		result.authentication = servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN, Reason: "query refused"}
+	case "NOERROR", "NXDOMAIN":
+		result.authentication = servicediscovery.Authentication{Status: servicediscovery.UNAUTHENTICATED, Reason: "query answered without credentials"}
+	default:
+		result.authentication = servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN, Reason: fmt.Sprintf("query failed with %s", responseCodeName)}
+	}
+
+	return result, nil
+}
+
+// isDNSResponse tells whether datagram is the response to dnsRootQuery
+func isDNSResponse(datagram []byte) bool {
+	if len(datagram) < dnsHeaderSize {
+		return false
+	}
+	id := binary.BigEndian.Uint16(datagram[0:2])
+	isResponse := datagram[2]&0x80 != 0
+	return id == dnsQueryID && isResponse
+}
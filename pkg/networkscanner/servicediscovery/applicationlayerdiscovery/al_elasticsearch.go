@@ -1,7 +1,10 @@
 package applicationlayerdiscovery
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
 
 	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
 
@@ -9,9 +12,11 @@ import (
 )
 
 type ElasticsearchDiscoveryResult struct {
-	isDetected      bool
-	properties      map[string]interface{}
-	isAuthenticated bool
+	isDetected     bool
+	properties     map[string]interface{}
+	authentication servicediscovery.Authentication
+	confidence     int
+	evidence       []string
 }
 
 func (r *ElasticsearchDiscoveryResult) Protocol() string {
@@ -26,8 +31,16 @@ func (r *ElasticsearchDiscoveryResult) GetProperties() map[string]interface{} {
 	return r.properties
 }
 
-func (r *ElasticsearchDiscoveryResult) GetIsAuthRequired() bool {
-	return r.isAuthenticated
+func (r *ElasticsearchDiscoveryResult) GetAuthentication() servicediscovery.Authentication {
+	return r.authentication
+}
+
+func (r *ElasticsearchDiscoveryResult) GetConfidence() int {
+	return r.confidence
+}
+
+func (r *ElasticsearchDiscoveryResult) GetEvidence() []string {
+	return r.evidence
 }
 
 type ElasticsearchDiscovery struct {
@@ -37,43 +50,86 @@ func (d *ElasticsearchDiscovery) Protocol() string {
 	return "elasticsearch"
 }
 
-func (d *ElasticsearchDiscovery) Discover(sessionHandler servicediscovery.ISessionHandler, presentationLayerDiscoveryResult servicediscovery.IPresentationDiscoveryResult) (servicediscovery.IApplicationDiscoveryResult, error) {
-	url := fmt.Sprintf("http://%s:%d", sessionHandler.GetHost(), sessionHandler.GetPort())
+// Discover asks the cluster info over the session, in the scheme of the
+// session layer. Elasticsearch answers GET / with JSON, so servers whose
+// answer was not JSON are left out. With security enabled the cluster info
+// is refused with a security exception, which still detects the cluster.
+func (d *ElasticsearchDiscovery) Discover(ctx context.Context, sessionHandler servicediscovery.ISessionHandler, presentationLayerDiscoveryResult servicediscovery.IPresentationDiscoveryResult) (servicediscovery.IApplicationDiscoveryResult, error) {
+	notDetected := &ElasticsearchDiscoveryResult{
+		isDetected:     false,
+		authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN},
+		properties:     nil,
+	}
+	fingerprint, ok := httpFingerprint(presentationLayerDiscoveryResult)
+	if !ok || !isJsonResponse(http.Header(fingerprint.Headers)) {
+		return notDetected, nil
+	}
+	// Successful answers name the product, as the client checks as well
+	if fingerprint.StatusCode/100 == 2 && http.Header(fingerprint.Headers).Get("X-Elastic-Product") != "Elasticsearch" {
+		return notDetected, nil
+	}
+
+	timing := servicediscovery.TimingFromContext(ctx)
+	httpClient := servicediscovery.NewHttpClient(ctx, sessionHandler)
 	client, err := elasticsearch.NewClient(elasticsearch.Config{
-		Addresses: []string{url},
+		Addresses:    []string{httpClient.URL()},
+		Transport:    httpClient,
+		MaxRetries:   timing.Retries,
+		DisableRetry: timing.Retries == 0,
 	})
 	if err != nil {
-		return &ElasticsearchDiscoveryResult{
-			isDetected:      false,
-			isAuthenticated: true,
-			properties:      nil,
-		}, err
+		return notDetected, err
 	}
 
 	// Attempt to get cluster info.
-	res, err := client.Info()
+	res, err := client.Info(client.Info.WithContext(ctx))
 	if err != nil {
-		return &ElasticsearchDiscoveryResult{
-			isDetected:      false,
-			isAuthenticated: true,
-			properties:      nil,
-		}, err
+		return notDetected, err
 	}
 	defer res.Body.Close()
 
 	// Check response status
-	if res.IsError() {
+	if res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden {
+		var refusal struct {
+			Error struct {
+				Type string `json:"type"`
+			} `json:"error"`
+		}
+		if json.NewDecoder(res.Body).Decode(&refusal) != nil || refusal.Error.Type != "security_exception" {
+			return notDetected, nil
+		}
 		return &ElasticsearchDiscoveryResult{
-			isDetected:      false,
-			isAuthenticated: true,
-			properties:      nil,
-		}, err
+			isDetected:     true,
+			confidence:     servicediscovery.CONFIDENCE_HIGH,
+			evidence:       []string{fmt.Sprintf("GET / refused with HTTP %d and a security_exception", res.StatusCode)},
+			authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATED, Reason: "cluster info refused without credentials"},
+			properties:     nil,
+		}, nil
+	}
+	if res.IsError() {
+		return notDetected, nil
+	}
+
+	var info struct {
+		ClusterName string `json:"cluster_name"`
+		Version     struct {
+			Number string `json:"number"`
+		} `json:"version"`
+	}
+	var properties map[string]interface{}
+	if json.NewDecoder(res.Body).Decode(&info) == nil {
+		properties = map[string]interface{}{
+			"clusterName": info.ClusterName,
+			"version":     info.Version.Number,
+		}
 	}
 
 	result := &ElasticsearchDiscoveryResult{
-		isDetected:      true,
-		isAuthenticated: false,
-		properties:      nil,
+		isDetected:     true,
+		confidence:     servicediscovery.CONFIDENCE_HIGH,
+		evidence:       []string{"GET / returned the cluster info of an Elasticsearch product"},
+		authentication: servicediscovery.Authentication{Status: servicediscovery.UNAUTHENTICATED, Reason: "cluster info readable without credentials"},
+		properties:     properties,
 	}
 	return result, nil
 }
@@ -2,8 +2,8 @@ package applicationlayerdiscovery
 
 import (
 	"context"
-	"fmt"
-	"time"
+	"net"
+	"strconv"
 
 	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
 	clientv3 "go.etcd.io/etcd/client/v3"
@@ -11,9 +11,11 @@ import (
 )
 
 type EtcdDiscoveryResult struct {
-	isDetected      bool
-	properties      map[string]interface{}
-	isAuthenticated bool
+	isDetected     bool
+	properties     map[string]interface{}
+	authentication servicediscovery.Authentication
+	confidence     int
+	evidence       []string
 }
 
 func (r *EtcdDiscoveryResult) Protocol() string {
@@ -28,8 +30,16 @@ func (r *EtcdDiscoveryResult) GetProperties() map[string]interface{} {
 	return r.properties
 }
 
-func (r *EtcdDiscoveryResult) GetIsAuthRequired() bool {
-	return r.isAuthenticated
+func (r *EtcdDiscoveryResult) GetAuthentication() servicediscovery.Authentication {
+	return r.authentication
+}
+
+func (r *EtcdDiscoveryResult) GetConfidence() int {
+	return r.confidence
+}
+
+func (r *EtcdDiscoveryResult) GetEvidence() []string {
+	return r.evidence
 }
 
 type EtcdDiscovery struct {
@@ -39,12 +49,14 @@ func (d *EtcdDiscovery) Protocol() string {
 	return "etcd"
 }
 
-func (d *EtcdDiscovery) Discover(sessionHandler servicediscovery.ISessionHandler, presentationLayerDiscoveryResult servicediscovery.IPresentationDiscoveryResult) (servicediscovery.IApplicationDiscoveryResult, error) {
-	endpoints := []string{fmt.Sprintf("%s:%d", sessionHandler.GetHost(), sessionHandler.GetPort())}
+func (d *EtcdDiscovery) Discover(ctx context.Context, sessionHandler servicediscovery.ISessionHandler, presentationLayerDiscoveryResult servicediscovery.IPresentationDiscoveryResult) (servicediscovery.IApplicationDiscoveryResult, error) {
+	endpoints := []string{net.JoinHostPort(sessionHandler.GetHost(), strconv.Itoa(sessionHandler.GetPort()))}
 	zapLogger := zap.NewNop()
+	timing := servicediscovery.TimingFromContext(ctx)
 	config := clientv3.Config{
 		Endpoints:   endpoints,
-		DialTimeout: 500 * time.Millisecond,
+		Context:     ctx,
+		DialTimeout: timing.ConnectTimeout,
 		Logger:      zapLogger,
 		LogConfig: &zap.Config{
 			Level:       zap.NewAtomicLevelAt(zap.ErrorLevel),
@@ -55,28 +67,30 @@ func (d *EtcdDiscovery) Discover(sessionHandler servicediscovery.ISessionHandler
 	client, err := clientv3.New(config)
 	if err != nil {
 		return &EtcdDiscoveryResult{
-			isDetected:      false,
-			isAuthenticated: true,
-			properties:      nil,
+			isDetected:     false,
+			authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN},
+			properties:     nil,
 		}, err
 	}
 	defer client.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	_, err = client.Get(ctx, "/")
+	getCtx, cancel := context.WithTimeout(ctx, timing.ReadTimeout)
+	_, err = client.Get(getCtx, "/")
 	cancel()
 	if err != nil {
 		return &EtcdDiscoveryResult{
-			isDetected:      false,
-			isAuthenticated: true,
-			properties:      nil,
+			isDetected:     false,
+			authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN},
+			properties:     nil,
 		}, nil
 	}
 
 	result := &EtcdDiscoveryResult{
-		isDetected:      true,
-		isAuthenticated: false,
-		properties:      nil,
+		isDetected:     true,
+		confidence:     servicediscovery.CONFIDENCE_HIGH,
+		evidence:       []string{"etcd v3 range request for key / succeeded"},
+		authentication: servicediscovery.Authentication{Status: servicediscovery.UNAUTHENTICATED, Reason: "keys readable without credentials"},
+		properties:     nil,
 	}
 
 	return result, nil
@@ -0,0 +1,311 @@
+package applicationlayerdiscovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
+)
+
+const GRPCProtocolName = "grpc"
+
+// Services whose methods are listed through reflection
+const grpcMaxServices = 32
+
+// Versions of the server reflection API, newest first. The v1alpha
+// messages have the same wire format as the v1 ones.
+var grpcReflectionMethods = []struct {
+	version string
+	method  string
+}{
+	{"v1", reflectionpb.ServerReflection_ServerReflectionInfo_FullMethodName},
+	{"v1alpha", "/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo"},
+}
+
+var errGrpcRedial = errors.New("gRPC probe connection already used")
+
+type GRPCDiscoveryResult struct {
+	isDetected     bool
+	properties     map[string]interface{}
+	authentication servicediscovery.Authentication
+	confidence     int
+	evidence       []string
+}
+
+func (r *GRPCDiscoveryResult) Protocol() string {
+	return GRPCProtocolName
+}
+
+func (r *GRPCDiscoveryResult) GetIsDetected() bool {
+	return r.isDetected
+}
+
+func (r *GRPCDiscoveryResult) GetProperties() map[string]interface{} {
+	return r.properties
+}
+
+func (r *GRPCDiscoveryResult) GetAuthentication() servicediscovery.Authentication {
+	return r.authentication
+}
+
+func (r *GRPCDiscoveryResult) GetConfidence() int {
+	return r.confidence
+}
+
+func (r *GRPCDiscoveryResult) GetEvidence() []string {
+	return r.evidence
+}
+
+type GRPCDiscovery struct {
+}
+
+func (d *GRPCDiscovery) Protocol() string {
+	return GRPCProtocolName
+}
+
+// Discover lists the services and methods of the server through server
+// reflection and calls the health check, both without credentials. The
+// server speaks gRPC when either call is answered with gRPC framing, even
+// with an error status.
+func (d *GRPCDiscovery) Discover(ctx context.Context, sessionHandler servicediscovery.ISessionHandler, presentationLayerDiscoveryResult servicediscovery.IPresentationDiscoveryResult) (servicediscovery.IApplicationDiscoveryResult, error) {
+	notDetected := &GRPCDiscoveryResult{
+		isDetected:     false,
+		authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN},
+	}
+
+	conn, err := dialGrpc(ctx, sessionHandler)
+	if err != nil {
+		return notDetected, err
+	}
+	defer conn.Close()
+
+	reflection := reflectGrpcServices(ctx, conn)
+	health := checkGrpcHealth(ctx, conn)
+	if !reflection.isGrpc && !health.isGrpc {
+		return notDetected, nil
+	}
+
+	properties := map[string]interface{}{}
+	var evidence []string
+	var unauthenticatedCalls []string
+	confidence := servicediscovery.CONFIDENCE_MEDIUM
+	if http2Result, ok := presentationLayerDiscoveryResult.(servicediscovery.IHttp2PresentationDiscoveryResult); ok {
+		if contentType := http2Result.GetHttp2Info().ContentType; isGrpcContentType(contentType) {
+			evidence = append(evidence, fmt.Sprintf("HTTP/2 answer to GET / has content type %s", contentType))
+		}
+	}
+
+	if reflection.err == nil {
+		properties["reflection"] = reflection.version
+		properties["services"] = reflection.services
+		properties["methods"] = reflection.methods
+		evidence = append(evidence, fmt.Sprintf("server reflection %s listed %d services", reflection.version, len(reflection.services)))
+		unauthenticatedCalls = append(unauthenticatedCalls, reflection.method)
+		confidence = servicediscovery.CONFIDENCE_HIGH
+	} else if reflection.isGrpc {
+		evidence = append(evidence, fmt.Sprintf("server reflection answered with gRPC status %s", status.Code(reflection.err)))
+	}
+	if health.err == nil {
+		properties["health"] = health.status
+		evidence = append(evidence, fmt.Sprintf("health check answered %s", health.status))
+		unauthenticatedCalls = append(unauthenticatedCalls, healthpb.Health_Check_FullMethodName)
+		confidence = servicediscovery.CONFIDENCE_HIGH
+	} else if health.isGrpc {
+		evidence = append(evidence, fmt.Sprintf("health check answered with gRPC status %s", status.Code(health.err)))
+	}
+	if len(unauthenticatedCalls) > 0 {
+		properties["unauthenticatedCalls"] = unauthenticatedCalls
+	}
+
+	var authentication servicediscovery.Authentication
+	switch {
+	case reflection.err == nil:
+		authentication = servicediscovery.Authentication{Status: servicediscovery.UNAUTHENTICATED, Reason: "server reflection answered without credentials"}
+	case reflection.denied() || health.denied():
+		authentication = servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATED, Reason: "calls refused without credentials"}
+	case health.err == nil:
+		authentication = servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN, Reason: "health check answered without credentials, other methods not tested"}
+	default:
+		authentication = servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN}
+	}
+
+	return &GRPCDiscoveryResult{
+		isDetected:     true,
+		properties:     properties,
+		authentication: authentication,
+		confidence:     confidence,
+		evidence:       evidence,
+	}, nil
+}
+
+// dialGrpc opens a client connection over the session, negotiating HTTP/2
+// through ALPN on TLS sessions. The session already does TLS, so the
+// connection itself is insecure.
+func dialGrpc(ctx context.Context, sessionHandler servicediscovery.ISessionHandler) (*grpc.ClientConn, error) {
+	var dialed atomic.Bool
+	dialer := func(context.Context, string) (net.Conn, error) {
+		// A probe makes a single connection. The session is connected with
+		// the probe context, as the dial context ends with the dial.
+		if !dialed.CompareAndSwap(false, true) {
+			return nil, errGrpcRedial
+		}
+		return dialSession(ctx, sessionHandler, []string{"h2"})
+	}
+	return grpc.DialContext(ctx, "passthrough:///"+servicediscovery.SessionAuthority(ctx, sessionHandler),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(dialer),
+	)
+}
+
+// grpcCall is the outcome of a call made by the probe
+type grpcCall struct {
+	// The server answered with gRPC framing, err then holds its status
+	isGrpc bool
+	err    error
+}
+
+// denied tells whether the server refused the call for lack of credentials
+func (c grpcCall) denied() bool {
+	code := status.Code(c.err)
+	return c.isGrpc && (code == codes.Unauthenticated || code == codes.PermissionDenied)
+}
+
+type grpcReflection struct {
+	grpcCall
+	version  string // Of the reflection API that answered
+	method   string
+	services []string
+	// Methods of the first grpcMaxServices services, as Service/Method
+	methods []string
+}
+
+// reflectGrpcServices lists the services of the server and their methods
+// through the newest reflection API it implements
+func reflectGrpcServices(ctx context.Context, conn *grpc.ClientConn) grpcReflection {
+	var reflection grpcReflection
+	for _, api := range grpcReflectionMethods {
+		reflection = reflectGrpcServicesWith(ctx, conn, api.method)
+		reflection.version = api.version
+		if !reflection.isGrpc || status.Code(reflection.err) != codes.Unimplemented {
+			break
+		}
+	}
+	return reflection
+}
+
+func reflectGrpcServicesWith(ctx context.Context, conn *grpc.ClientConn, method string) grpcReflection {
+	reflection := grpcReflection{method: method}
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := conn.NewStream(streamCtx, &reflectionpb.ServerReflection_ServiceDesc.Streams[0], method)
+	if err != nil {
+		reflection.err = err
+		return reflection
+	}
+	request := func(request *reflectionpb.ServerReflectionRequest) (*reflectionpb.ServerReflectionResponse, error) {
+		// io.EOF means the server ended the stream, RecvMsg returns its status
+		if err := stream.SendMsg(request); err != nil && err != io.EOF {
+			return nil, err
+		}
+		response := &reflectionpb.ServerReflectionResponse{}
+		if err := stream.RecvMsg(response); err != nil {
+			return nil, err
+		}
+		return response, nil
+	}
+
+	response, err := request(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{ListServices: "*"},
+	})
+	header, _ := stream.Header()
+	reflection.isGrpc = hasGrpcContentType(header) || hasGrpcContentType(stream.Trailer())
+	if err != nil {
+		reflection.err = err
+		return reflection
+	}
+	for _, service := range response.GetListServicesResponse().GetService() {
+		reflection.services = append(reflection.services, service.GetName())
+	}
+
+	for i, service := range reflection.services {
+		if i == grpcMaxServices || ctx.Err() != nil {
+			break
+		}
+		response, err := request(&reflectionpb.ServerReflectionRequest{
+			MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service},
+		})
+		if err != nil {
+			break
+		}
+		// The file of the service comes with the files it depends on
+		for _, file := range response.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			descriptor := &descriptorpb.FileDescriptorProto{}
+			if proto.Unmarshal(file, descriptor) != nil {
+				continue
+			}
+			for _, serviceDescriptor := range descriptor.GetService() {
+				name := serviceDescriptor.GetName()
+				if descriptor.GetPackage() != "" {
+					name = descriptor.GetPackage() + "." + name
+				}
+				if name != service {
+					continue
+				}
+				for _, methodDescriptor := range serviceDescriptor.GetMethod() {
+					reflection.methods = append(reflection.methods, service+"/"+methodDescriptor.GetName())
+				}
+			}
+		}
+	}
+	stream.CloseSend()
+	return reflection
+}
+
+type grpcHealth struct {
+	grpcCall
+	status string // Serving status of the server, such as SERVING
+}
+
+// checkGrpcHealth asks the health of the server as a whole
+func checkGrpcHealth(ctx context.Context, conn *grpc.ClientConn) grpcHealth {
+	var header, trailer metadata.MD
+	response, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}, grpc.Header(&header), grpc.Trailer(&trailer))
+	health := grpcHealth{grpcCall: grpcCall{isGrpc: hasGrpcContentType(header) || hasGrpcContentType(trailer), err: err}}
+	if err == nil {
+		health.status = response.GetStatus().String()
+	}
+	return health
+}
+
+// hasGrpcContentType tells whether response metadata holds a gRPC content
+// type. The client keeps it only when the server answered with gRPC, other
+// HTTP/2 answers are turned into statuses such as Unimplemented for 404.
+func hasGrpcContentType(md metadata.MD) bool {
+	for _, contentType := range md.Get("content-type") {
+		if isGrpcContentType(contentType) {
+			return true
+		}
+	}
+	return false
+}
+
+// isGrpcContentType tells whether contentType is application/grpc, possibly
+// with a subtype such as +proto
+func isGrpcContentType(contentType string) bool {
+	return contentType == "application/grpc" || strings.HasPrefix(contentType, "application/grpc+") || strings.HasPrefix(contentType, "application/grpc;")
+}
@@ -0,0 +1,109 @@
+package applicationlayerdiscovery_test
+
+import (
+	"context"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery/applicationlayerdiscovery"
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery/sessionlayerdiscovery"
+)
+
+// startGrpcServer serves reflection and health checks on a loopback port
+func startGrpcServer(t *testing.T, options ...grpc.ServerOption) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer(options...)
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	reflection.Register(server)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func discoverGrpc(t *testing.T, port int) servicediscovery.IApplicationDiscoveryResult {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	session, err := (&sessionlayerdiscovery.TcpSessionDiscovery{}).SessionLayerDiscover(ctx, "127.0.0.1", port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionHandler, err := session.GetSessionHandler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := (&applicationlayerdiscovery.GRPCDiscovery{}).Discover(ctx, sessionHandler, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestGRPCDiscoveryUnauthenticated(t *testing.T) {
+	result := discoverGrpc(t, startGrpcServer(t))
+
+	if !result.GetIsDetected() {
+		t.Fatal("gRPC server not detected")
+	}
+	if status := result.GetAuthentication().Status; status != servicediscovery.UNAUTHENTICATED {
+		t.Errorf("authentication status %s, want %s", status, servicediscovery.UNAUTHENTICATED)
+	}
+	properties := result.GetProperties()
+	if properties["reflection"] != "v1" {
+		t.Errorf("reflection %v, want v1", properties["reflection"])
+	}
+	services, _ := properties["services"].([]string)
+	for _, service := range []string{"grpc.health.v1.Health", "grpc.reflection.v1.ServerReflection"} {
+		if !slices.Contains(services, service) {
+			t.Errorf("services %v do not list %s", services, service)
+		}
+	}
+	methods, _ := properties["methods"].([]string)
+	if !slices.Contains(methods, "grpc.health.v1.Health/Check") {
+		t.Errorf("methods %v do not list grpc.health.v1.Health/Check", methods)
+	}
+	if properties["health"] != healthpb.HealthCheckResponse_SERVING.String() {
+		t.Errorf("health %v, want SERVING", properties["health"])
+	}
+	calls, _ := properties["unauthenticatedCalls"].([]string)
+	want := []string{reflectionpb.ServerReflection_ServerReflectionInfo_FullMethodName, healthpb.Health_Check_FullMethodName}
+	if !slices.Equal(calls, want) {
+		t.Errorf("unauthenticated calls %v, want %v", calls, want)
+	}
+}
+
+func TestGRPCDiscoveryAuthenticated(t *testing.T) {
+	// Every call is refused without credentials
+	refuse := grpc.ChainStreamInterceptor(func(interface{}, grpc.ServerStream, *grpc.StreamServerInfo, grpc.StreamHandler) error {
+		return status.Error(codes.Unauthenticated, "no credentials")
+	})
+	refuseUnary := grpc.ChainUnaryInterceptor(func(context.Context, interface{}, *grpc.UnaryServerInfo, grpc.UnaryHandler) (interface{}, error) {
+		return nil, status.Error(codes.Unauthenticated, "no credentials")
+	})
+	result := discoverGrpc(t, startGrpcServer(t, refuse, refuseUnary))
+
+	if !result.GetIsDetected() {
+		t.Fatal("gRPC server not detected")
+	}
+	if status := result.GetAuthentication().Status; status != servicediscovery.AUTHENTICATED {
+		t.Errorf("authentication status %s, want %s", status, servicediscovery.AUTHENTICATED)
+	}
+	if _, ok := result.GetProperties()["unauthenticatedCalls"]; ok {
+		t.Errorf("unauthenticated calls reported: %v", result.GetProperties()["unauthenticatedCalls"])
+	}
+}
@@ -0,0 +1,26 @@
+package applicationlayerdiscovery
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
+)
+
+// httpFingerprint returns the answer to GET / parsed by the presentation
+// layer. ok is false when the presentation layer is not HTTP.
+func httpFingerprint(presentationLayerDiscoveryResult servicediscovery.IPresentationDiscoveryResult) (servicediscovery.HttpFingerprint, bool) {
+	httpResult, ok := presentationLayerDiscoveryResult.(servicediscovery.IHttpPresentationDiscoveryResult)
+	if !ok || !httpResult.GetIsDetected() {
+		return servicediscovery.HttpFingerprint{}, false
+	}
+	return httpResult.GetFingerprint(), true
+}
+
+// isJsonResponse tells whether the content type of headers is JSON, such as
+// application/json or application/vnd.elasticsearch+json
+func isJsonResponse(headers http.Header) bool {
+	contentType, _, _ := strings.Cut(headers.Get("Content-Type"), ";")
+	contentType = strings.TrimSpace(contentType)
+	return contentType == "application/json" || strings.HasSuffix(contentType, "+json")
+}
@@ -0,0 +1,121 @@
+package applicationlayerdiscovery
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
+)
+
+const IMAPProtocolName = "imap"
+
+type IMAPDiscoveryResult struct {
+	isDetected     bool
+	properties     map[string]interface{}
+	authentication servicediscovery.Authentication
+	confidence     int
+	evidence       []string
+}
+
+func (r *IMAPDiscoveryResult) Protocol() string {
+	return IMAPProtocolName
+}
+
+func (r *IMAPDiscoveryResult) GetIsDetected() bool {
+	return r.isDetected
+}
+
+func (r *IMAPDiscoveryResult) GetProperties() map[string]interface{} {
+	return r.properties
+}
+
+func (r *IMAPDiscoveryResult) GetAuthentication() servicediscovery.Authentication {
+	return r.authentication
+}
+
+func (r *IMAPDiscoveryResult) GetConfidence() int {
+	return r.confidence
+}
+
+func (r *IMAPDiscoveryResult) GetEvidence() []string {
+	return r.evidence
+}
+
+type IMAPDiscovery struct {
+}
+
+func (d *IMAPDiscovery) Protocol() string {
+	return IMAPProtocolName
+}
+
+// Discover reads the untagged greeting and asks for the capabilities. A
+// PREAUTH greeting opens the mailbox without a login.
+func (d *IMAPDiscovery) Discover(ctx context.Context, sessionHandler servicediscovery.ISessionHandler, presentationLayerDiscoveryResult servicediscovery.IPresentationDiscoveryResult) (servicediscovery.IApplicationDiscoveryResult, error) {
+	notDetected := &IMAPDiscoveryResult{
+		isDetected:     false,
+		authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN},
+	}
+
+	err := sessionHandler.Connect(ctx)
+	if err != nil {
+		return notDetected, err
+	}
+	defer sessionHandler.Destory()
+
+	data, err := readUntil(sessionHandler, nil, func(data []byte) bool {
+		return bytes.IndexByte(data, '\n') >= 0
+	})
+	if err != nil {
+		return notDetected, err
+	}
+	greeting := strings.TrimRight(string(data[:bytes.IndexByte(data, '\n')]), "\r")
+	preauth := strings.HasPrefix(greeting, "* PREAUTH")
+	if !preauth && !strings.HasPrefix(greeting, "* OK") {
+		return notDetected, nil
+	}
+
+	properties := map[string]interface{}{
+		"banner": greeting,
+	}
+	if _, err = sessionHandler.Write([]byte("a1 CAPABILITY\r\n")); err == nil {
+		data, err = readUntil(sessionHandler, nil, isCompleteIMAPResponse("a1"))
+		if err == nil {
+			for _, line := range strings.Split(string(data), "\n") {
+				if capabilities, ok := strings.CutPrefix(strings.TrimRight(line, "\r"), "* CAPABILITY "); ok {
+					properties["capabilities"] = strings.Fields(capabilities)
+				}
+			}
+		}
+		sessionHandler.Write([]byte("a2 LOGOUT\r\n"))
+	}
+
+	authentication := servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATED, Reason: "login required"}
+	if preauth {
+		authentication = servicediscovery.Authentication{Status: servicediscovery.UNAUTHENTICATED, Reason: "PREAUTH greeting, no login required"}
+	}
+	return &IMAPDiscoveryResult{
+		isDetected:     true,
+		confidence:     servicediscovery.CONFIDENCE_HIGH,
+		evidence:       []string{fmt.Sprintf("IMAP greeting %q", greeting)},
+		authentication: authentication,
+		properties:     properties,
+	}, nil
+}
+
+// isCompleteIMAPResponse accepts the data once the tagged completion of the
+// command with the given tag was read
+func isCompleteIMAPResponse(tag string) func([]byte) bool {
+	return func(data []byte) bool {
+		if len(data) == 0 || data[len(data)-1] != '\n' {
+			return false
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if strings.HasPrefix(line, tag+" ") {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -1,8 +1,9 @@
 package applicationlayerdiscovery
 
 import (
-	"fmt"
-	"time"
+	"context"
+	"net"
+	"strconv"
 
 	log "github.com/sirupsen/logrus"
 
@@ -12,9 +13,11 @@ import (
 )
 
 type KafkaDiscoveryResult struct {
-	isDetected      bool
-	properties      map[string]interface{}
-	isAuthenticated bool
+	isDetected     bool
+	properties     map[string]interface{}
+	authentication servicediscovery.Authentication
+	confidence     int
+	evidence       []string
 }
 
 func (r *KafkaDiscoveryResult) Protocol() string {
@@ -29,8 +32,16 @@ func (r *KafkaDiscoveryResult) GetProperties() map[string]interface{} {
 	return r.properties
 }
 
-func (r *KafkaDiscoveryResult) GetIsAuthRequired() bool {
-	return r.isAuthenticated
+func (r *KafkaDiscoveryResult) GetAuthentication() servicediscovery.Authentication {
+	return r.authentication
+}
+
+func (r *KafkaDiscoveryResult) GetConfidence() int {
+	return r.confidence
+}
+
+func (r *KafkaDiscoveryResult) GetEvidence() []string {
+	return r.evidence
 }
 
 type KafkaDiscovery struct {
@@ -40,28 +51,34 @@ func (k *KafkaDiscovery) Protocol() string {
 	return "kafka"
 }
 
-func (k *KafkaDiscovery) Discover(sessionHandler servicediscovery.ISessionHandler, presentationLayerDiscoveryResult servicediscovery.IPresentationDiscoveryResult) (servicediscovery.IApplicationDiscoveryResult, error) {
+func (k *KafkaDiscovery) Discover(ctx context.Context, sessionHandler servicediscovery.ISessionHandler, presentationLayerDiscoveryResult servicediscovery.IPresentationDiscoveryResult) (servicediscovery.IApplicationDiscoveryResult, error) {
 	// Set the Kafka broker addresses
-	brokerList := []string{fmt.Sprintf("%s:%d", sessionHandler.GetHost(), sessionHandler.GetPort())}
+	brokerList := []string{net.JoinHostPort(sessionHandler.GetHost(), strconv.Itoa(sessionHandler.GetPort()))}
 
 	// Configure the producer
 	config := sarama.NewConfig()
 	config.Producer.RequiredAcks = sarama.WaitForAll
-	// add a more strict connection timeout
-	config.Net.ReadTimeout = 10 * time.Second
-	config.Net.WriteTimeout = 10 * time.Second
-	config.Producer.Retry.Max = 1
-	config.Producer.Timeout = 500 * time.Millisecond
+	// Timeouts and retries from the discovery timing
+	timing := servicediscovery.TimingFromContext(ctx)
+	config.Net.DialTimeout = timing.ConnectTimeout
+	config.Net.ReadTimeout = timing.ReadTimeout
+	config.Net.WriteTimeout = timing.ReadTimeout
+	config.Metadata.Retry.Max = timing.Retries
+	config.Producer.Retry.Max = timing.Retries
+	config.Producer.Timeout = timing.ReadTimeout
 	config.Producer.Return.Successes = true
+	// Tie broker connections to the probe context
+	config.Net.Proxy.Enable = true
+	config.Net.Proxy.Dialer = newContextDialer(ctx, config.Net.DialTimeout)
 
 	// Create a new SyncProducer
 	producer, err := sarama.NewSyncProducer(brokerList, config)
 
 	if err != nil {
 		return &KafkaDiscoveryResult{
-			isDetected:      false,
-			isAuthenticated: true,
-			properties:      nil, // Set properties to nil as it's not used in this case
+			isDetected:     false,
+			authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN},
+			properties:     nil, // Set properties to nil as it's not used in this case
 		}, err
 	}
 
@@ -73,8 +90,10 @@ func (k *KafkaDiscovery) Discover(sessionHandler servicediscovery.ISessionHandle
 
 	// Create Kafka discovery result
 	return &KafkaDiscoveryResult{
-		isDetected:      true,
-		isAuthenticated: false,
-		properties:      nil, // Set properties to nil as it's not used in this case
+		isDetected:     true,
+		confidence:     servicediscovery.CONFIDENCE_HIGH,
+		evidence:       []string{"Kafka broker answered the metadata request of a producer"},
+		authentication: servicediscovery.Authentication{Status: servicediscovery.UNAUTHENTICATED, Reason: "broker metadata readable without credentials"},
+		properties:     nil, // Set properties to nil as it's not used in this case
 	}, nil
 }
@@ -1,13 +1,11 @@
 package applicationlayerdiscovery
 
 import (
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"strings"
-	"time"
 
 	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
 )
@@ -15,7 +13,9 @@ import (
 type KubeApiServerDiscoveryResult struct {
 	isDetected     bool
 	properties     map[string]interface{}
-	isAuthRequired bool
+	authentication servicediscovery.Authentication
+	confidence     int
+	evidence       []string
 }
 
 func (r *KubeApiServerDiscoveryResult) Protocol() string {
@@ -30,8 +30,16 @@ func (r *KubeApiServerDiscoveryResult) GetProperties() map[string]interface{} {
 	return r.properties
 }
 
-func (r *KubeApiServerDiscoveryResult) GetIsAuthRequired() bool {
-	return r.isAuthRequired
+func (r *KubeApiServerDiscoveryResult) GetAuthentication() servicediscovery.Authentication {
+	return r.authentication
+}
+
+func (r *KubeApiServerDiscoveryResult) GetConfidence() int {
+	return r.confidence
+}
+
+func (r *KubeApiServerDiscoveryResult) GetEvidence() []string {
+	return r.evidence
 }
 
 type KubeApiServerDiscovery struct {
@@ -41,72 +49,74 @@ func (d *KubeApiServerDiscovery) Protocol() string {
 	return "Kubernetes API server"
 }
 
-func (d *KubeApiServerDiscovery) Discover(sessionHandler servicediscovery.ISessionHandler, presentationLayerDiscoveryResult servicediscovery.IPresentationDiscoveryResult) (servicediscovery.IApplicationDiscoveryResult, error) {
-	url := fmt.Sprintf("https://%s:%d/api", sessionHandler.GetHost(), sessionHandler.GetPort())
-
-	// Create a custom transport with insecure skip verify
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+// Discover sends GET /api over the session, in the scheme of the session
+// layer. The Kubernetes API server answers every request with JSON, so
+// servers whose answer to GET / was not JSON are left out.
+func (d *KubeApiServerDiscovery) Discover(ctx context.Context, sessionHandler servicediscovery.ISessionHandler, presentationLayerDiscoveryResult servicediscovery.IPresentationDiscoveryResult) (servicediscovery.IApplicationDiscoveryResult, error) {
+	notDetected := &KubeApiServerDiscoveryResult{
+		isDetected:     false,
+		authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN},
+		properties:     nil,
 	}
-
-	// Create an http.Client with the custom transport
-	client := &http.Client{Transport: tr, Timeout: time.Millisecond * 500}
+	fingerprint, ok := httpFingerprint(presentationLayerDiscoveryResult)
+	if !ok || !isJsonResponse(http.Header(fingerprint.Headers)) {
+		return notDetected, nil
+	}
+	client := servicediscovery.NewHttpClient(ctx, sessionHandler)
+	url := client.URL() + "/api"
 
 	// Send a GET request to the Kubernetes API server
-	resp, err := client.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.StdClient().Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request to Kubernetes API server: %v", err)
 	}
 	defer resp.Body.Close()
 
-	// Check the response status code
-	if resp.StatusCode == http.StatusOK {
-		// Check if the response body contains the Kubernetes API server version
-		if resp.Header.Get("kind") == "APIVersions" {
-			// Kubernetes API server is detected and not authenticated
-			result := &KubeApiServerDiscoveryResult{
-				isDetected:     true,
-				isAuthRequired: false,
-				properties: map[string]interface{}{
-					"url": url,
-				},
-			}
-			return result, nil
+	// Both the API versions and the Status objects of errors are JSON
+	if !isJsonResponse(resp.Header) {
+		return notDetected, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %v", err)
+	}
+	var responseJSON map[string]interface{}
+	if err := json.Unmarshal(body, &responseJSON); err != nil {
+		return notDetected, nil
+	}
+	kind, _ := responseJSON["kind"].(string)
+
+	if resp.StatusCode == http.StatusOK && kind == "APIVersions" {
+		// Kubernetes API server is detected and not authenticated
+		result := &KubeApiServerDiscoveryResult{
+			isDetected:     true,
+			confidence:     servicediscovery.CONFIDENCE_HIGH,
+			evidence:       []string{"GET /api returned APIVersions"},
+			authentication: servicediscovery.Authentication{Status: servicediscovery.UNAUTHENTICATED, Reason: "anonymous GET /api allowed"},
+			properties: map[string]interface{}{
+				"url": url,
+			},
 		}
-	} else if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
-		// Check if the response is in JSON format
-		contentType := resp.Header.Get("Content-Type")
-		if strings.HasPrefix(contentType, "application/json") {
-			// Convert body to struct
-			body, err := io.ReadAll(resp.Body)
-			if err != nil {
-				return nil, fmt.Errorf("failed to read response body: %v", err)
-			}
-
-			var responseJSON map[string]interface{}
-			err = json.Unmarshal(body, &responseJSON)
-			if err != nil {
-				return nil, fmt.Errorf("failed to parse JSON response: %v", err)
-			}
-
-			kind, ok := responseJSON["kind"].(string)
-			if ok && kind == "Status" {
-				// Kubernetes API server is detected and authenticated
-				result := &KubeApiServerDiscoveryResult{
-					isDetected:     true,
-					isAuthRequired: true,
-					properties:     nil,
-				}
-				return result, nil
-			}
+		return result, nil
+	}
+	if (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) && kind == "Status" {
+		// Kubernetes API server is detected and authenticated. A 403 is
+		// an authorization denial, no data is returned without credentials
+		// either.
+		result := &KubeApiServerDiscoveryResult{
+			isDetected:     true,
+			confidence:     servicediscovery.CONFIDENCE_HIGH,
+			evidence:       []string{fmt.Sprintf("GET /api returned HTTP %d with a Kubernetes Status object", resp.StatusCode)},
+			authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATED, Reason: fmt.Sprintf("anonymous GET /api rejected with HTTP %d", resp.StatusCode)},
+			properties:     nil,
 		}
+		return result, nil
 	}
 
-	// If the response status is neither OK (200) nor Unauthorized (401), the Kubernetes API server is not detected
-	result := &KubeApiServerDiscoveryResult{
-		isDetected:     false,
-		isAuthRequired: true,
-		properties:     nil,
-	}
-	return result, nil
+	// Neither the API versions nor a Status object, the Kubernetes API server is not detected
+	return notDetected, nil
 }
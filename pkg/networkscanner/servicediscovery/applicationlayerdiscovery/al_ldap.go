@@ -0,0 +1,270 @@
+package applicationlayerdiscovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
+)
+
+const LDAPProtocolName = "ldap"
+
+// LDAP protocol operations and result codes
+const (
+	ldapSearchRequest                 = 0x63 // [APPLICATION 3]
+	ldapSearchResultEntry             = 0x64 // [APPLICATION 4]
+	ldapSearchResultDone              = 0x65 // [APPLICATION 5]
+	ldapPresentFilter                 = 0x87 // [CONTEXT 7]
+	ldapResultSuccess                 = 0
+	ldapResultConfidentialityRequired = 13
+	ldapResultInappropriateAuth       = 48
+	ldapResultInsufficientAccess      = 50
+)
+
+// Search result entries read before the search result done
+const ldapMaxSearchMessages = 10
+
+// Attributes of the root DSE that describe the server
+var ldapRootDseAttributes = []string{
+	"namingContexts",
+	"supportedLDAPVersion",
+	"vendorName",
+	"vendorVersion",
+	"supportedExtension",
+	"supportedSASLMechanisms",
+}
+
+type LDAPDiscoveryResult struct {
+	isDetected     bool
+	properties     map[string]interface{}
+	authentication servicediscovery.Authentication
+	confidence     int
+	evidence       []string
+}
+
+func (r *LDAPDiscoveryResult) Protocol() string {
+	return LDAPProtocolName
+}
+
+func (r *LDAPDiscoveryResult) GetIsDetected() bool {
+	return r.isDetected
+}
+
+func (r *LDAPDiscoveryResult) GetProperties() map[string]interface{} {
+	return r.properties
+}
+
+func (r *LDAPDiscoveryResult) GetAuthentication() servicediscovery.Authentication {
+	return r.authentication
+}
+
+func (r *LDAPDiscoveryResult) GetConfidence() int {
+	return r.confidence
+}
+
+func (r *LDAPDiscoveryResult) GetEvidence() []string {
+	return r.evidence
+}
+
+type LDAPDiscovery struct {
+}
+
+func (d *LDAPDiscovery) Protocol() string {
+	return LDAPProtocolName
+}
+
+// Discover searches the root DSE without binding. Servers that require TLS
+// refuse the search with confidentialityRequired, which still detects them.
+func (d *LDAPDiscovery) Discover(ctx context.Context, sessionHandler servicediscovery.ISessionHandler, presentationLayerDiscoveryResult servicediscovery.IPresentationDiscoveryResult) (servicediscovery.IApplicationDiscoveryResult, error) {
+	notDetected := &LDAPDiscoveryResult{
+		isDetected:     false,
+		authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN},
+	}
+
+	err := sessionHandler.Connect(ctx)
+	if err != nil {
+		return notDetected, err
+	}
+	defer sessionHandler.Destory()
+
+	if _, err = sessionHandler.Write(ldapRootDseSearch()); err != nil {
+		return notDetected, err
+	}
+	data, err := readUntil(sessionHandler, nil, isCompleteLDAPSearch)
+	if err != nil {
+		return notDetected, err
+	}
+	attributes, code, err := parseLDAPSearch(data)
+	if err != nil {
+		return notDetected, nil
+	}
+
+	switch code {
+	case ldapResultSuccess:
+	case ldapResultConfidentialityRequired:
+		return &LDAPDiscoveryResult{
+			isDetected:     true,
+			confidence:     servicediscovery.CONFIDENCE_HIGH,
+			evidence:       []string{"root DSE search refused with confidentialityRequired"},
+			authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN, Reason: "confidentiality required before any operation"},
+		}, nil
+	case ldapResultInappropriateAuth, ldapResultInsufficientAccess:
+		return &LDAPDiscoveryResult{
+			isDetected:     true,
+			confidence:     servicediscovery.CONFIDENCE_HIGH,
+			evidence:       []string{fmt.Sprintf("root DSE search refused with result code %d", code)},
+			authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATED, Reason: "anonymous search refused"},
+		}, nil
+	default:
+		return &LDAPDiscoveryResult{
+			isDetected:     true,
+			confidence:     servicediscovery.CONFIDENCE_MEDIUM,
+			evidence:       []string{fmt.Sprintf("root DSE search answered with result code %d", code)},
+			authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN},
+		}, nil
+	}
+
+	properties := map[string]interface{}{}
+	for name, values := range attributes {
+		properties[name] = values
+	}
+	// The root DSE is readable anonymously on most servers, so this tells
+	// nothing about the directory itself
+	return &LDAPDiscoveryResult{
+		isDetected:     true,
+		confidence:     servicediscovery.CONFIDENCE_HIGH,
+		evidence:       []string{"anonymous root DSE search succeeded"},
+		authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN, Reason: "root DSE readable anonymously, directory access not tested"},
+		properties:     properties,
+	}, nil
+}
+
+// berElement encodes a BER element with a definite length
+func berElement(tag byte, content ...[]byte) []byte {
+	var body []byte
+	for _, part := range content {
+		body = append(body, part...)
+	}
+	element := []byte{tag}
+	switch length := len(body); {
+	case length < 0x80:
+		element = append(element, byte(length))
+	case length < 0x100:
+		element = append(element, 0x81, byte(length))
+	default:
+		element = append(element, 0x82, byte(length>>8), byte(length))
+	}
+	return append(element, body...)
+}
+
+// ldapRootDseSearch builds the search of the root DSE with message ID 1
+func ldapRootDseSearch() []byte {
+	var attributes [][]byte
+	for _, attribute := range ldapRootDseAttributes {
+		attributes = append(attributes, berElement(servicediscovery.BER_OCTET_STRING, []byte(attribute)))
+	}
+	search := berElement(ldapSearchRequest,
+		berElement(servicediscovery.BER_OCTET_STRING),          // Empty base object
+		berElement(servicediscovery.BER_ENUMERATED, []byte{0}), // Base object scope
+		berElement(servicediscovery.BER_ENUMERATED, []byte{0}), // Never dereference aliases
+		berElement(servicediscovery.BER_INTEGER, []byte{0}),    // No size limit
+		berElement(servicediscovery.BER_INTEGER, []byte{0}),    // No time limit
+		[]byte{0x01, 0x01, 0x00},                               // Types and values
+		berElement(ldapPresentFilter, []byte("objectClass")),
+		berElement(servicediscovery.BER_SEQUENCE, attributes...),
+	)
+	return berElement(servicediscovery.BER_SEQUENCE, berElement(servicediscovery.BER_INTEGER, []byte{1}), search)
+}
+
+// isCompleteLDAPSearch accepts the data once it holds the search result
+// done message, or anything that is not LDAP so that the read stops early
+func isCompleteLDAPSearch(data []byte) bool {
+	for len(data) > 0 {
+		if data[0] != servicediscovery.BER_SEQUENCE {
+			return true
+		}
+		_, message, rest, err := servicediscovery.ReadBER(data)
+		if err != nil {
+			return false
+		}
+		if _, _, operation, err := servicediscovery.ReadBER(message); err != nil || len(operation) == 0 || operation[0] == ldapSearchResultDone {
+			return true
+		}
+		data = rest
+	}
+	return false
+}
+
+// parseLDAPSearch returns the attributes of the search result entries and
+// the result code of the search
+func parseLDAPSearch(data []byte) (map[string][]string, int, error) {
+	attributes := map[string][]string{}
+	for i := 0; i < ldapMaxSearchMessages && len(data) > 0; i++ {
+		tag, message, rest, err := servicediscovery.ReadBER(data)
+		if err != nil || tag != servicediscovery.BER_SEQUENCE {
+			return nil, 0, errors.New("not an LDAP message")
+		}
+		data = rest
+		tag, _, message, err = servicediscovery.ReadBER(message)
+		if err != nil || tag != servicediscovery.BER_INTEGER {
+			return nil, 0, errors.New("no LDAP message ID")
+		}
+		tag, operation, _, err := servicediscovery.ReadBER(message)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		switch tag {
+		case ldapSearchResultEntry:
+			if err := parseLDAPEntry(operation, attributes); err != nil {
+				return nil, 0, err
+			}
+		case ldapSearchResultDone:
+			tag, code, _, err := servicediscovery.ReadBER(operation)
+			if err != nil || tag != servicediscovery.BER_ENUMERATED {
+				return nil, 0, errors.New("malformed LDAP result")
+			}
+			resultCode, err := servicediscovery.BERInt(code)
+			return attributes, resultCode, err
+		default:
+			return nil, 0, fmt.Errorf("unexpected LDAP operation %#x", tag)
+		}
+	}
+	return nil, 0, errors.New("no LDAP search result done")
+}
+
+// parseLDAPEntry adds the attributes of a search result entry
+func parseLDAPEntry(entry []byte, attributes map[string][]string) error {
+	// Object name, then the attribute list
+	_, _, rest, err := servicediscovery.ReadBER(entry)
+	if err != nil {
+		return err
+	}
+	_, list, _, err := servicediscovery.ReadBER(rest)
+	if err != nil {
+		return err
+	}
+	for len(list) > 0 {
+		var attribute []byte
+		if _, attribute, list, err = servicediscovery.ReadBER(list); err != nil {
+			return err
+		}
+		_, name, values, err := servicediscovery.ReadBER(attribute)
+		if err != nil {
+			return err
+		}
+		_, values, _, err = servicediscovery.ReadBER(values)
+		if err != nil {
+			return err
+		}
+		for len(values) > 0 {
+			var value []byte
+			if _, value, values, err = servicediscovery.ReadBER(values); err != nil {
+				return err
+			}
+			attributes[string(name)] = append(attributes[string(name)], string(value))
+		}
+	}
+	return nil
+}
@@ -81,4 +81,74 @@ var ApplicationDiscoveryList = []ApplicationDiscoveryListItem{
 			9042,
 		},
 	},
+	{
+		Discovery:  &SMTPDiscovery{},
+		Reqirement: string(servicediscovery.TCP),
+		CommonPorts: []int{
+			25, 465, 587,
+		},
+	},
+	{
+		Discovery:  &IMAPDiscovery{},
+		Reqirement: string(servicediscovery.TCP),
+		CommonPorts: []int{
+			143, 993,
+		},
+	},
+	{
+		Discovery:  &XMPPDiscovery{},
+		Reqirement: string(servicediscovery.TCP),
+		CommonPorts: []int{
+			5222,
+		},
+	},
+	{
+		Discovery:  &LDAPDiscovery{},
+		Reqirement: string(servicediscovery.TCP),
+		CommonPorts: []int{
+			389, 636,
+		},
+	},
+	{
+		// After the services built on gRPC, such as etcd
+		Discovery:  &GRPCDiscovery{},
+		Reqirement: string(servicediscovery.TCP),
+		CommonPorts: []int{
+			50051,
+		},
+	},
+	{
+		Discovery:  &DNSDiscovery{},
+		Reqirement: string(servicediscovery.UDP),
+		CommonPorts: []int{
+			53, 5353,
+		},
+	},
+	{
+		Discovery:  &SNMPDiscovery{},
+		Reqirement: string(servicediscovery.UDP),
+		CommonPorts: []int{
+			161,
+		},
+	},
+	{
+		Discovery:  &NTPDiscovery{},
+		Reqirement: string(servicediscovery.UDP),
+		CommonPorts: []int{
+			123,
+		},
+	},
+	{
+		Discovery:  &MemcachedDiscovery{},
+		Reqirement: string(servicediscovery.UDP),
+		CommonPorts: []int{
+			11211,
+		},
+	},
+	{
+		// Detects silent ports, so it comes last
+		Discovery:   &StatsDDiscovery{},
+		Reqirement:  string(servicediscovery.UDP),
+		CommonPorts: statsdPorts,
+	},
 }
@@ -0,0 +1,97 @@
+package applicationlayerdiscovery
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
+)
+
+const (
+	MemcachedProtocolName = "memcached"
+	memcachedFrameSize    = 8
+)
+
+// UDP frame header (request ID, sequence number 0, one datagram, reserved)
+// followed by the version command
+var memcachedVersionRequest = append([]byte{0x6d, 0x63, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00}, []byte("version\r\n")...)
+
+type MemcachedDiscoveryResult struct {
+	isDetected     bool
+	properties     map[string]interface{}
+	authentication servicediscovery.Authentication
+	confidence     int
+	evidence       []string
+}
+
+func (r *MemcachedDiscoveryResult) Protocol() string {
+	return MemcachedProtocolName
+}
+
+func (r *MemcachedDiscoveryResult) GetIsDetected() bool {
+	return r.isDetected
+}
+
+func (r *MemcachedDiscoveryResult) GetProperties() map[string]interface{} {
+	return r.properties
+}
+
+func (r *MemcachedDiscoveryResult) GetAuthentication() servicediscovery.Authentication {
+	return r.authentication
+}
+
+func (r *MemcachedDiscoveryResult) GetConfidence() int {
+	return r.confidence
+}
+
+func (r *MemcachedDiscoveryResult) GetEvidence() []string {
+	return r.evidence
+}
+
+type MemcachedDiscovery struct {
+}
+
+func (d *MemcachedDiscovery) Protocol() string {
+	return MemcachedProtocolName
+}
+
+func (d *MemcachedDiscovery) Discover(ctx context.Context, sessionHandler servicediscovery.ISessionHandler, presentationLayerDiscoveryResult servicediscovery.IPresentationDiscoveryResult) (servicediscovery.IApplicationDiscoveryResult, error) {
+	response, err := exchangeDatagram(ctx, sessionHandler, memcachedVersionRequest, isMemcachedResponse)
+	if err != nil {
+		return &MemcachedDiscoveryResult{
+			isDetected:     false,
+			authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN},
+		}, err
+	}
+
+	payload := string(response[memcachedFrameSize:])
+	if !strings.HasPrefix(payload, "VERSION ") {
+		// The frame header matches but the command was not answered
+		return &MemcachedDiscoveryResult{
+			isDetected:     true,
+			confidence:     servicediscovery.CONFIDENCE_MEDIUM,
+			evidence:       []string{fmt.Sprintf("memcached UDP frame with %q in response to the version command", strings.TrimSpace(payload))},
+			authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN, Reason: "version command not answered"},
+		}, nil
+	}
+
+	return &MemcachedDiscoveryResult{
+		isDetected:     true,
+		confidence:     servicediscovery.CONFIDENCE_HIGH,
+		evidence:       []string{"VERSION answer to the version command"},
+		authentication: servicediscovery.Authentication{Status: servicediscovery.UNAUTHENTICATED, Reason: "version command answered without credentials"},
+		properties: map[string]interface{}{
+			"version": strings.TrimSpace(strings.TrimPrefix(payload, "VERSION ")),
+		},
+	}, nil
+}
+
+// isMemcachedResponse tells whether datagram is the first UDP frame
+// answering memcachedVersionRequest
+func isMemcachedResponse(datagram []byte) bool {
+	return len(datagram) > memcachedFrameSize &&
+		bytes.Equal(datagram[0:2], memcachedVersionRequest[0:2]) && // request ID
+		datagram[2] == 0 && datagram[3] == 0 // sequence number
+}
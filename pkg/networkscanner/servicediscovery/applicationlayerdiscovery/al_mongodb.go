@@ -2,8 +2,9 @@ package applicationlayerdiscovery
 
 import (
 	"context"
-	"fmt"
-	"time"
+	"errors"
+	"net"
+	"strconv"
 
 	log "github.com/sirupsen/logrus"
 
@@ -14,10 +15,15 @@ import (
 	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
 )
 
+// Error code of commands refused for lack of authentication
+const mongoUnauthorizedCode = 13
+
 type MongoDBDiscoveryResult struct {
-	isDetected      bool
-	properties      map[string]interface{}
-	isAuthenticated bool
+	isDetected     bool
+	properties     map[string]interface{}
+	authentication servicediscovery.Authentication
+	confidence     int
+	evidence       []string
 }
 
 func (r *MongoDBDiscoveryResult) Protocol() string {
@@ -32,8 +38,16 @@ func (r *MongoDBDiscoveryResult) GetProperties() map[string]interface{} {
 	return r.properties
 }
 
-func (r *MongoDBDiscoveryResult) GetIsAuthRequired() bool {
-	return r.isAuthenticated
+func (r *MongoDBDiscoveryResult) GetAuthentication() servicediscovery.Authentication {
+	return r.authentication
+}
+
+func (r *MongoDBDiscoveryResult) GetConfidence() int {
+	return r.confidence
+}
+
+func (r *MongoDBDiscoveryResult) GetEvidence() []string {
+	return r.evidence
 }
 
 type MongoDBDiscovery struct {
@@ -43,26 +57,28 @@ func (d *MongoDBDiscovery) Protocol() string {
 	return "mongodb"
 }
 
-func (d *MongoDBDiscovery) Discover(sessionHandler servicediscovery.ISessionHandler, presentationLayerDiscoveryResult servicediscovery.IPresentationDiscoveryResult) (servicediscovery.IApplicationDiscoveryResult, error) {
-	clientOptions := options.Client().ApplyURI(fmt.Sprintf("mongodb://%s:%d", sessionHandler.GetHost(), sessionHandler.GetPort()))
-	connectionTimeout := 500 * time.Millisecond
-	clientOptions.Timeout = &connectionTimeout
-	ctx := context.Background()
+func (d *MongoDBDiscovery) Discover(ctx context.Context, sessionHandler servicediscovery.ISessionHandler, presentationLayerDiscoveryResult servicediscovery.IPresentationDiscoveryResult) (servicediscovery.IApplicationDiscoveryResult, error) {
+	clientOptions := options.Client().ApplyURI("mongodb://" + net.JoinHostPort(sessionHandler.GetHost(), strconv.Itoa(sessionHandler.GetPort())))
+	timing := servicediscovery.TimingFromContext(ctx)
+	clientOptions.SetConnectTimeout(timing.ConnectTimeout)
+	clientOptions.SetTimeout(timing.ReadTimeout)
 	client, err := mongo.Connect(ctx, clientOptions)
-	defer client.Disconnect(ctx)
 	if err != nil {
 		return &MongoDBDiscoveryResult{
-			isDetected:      false,
-			isAuthenticated: true,
-			properties:      nil, // Set properties to nil as it's not used in this case
+			isDetected:     false,
+			authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN},
+			properties:     nil, // Set properties to nil as it's not used in this case
 		}, nil
 	}
+	defer client.Disconnect(context.Background())
 
 	// Here: we know it is MongoDB, but we don't know if it's authenticated or not.
 	result := &MongoDBDiscoveryResult{
-		isDetected:      true,
-		isAuthenticated: true,
-		properties:      nil, // Set properties to nil as it's not used in this case
+		isDetected:     true,
+		confidence:     servicediscovery.CONFIDENCE_HIGH,
+		evidence:       []string{"MongoDB handshake completed"},
+		authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN},
+		properties:     nil, // Set properties to nil as it's not used in this case
 	}
 
 	// Test the connection
@@ -91,12 +107,16 @@ func (d *MongoDBDiscovery) Discover(sessionHandler servicediscovery.ISessionHand
 			} else {
 				log.Debugf("failed to decode server status result: %v", err)
 			}
-			result.isAuthenticated = false
+			result.authentication = servicediscovery.Authentication{Status: servicediscovery.UNAUTHENTICATED, Reason: "serverStatus readable without credentials"}
 		} else {
 			log.Debugf("failed to decode server status result: %v", err)
 		}
 	} else {
 		log.Debugf("failed to get server status: %v", serverStatusResult.Err())
+		var commandErr mongo.CommandError
+		if errors.As(serverStatusResult.Err(), &commandErr) && commandErr.HasErrorCode(mongoUnauthorizedCode) {
+			result.authentication = servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATED, Reason: "serverStatus requires authentication"}
+		}
 	}
 
 	return result, nil
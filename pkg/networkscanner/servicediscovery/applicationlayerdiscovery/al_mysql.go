@@ -5,8 +5,9 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net"
+	"strconv"
 	"strings"
-	"time"
 
 	"database/sql"
 
@@ -16,9 +17,11 @@ import (
 )
 
 type MysqlDiscoveryResult struct {
-	IsDetected      bool
-	IsAuthenticated bool
-	Properties      map[string]interface{}
+	IsDetected     bool
+	Authentication servicediscovery.Authentication
+	Properties     map[string]interface{}
+	confidence     int
+	evidence       []string
 }
 
 type MysqlDiscovery struct{}
@@ -27,8 +30,16 @@ func (r *MysqlDiscoveryResult) Protocol() string {
 	return "mysql"
 }
 
-func (r *MysqlDiscoveryResult) GetIsAuthRequired() bool {
-	return r.IsAuthenticated
+func (r *MysqlDiscoveryResult) GetAuthentication() servicediscovery.Authentication {
+	return r.Authentication
+}
+
+func (r *MysqlDiscoveryResult) GetConfidence() int {
+	return r.confidence
+}
+
+func (r *MysqlDiscoveryResult) GetEvidence() []string {
+	return r.evidence
 }
 
 func (r *MysqlDiscoveryResult) GetIsDetected() bool {
@@ -43,43 +54,60 @@ func (d *MysqlDiscovery) Protocol() string {
 	return "mysql"
 }
 
-func (d *MysqlDiscovery) Discover(sessionHandler servicediscovery.ISessionHandler, presentationLayerDiscoveryResult servicediscovery.IPresentationDiscoveryResult) (servicediscovery.IApplicationDiscoveryResult, error) {
+func (d *MysqlDiscovery) Discover(ctx context.Context, sessionHandler servicediscovery.ISessionHandler, presentationLayerDiscoveryResult servicediscovery.IPresentationDiscoveryResult) (servicediscovery.IApplicationDiscoveryResult, error) {
 	mysqlDriver.SetLogger(log.New(io.Discard, "", 0))
-	dataSourceName := fmt.Sprintf("root:@tcp(%s:%d)/?timeout=3s", sessionHandler.GetHost(), sessionHandler.GetPort())
+	timing := servicediscovery.TimingFromContext(ctx)
+	dataSourceName := fmt.Sprintf("root:@tcp(%s)/?timeout=%s&readTimeout=%s&writeTimeout=%s",
+		net.JoinHostPort(sessionHandler.GetHost(), strconv.Itoa(sessionHandler.GetPort())),
+		timing.ConnectTimeout, timing.ReadTimeout, timing.ReadTimeout)
 
 	// Attempt to open a connection
 	db, err := sql.Open("mysql", dataSourceName)
 	if err != nil {
 		return &MysqlDiscoveryResult{
-			IsDetected:      false,
-			IsAuthenticated: true,
-			Properties:      nil,
+			IsDetected:     false,
+			Authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN},
+			Properties:     nil,
 		}, err
 	}
 
+	defer db.Close()
+
 	// Ping the server with passed context()
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
 	err = db.PingContext(ctx)
 	if err != nil {
 		if strings.Contains(err.Error(), "Access denied") {
 			return &MysqlDiscoveryResult{
-				IsDetected:      true,
-				IsAuthenticated: true,
-				Properties:      nil,
+				IsDetected:     true,
+				confidence:     servicediscovery.CONFIDENCE_HIGH,
+				evidence:       []string{"server denied access to user root"},
+				Authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATED, Reason: "access denied for user root without a password"},
+				Properties:     nil,
+			}, nil
+		}
+		if strings.Contains(err.Error(), "insecure transport") {
+			// require_secure_transport refuses plaintext sessions, error 3159
+			return &MysqlDiscoveryResult{
+				IsDetected:     true,
+				confidence:     servicediscovery.CONFIDENCE_HIGH,
+				evidence:       []string{"server refused a session without TLS"},
+				Authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN, Reason: "plaintext session refused before authentication"},
+				Properties:     nil,
 			}, nil
 		}
 		return &MysqlDiscoveryResult{
-			IsDetected:      false,
-			IsAuthenticated: true,
-			Properties:      nil,
+			IsDetected:     false,
+			Authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN},
+			Properties:     nil,
 		}, err
 	}
 
 	result := &MysqlDiscoveryResult{
-		IsDetected:      true,
-		IsAuthenticated: false,
-		Properties:      nil,
+		IsDetected:     true,
+		confidence:     servicediscovery.CONFIDENCE_HIGH,
+		evidence:       []string{"server accepted user root without a password"},
+		Authentication: servicediscovery.Authentication{Status: servicediscovery.UNAUTHENTICATED, Reason: "user root accepted without a password"},
+		Properties:     nil,
 	}
 
 	return result, nil
@@ -0,0 +1,100 @@
+package applicationlayerdiscovery
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
+)
+
+const (
+	NTPProtocolName = "ntp"
+	ntpPacketSize   = 48
+	ntpModeClient   = 3
+	ntpModeServer   = 4
+)
+
+// Version 4 client request, all other fields left empty
+var ntpClientRequest = append([]byte{4<<3 | ntpModeClient}, make([]byte, ntpPacketSize-1)...)
+
+type NTPDiscoveryResult struct {
+	isDetected     bool
+	properties     map[string]interface{}
+	authentication servicediscovery.Authentication
+	confidence     int
+	evidence       []string
+}
+
+func (r *NTPDiscoveryResult) Protocol() string {
+	return NTPProtocolName
+}
+
+func (r *NTPDiscoveryResult) GetIsDetected() bool {
+	return r.isDetected
+}
+
+func (r *NTPDiscoveryResult) GetProperties() map[string]interface{} {
+	return r.properties
+}
+
+func (r *NTPDiscoveryResult) GetAuthentication() servicediscovery.Authentication {
+	return r.authentication
+}
+
+func (r *NTPDiscoveryResult) GetConfidence() int {
+	return r.confidence
+}
+
+func (r *NTPDiscoveryResult) GetEvidence() []string {
+	return r.evidence
+}
+
+type NTPDiscovery struct {
+}
+
+func (d *NTPDiscovery) Protocol() string {
+	return NTPProtocolName
+}
+
+func (d *NTPDiscovery) Discover(ctx context.Context, sessionHandler servicediscovery.ISessionHandler, presentationLayerDiscoveryResult servicediscovery.IPresentationDiscoveryResult) (servicediscovery.IApplicationDiscoveryResult, error) {
+	response, err := exchangeDatagram(ctx, sessionHandler, ntpClientRequest, isNTPResponse)
+	if err != nil {
+		return &NTPDiscoveryResult{
+			isDetected:     false,
+			authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN},
+		}, err
+	}
+
+	version := int(response[0]>>3) & 0x07
+	stratum := int(response[1])
+	return &NTPDiscoveryResult{
+		isDetected:     true,
+		confidence:     servicediscovery.CONFIDENCE_HIGH,
+		evidence:       []string{fmt.Sprintf("NTP version %d server packet in response to a client request", version)},
+		authentication: servicediscovery.Authentication{Status: servicediscovery.UNAUTHENTICATED, Reason: "time request answered without authentication"},
+		properties: map[string]interface{}{
+			"protocolVersion": version,
+			"stratum":         stratum,
+			"referenceId":     ntpReferenceID(stratum, response[12:16]),
+		},
+	}, nil
+}
+
+// isNTPResponse tells whether datagram is a server answer to a client request
+func isNTPResponse(datagram []byte) bool {
+	return len(datagram) >= ntpPacketSize && datagram[0]&0x07 == ntpModeServer
+}
+
+// ntpReferenceID returns the reference clock of a primary server, e.g.
+// "GPS", and the address of the upstream server otherwise
+func ntpReferenceID(stratum int, id []byte) string {
+	if stratum <= 1 {
+		end := 0
+		for end < len(id) && id[end] != 0 {
+			end++
+		}
+		return string(id[:end])
+	}
+	return net.IP(id).String()
+}
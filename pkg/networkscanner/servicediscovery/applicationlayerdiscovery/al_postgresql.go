@@ -1,21 +1,25 @@
 package applicationlayerdiscovery
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"math"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 
 	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
 )
 
 type PostgresDiscoveryResult struct {
-	isDetected      bool
-	properties      map[string]interface{}
-	isAuthenticated bool
+	isDetected     bool
+	properties     map[string]interface{}
+	authentication servicediscovery.Authentication
+	confidence     int
+	evidence       []string
 }
 
 func (r *PostgresDiscoveryResult) Protocol() string {
@@ -30,8 +34,16 @@ func (r *PostgresDiscoveryResult) GetProperties() map[string]interface{} {
 	return r.properties
 }
 
-func (r *PostgresDiscoveryResult) GetIsAuthRequired() bool {
-	return r.isAuthenticated
+func (r *PostgresDiscoveryResult) GetAuthentication() servicediscovery.Authentication {
+	return r.authentication
+}
+
+func (r *PostgresDiscoveryResult) GetConfidence() int {
+	return r.confidence
+}
+
+func (r *PostgresDiscoveryResult) GetEvidence() []string {
+	return r.evidence
 }
 
 type PostgresDiscovery struct {
@@ -41,43 +53,59 @@ func (d *PostgresDiscovery) Protocol() string {
 	return "postgresql"
 }
 
-func (d *PostgresDiscovery) Discover(sessionHandler servicediscovery.ISessionHandler, presentationLayerDiscoveryResult servicediscovery.IPresentationDiscoveryResult) (servicediscovery.IApplicationDiscoveryResult, error) {
-	// Set a timeout of 30 ms
-	db, err := sql.Open("postgres", fmt.Sprintf("host=%s port=%d user=postgres sslmode=disable connect_timeout=1", sessionHandler.GetHost(), sessionHandler.GetPort()))
+func (d *PostgresDiscovery) Discover(ctx context.Context, sessionHandler servicediscovery.ISessionHandler, presentationLayerDiscoveryResult servicediscovery.IPresentationDiscoveryResult) (servicediscovery.IApplicationDiscoveryResult, error) {
+	// connect_timeout is in whole seconds, the context dialer enforces the exact one
+	timing := servicediscovery.TimingFromContext(ctx)
+	connectTimeout := int(math.Ceil(timing.ConnectTimeout.Seconds()))
+	connector, err := pq.NewConnector(fmt.Sprintf("host=%s port=%d user=postgres sslmode=disable connect_timeout=%d", sessionHandler.GetHost(), sessionHandler.GetPort(), connectTimeout))
 	if err != nil {
 		log.Debugf("Error while connecting to postgresql: %s", err.Error())
 		return &PostgresDiscoveryResult{
-			isDetected:      false,
-			isAuthenticated: true,
-			properties:      nil, // Set properties to nil as it's not used in this case
+			isDetected:     false,
+			authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN},
+			properties:     nil, // Set properties to nil as it's not used in this case
 		}, err
 	}
+	connector.Dialer(newContextDialer(ctx, timing.ConnectTimeout))
+	db := sql.OpenDB(connector)
 	defer db.Close()
 
 	// Here: we know it is postgresql, but we don't know if it is authenticated or not
 	result := &PostgresDiscoveryResult{
-		isDetected:      true,
-		isAuthenticated: true,
-		properties:      nil, // Set properties to nil as it's not used in this case
+		isDetected:     true,
+		authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN},
+		properties:     nil, // Set properties to nil as it's not used in this case
 	}
 
 	// Test the connection
-	err = db.Ping()
+	err = db.PingContext(ctx)
 	if err != nil {
 		if strings.Contains(err.Error(), "authentication failed") {
 			result.isDetected = true
-			result.isAuthenticated = true
+			result.authentication = servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATED, Reason: "password authentication failed for user postgres"}
+			result.confidence = servicediscovery.CONFIDENCE_HIGH
+			result.evidence = []string{"server rejected the authentication of user postgres"}
 		} else if strings.Contains(err.Error(), "role \"admin\" does not exist") {
 			// We need this case to detect that we are using an user that does not exist but still it is unauthenticated
 			result.isDetected = true
-			result.isAuthenticated = false
+			result.authentication = servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN, Reason: "login stopped at a missing role before authentication"}
+			result.confidence = servicediscovery.CONFIDENCE_MEDIUM
+			result.evidence = []string{"server reported a missing role"}
+		} else if strings.Contains(err.Error(), "no encryption") || strings.Contains(err.Error(), "SSL off") {
+			// pg_hba.conf only allows TLS sessions, which are upgraded to with STARTTLS
+			result.isDetected = true
+			result.authentication = servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN, Reason: "plaintext session refused before authentication"}
+			result.confidence = servicediscovery.CONFIDENCE_HIGH
+			result.evidence = []string{"server refused a session without encryption"}
 		} else {
 			result.isDetected = false
-			result.isAuthenticated = true
+			result.authentication = servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN}
 		}
 	} else {
 		result.isDetected = true
-		result.isAuthenticated = false
+		result.authentication = servicediscovery.Authentication{Status: servicediscovery.UNAUTHENTICATED, Reason: "user postgres accepted without a password"}
+		result.confidence = servicediscovery.CONFIDENCE_HIGH
+		result.evidence = []string{"server accepted user postgres without a password"}
 	}
 	return result, nil
 }
@@ -1,7 +1,9 @@
 package applicationlayerdiscovery
 
 import (
-	"fmt"
+	"context"
+	"net"
+	"strconv"
 	"time"
 
 	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
@@ -13,9 +15,11 @@ const (
 )
 
 type RabbitMQDiscoveryResult struct {
-	isDetected      bool
-	properties      map[string]interface{}
-	isAuthenticated bool
+	isDetected     bool
+	properties     map[string]interface{}
+	authentication servicediscovery.Authentication
+	confidence     int
+	evidence       []string
 }
 
 func (r *RabbitMQDiscoveryResult) Protocol() string {
@@ -30,8 +34,16 @@ func (r *RabbitMQDiscoveryResult) GetProperties() map[string]interface{} {
 	return r.properties
 }
 
-func (r *RabbitMQDiscoveryResult) GetIsAuthRequired() bool {
-	return r.isAuthenticated
+func (r *RabbitMQDiscoveryResult) GetAuthentication() servicediscovery.Authentication {
+	return r.authentication
+}
+
+func (r *RabbitMQDiscoveryResult) GetConfidence() int {
+	return r.confidence
+}
+
+func (r *RabbitMQDiscoveryResult) GetEvidence() []string {
+	return r.evidence
 }
 
 type RabbitMQDiscovery struct {
@@ -41,31 +53,43 @@ func (d *RabbitMQDiscovery) Protocol() string {
 	return RabbitMQProtocolName
 }
 
-func (d *RabbitMQDiscovery) Discover(sessionHandler servicediscovery.ISessionHandler, presentationLayerDiscoveryResult servicediscovery.IPresentationDiscoveryResult) (servicediscovery.IApplicationDiscoveryResult, error) {
-	connectionString := fmt.Sprintf("amqp://%s:%d", sessionHandler.GetHost(), sessionHandler.GetPort())
+func (d *RabbitMQDiscovery) Discover(ctx context.Context, sessionHandler servicediscovery.ISessionHandler, presentationLayerDiscoveryResult servicediscovery.IPresentationDiscoveryResult) (servicediscovery.IApplicationDiscoveryResult, error) {
+	connectionString := "amqp://" + net.JoinHostPort(sessionHandler.GetHost(), strconv.Itoa(sessionHandler.GetPort()))
+	timing := servicediscovery.TimingFromContext(ctx)
+	dialer := newContextDialer(ctx, timing.ConnectTimeout)
 	config := amqp.Config{
-		Dial: amqp.DefaultDial(time.Millisecond * 500),
+		Dial: func(network, addr string) (net.Conn, error) {
+			conn, err := dialer.Dial(network, addr)
+			if err != nil {
+				return nil, err
+			}
+			// Handshake deadline as in amqp.DefaultDial, cleared by amqp once connected
+			return conn, conn.SetDeadline(time.Now().Add(timing.ReadTimeout))
+		},
 	}
 	conn, err := amqp.DialConfig(connectionString, config)
 	if err != nil {
 		return &RabbitMQDiscoveryResult{
-			isDetected:      false,
-			isAuthenticated: true,
-			properties:      nil, // Set properties to nil as it's not used in this case
+			isDetected:     false,
+			authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN},
+			properties:     nil, // Set properties to nil as it's not used in this case
 		}, err
 	}
 	defer conn.Close()
 
-	// Check if the connection is authenticated
-	isAuthenticated := true
-	if !conn.IsClosed() {
-		isAuthenticated = false
+	// The login with the default guest credentials went through, unless the
+	// server closed the connection right away
+	authentication := servicediscovery.Authentication{Status: servicediscovery.UNAUTHENTICATED, Reason: "default guest credentials accepted"}
+	if conn.IsClosed() {
+		authentication = servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATED, Reason: "connection closed after login"}
 	}
 
 	// Create RabbitMQ discovery result
 	return &RabbitMQDiscoveryResult{
-		isDetected:      true,
-		isAuthenticated: isAuthenticated,
-		properties:      nil, // Set properties to nil as it's not used in this case
+		isDetected:     true,
+		confidence:     servicediscovery.CONFIDENCE_HIGH,
+		evidence:       []string{"AMQP handshake completed"},
+		authentication: authentication,
+		properties:     nil, // Set properties to nil as it's not used in this case
 	}, nil
 }
@@ -3,16 +3,20 @@ package applicationlayerdiscovery
 import (
 	"context"
 	"fmt"
-	"time"
+	"net"
+	"strconv"
+	"strings"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
 )
 
 type RedisDiscoveryResult struct {
-	isDetected      bool
-	properties      map[string]interface{}
-	isAuthenticated bool
+	isDetected     bool
+	properties     map[string]interface{}
+	authentication servicediscovery.Authentication
+	confidence     int
+	evidence       []string
 }
 
 func (r *RedisDiscoveryResult) Protocol() string {
@@ -27,8 +31,16 @@ func (r *RedisDiscoveryResult) GetProperties() map[string]interface{} {
 	return r.properties
 }
 
-func (r *RedisDiscoveryResult) GetIsAuthRequired() bool {
-	return r.isAuthenticated
+func (r *RedisDiscoveryResult) GetAuthentication() servicediscovery.Authentication {
+	return r.authentication
+}
+
+func (r *RedisDiscoveryResult) GetConfidence() int {
+	return r.confidence
+}
+
+func (r *RedisDiscoveryResult) GetEvidence() []string {
+	return r.evidence
 }
 
 type RedisDiscovery struct {
@@ -38,40 +50,63 @@ func (d *RedisDiscovery) Protocol() string {
 	return "redis"
 }
 
-func (d *RedisDiscovery) Discover(sessionHandler servicediscovery.ISessionHandler, presentationLayerDiscoveryResult servicediscovery.IPresentationDiscoveryResult) (servicediscovery.IApplicationDiscoveryResult, error) {
+func (d *RedisDiscovery) Discover(ctx context.Context, sessionHandler servicediscovery.ISessionHandler, presentationLayerDiscoveryResult servicediscovery.IPresentationDiscoveryResult) (servicediscovery.IApplicationDiscoveryResult, error) {
+	timing := servicediscovery.TimingFromContext(ctx)
+	// Zero retries means the default of three for the client, -1 disables them
+	maxRetries := timing.Retries
+	if maxRetries == 0 {
+		maxRetries = -1
+	}
 
 	redisClient := redis.NewClient(&redis.Options{
-		Addr:        fmt.Sprintf("%s:%d", sessionHandler.GetHost(), sessionHandler.GetPort()),
-		Password:    "", // No password for now, modify as needed
-		DB:          0,  // Use default DB
-		DialTimeout: 500 * time.Millisecond,
-		MaxRetries:  1,
+		Addr:         net.JoinHostPort(sessionHandler.GetHost(), strconv.Itoa(sessionHandler.GetPort())),
+		Password:     "", // No password for now, modify as needed
+		DB:           0,  // Use default DB
+		DialTimeout:  timing.ConnectTimeout,
+		ReadTimeout:  timing.ReadTimeout,
+		WriteTimeout: timing.ReadTimeout,
+		MaxRetries:   maxRetries,
 	})
 
-	pong, err := redisClient.Ping(context.TODO()).Result()
+	defer redisClient.Close()
+
+	pong, err := redisClient.Ping(ctx).Result()
+	if err != nil && strings.HasPrefix(err.Error(), "NOAUTH") {
+		// Redis with a password refuses commands before AUTH
+		return &RedisDiscoveryResult{
+			isDetected:     true,
+			confidence:     servicediscovery.CONFIDENCE_HIGH,
+			evidence:       []string{"PING refused with NOAUTH"},
+			authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATED, Reason: "PING refused before AUTH"},
+		}, nil
+	}
 	if err != nil {
 		// Even if there is an error, we can still detect Redis
 		result := &RedisDiscoveryResult{
-			isDetected:      false,
-			isAuthenticated: true,
-			properties:      nil, // Set properties to nil as it's not used in this case
+			isDetected:     false,
+			authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN},
+			properties:     nil, // Set properties to nil as it's not used in this case
 		}
 		return result, nil
 	}
 
 	if pong != "PONG" {
 		return &RedisDiscoveryResult{
-			isDetected:      true,
-			isAuthenticated: true,
-			properties:      nil, // Set properties to nil as it's not used in this case
+			isDetected:     true,
+			confidence:     servicediscovery.CONFIDENCE_LOW,
+			evidence:       []string{fmt.Sprintf("PING answered with %q instead of PONG", pong)},
+			authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN, Reason: fmt.Sprintf("unexpected PING answer %q", pong)},
+			properties:     nil, // Set properties to nil as it's not used in this case
 		}, nil
 	}
 
 	// Redis connection successful, populate properties if needed
 	result := &RedisDiscoveryResult{
-		isDetected:      true,
-		isAuthenticated: false,
-		properties:      nil, // Set properties to nil as it's not used in this case
+		isDetected:     true,
+		confidence:     servicediscovery.CONFIDENCE_HIGH,
+		evidence:       []string{"PING answered with PONG"},
+		authentication: servicediscovery.Authentication{Status: servicediscovery.UNAUTHENTICATED, Reason: "PING allowed without AUTH"},
+		properties:     nil, // Set properties to nil as it's not used in this case
 	}
 
 	return result, nil
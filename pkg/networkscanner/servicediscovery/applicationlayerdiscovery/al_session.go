@@ -0,0 +1,64 @@
+package applicationlayerdiscovery
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
+)
+
+// sessionConn is a net.Conn over a connected session handler, for client
+// libraries that run their protocol over a connection of their own. Every
+// read and write of the session handler has its own deadline, so the
+// deadlines set on the connection are ignored.
+type sessionConn struct {
+	sessionHandler servicediscovery.ISessionHandler
+}
+
+// dialSession connects the session handler and returns it as a net.Conn.
+// Over TLS sessions the protocols are offered through ALPN. The session
+// lives until ctx is done or the connection is closed.
+func dialSession(ctx context.Context, sessionHandler servicediscovery.ISessionHandler, protocols []string) (net.Conn, error) {
+	if tlsHandler, ok := sessionHandler.(servicediscovery.ITlsSessionHandler); ok && len(protocols) > 0 {
+		if _, err := tlsHandler.ConnectALPN(ctx, protocols); err != nil {
+			return nil, err
+		}
+	} else if err := sessionHandler.Connect(ctx); err != nil {
+		return nil, err
+	}
+	return &sessionConn{sessionHandler: sessionHandler}, nil
+}
+
+func (c *sessionConn) Read(data []byte) (int, error) {
+	return c.sessionHandler.Read(data)
+}
+
+func (c *sessionConn) Write(data []byte) (int, error) {
+	return c.sessionHandler.Write(data)
+}
+
+func (c *sessionConn) Close() error {
+	return c.sessionHandler.Destory()
+}
+
+// LocalAddr is unknown, the session handler does not tell it
+func (c *sessionConn) LocalAddr() net.Addr {
+	return &net.TCPAddr{}
+}
+
+func (c *sessionConn) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.ParseIP(c.sessionHandler.GetHost()), Port: c.sessionHandler.GetPort()}
+}
+
+func (c *sessionConn) SetDeadline(time.Time) error {
+	return nil
+}
+
+func (c *sessionConn) SetReadDeadline(time.Time) error {
+	return nil
+}
+
+func (c *sessionConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
@@ -0,0 +1,138 @@
+package applicationlayerdiscovery
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
+)
+
+const (
+	SMTPProtocolName = "smtp"
+	smtpClientName   = "kubescape-network-scanner"
+)
+
+type SMTPDiscoveryResult struct {
+	isDetected     bool
+	properties     map[string]interface{}
+	authentication servicediscovery.Authentication
+	confidence     int
+	evidence       []string
+}
+
+func (r *SMTPDiscoveryResult) Protocol() string {
+	return SMTPProtocolName
+}
+
+func (r *SMTPDiscoveryResult) GetIsDetected() bool {
+	return r.isDetected
+}
+
+func (r *SMTPDiscoveryResult) GetProperties() map[string]interface{} {
+	return r.properties
+}
+
+func (r *SMTPDiscoveryResult) GetAuthentication() servicediscovery.Authentication {
+	return r.authentication
+}
+
+func (r *SMTPDiscoveryResult) GetConfidence() int {
+	return r.confidence
+}
+
+func (r *SMTPDiscoveryResult) GetEvidence() []string {
+	return r.evidence
+}
+
+type SMTPDiscovery struct {
+}
+
+func (d *SMTPDiscovery) Protocol() string {
+	return SMTPProtocolName
+}
+
+// Discover reads the greeting and says EHLO. Other protocols greet with 220
+// too, such as FTP, so only servers that answer EHLO are detected.
+func (d *SMTPDiscovery) Discover(ctx context.Context, sessionHandler servicediscovery.ISessionHandler, presentationLayerDiscoveryResult servicediscovery.IPresentationDiscoveryResult) (servicediscovery.IApplicationDiscoveryResult, error) {
+	notDetected := &SMTPDiscoveryResult{
+		isDetected:     false,
+		authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN},
+	}
+
+	err := sessionHandler.Connect(ctx)
+	if err != nil {
+		return notDetected, err
+	}
+	defer sessionHandler.Destory()
+
+	code, greeting, err := readSMTPReply(sessionHandler)
+	if err != nil || code != 220 {
+		return notDetected, err
+	}
+	if _, err = sessionHandler.Write([]byte("EHLO " + smtpClientName + "\r\n")); err != nil {
+		return notDetected, err
+	}
+	code, lines, err := readSMTPReply(sessionHandler)
+	if err != nil || code != 250 {
+		return notDetected, err
+	}
+	sessionHandler.Write([]byte("QUIT\r\n"))
+
+	// The first line of the EHLO reply greets the client
+	extensions := lines[1:]
+	properties := map[string]interface{}{
+		"banner":     greeting[0],
+		"extensions": extensions,
+	}
+	authentication := servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN, Reason: "mail relaying not tested"}
+	for _, extension := range extensions {
+		if mechanisms, ok := strings.CutPrefix(strings.ToUpper(extension), "AUTH "); ok {
+			properties["authMechanisms"] = strings.Fields(mechanisms)
+			authentication.Reason = "AUTH offered, mail relaying not tested"
+		}
+	}
+
+	return &SMTPDiscoveryResult{
+		isDetected:     true,
+		confidence:     servicediscovery.CONFIDENCE_HIGH,
+		evidence:       []string{fmt.Sprintf("220 greeting %q and 250 answer to EHLO", greeting[0])},
+		authentication: authentication,
+		properties:     properties,
+	}, nil
+}
+
+// readSMTPReply reads a reply, whose lines but the last have a dash after
+// the code, and returns the code and the text of each line
+func readSMTPReply(sessionHandler servicediscovery.ISessionHandler) (int, []string, error) {
+	data, err := readUntil(sessionHandler, nil, isCompleteSMTPReply)
+	if err != nil {
+		return 0, nil, err
+	}
+	var code int
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\r\n"), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if len(line) < 3 {
+			return 0, nil, fmt.Errorf("not an SMTP reply: %q", line)
+		}
+		if code, err = strconv.Atoi(line[:3]); err != nil {
+			return 0, nil, fmt.Errorf("not an SMTP reply: %q", line)
+		}
+		lines = append(lines, strings.TrimSpace(line[3:]))
+	}
+	for i := range lines {
+		lines[i] = strings.TrimPrefix(lines[i], "-")
+	}
+	return code, lines, nil
+}
+
+func isCompleteSMTPReply(data []byte) bool {
+	if len(data) == 0 || data[len(data)-1] != '\n' {
+		return false
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\r\n"), "\n")
+	last := strings.TrimRight(lines[len(lines)-1], "\r")
+	return len(last) == 3 || (len(last) > 3 && last[3] == ' ')
+}
@@ -0,0 +1,167 @@
+package applicationlayerdiscovery
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
+)
+
+const (
+	SNMPProtocolName = "snmp"
+	snmpCommunity    = "public"
+)
+
+// Context-specific BER tags of SNMP PDUs
+const (
+	snmpGetRequest = 0xa0
+	snmpResponse   = 0xa2
+)
+
+var snmpRequestID = []byte{0x6b, 0x73, 0x6e, 0x73}
+
+// SNMPv2c get-request of sysDescr.0 with the public community
+var snmpSysDescrRequest = []byte{
+	servicediscovery.BER_SEQUENCE, 0x29,
+	servicediscovery.BER_INTEGER, 0x01, 0x01, // version 2c
+	servicediscovery.BER_OCTET_STRING, 0x06, 'p', 'u', 'b', 'l', 'i', 'c', // community
+	snmpGetRequest, 0x1c,
+	servicediscovery.BER_INTEGER, 0x04, 0x6b, 0x73, 0x6e, 0x73, // request ID
+	servicediscovery.BER_INTEGER, 0x01, 0x00, // error status
+	servicediscovery.BER_INTEGER, 0x01, 0x00, // error index
+	servicediscovery.BER_SEQUENCE, 0x0e, // variable bindings
+	servicediscovery.BER_SEQUENCE, 0x0c, // variable binding
+	0x06, 0x08, 0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x01, 0x00, // 1.3.6.1.2.1.1.1.0
+	0x05, 0x00, // null value
+}
+
+type SNMPDiscoveryResult struct {
+	isDetected     bool
+	properties     map[string]interface{}
+	authentication servicediscovery.Authentication
+	confidence     int
+	evidence       []string
+}
+
+func (r *SNMPDiscoveryResult) Protocol() string {
+	return SNMPProtocolName
+}
+
+func (r *SNMPDiscoveryResult) GetIsDetected() bool {
+	return r.isDetected
+}
+
+func (r *SNMPDiscoveryResult) GetProperties() map[string]interface{} {
+	return r.properties
+}
+
+func (r *SNMPDiscoveryResult) GetAuthentication() servicediscovery.Authentication {
+	return r.authentication
+}
+
+func (r *SNMPDiscoveryResult) GetConfidence() int {
+	return r.confidence
+}
+
+func (r *SNMPDiscoveryResult) GetEvidence() []string {
+	return r.evidence
+}
+
+type SNMPDiscovery struct {
+}
+
+func (d *SNMPDiscovery) Protocol() string {
+	return SNMPProtocolName
+}
+
+// Discover asks for the system description with the default community.
+// Agents drop requests with an unknown community without answering, so only
+// agents open to the public community are detected.
+func (d *SNMPDiscovery) Discover(ctx context.Context, sessionHandler servicediscovery.ISessionHandler, presentationLayerDiscoveryResult servicediscovery.IPresentationDiscoveryResult) (servicediscovery.IApplicationDiscoveryResult, error) {
+	var response snmpMessage
+	_, err := exchangeDatagram(ctx, sessionHandler, snmpSysDescrRequest, func(datagram []byte) bool {
+		message, err := parseSNMPResponse(datagram)
+		if err != nil {
+			return false
+		}
+		response = message
+		return true
+	})
+	if err != nil {
+		return &SNMPDiscoveryResult{
+			isDetected:     false,
+			authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN},
+		}, err
+	}
+
+	result := &SNMPDiscoveryResult{
+		isDetected:     true,
+		confidence:     servicediscovery.CONFIDENCE_HIGH,
+		evidence:       []string{"SNMP response to a get-request with the public community"},
+		authentication: servicediscovery.Authentication{Status: servicediscovery.UNAUTHENTICATED, Reason: "public community accepted"},
+		properties: map[string]interface{}{
+			"community": snmpCommunity,
+		},
+	}
+	if response.sysDescr != "" {
+		result.properties["sysDescr"] = response.sysDescr
+	}
+	return result, nil
+}
+
+type snmpMessage struct {
+	sysDescr string
+}
+
+var errNotSNMPResponse = errors.New("not an SNMP response")
+
+// parseSNMPResponse decodes the response to snmpSysDescrRequest
+func parseSNMPResponse(datagram []byte) (snmpMessage, error) {
+	var message snmpMessage
+
+	tag, content, _, err := servicediscovery.ReadBER(datagram)
+	if err != nil || tag != servicediscovery.BER_SEQUENCE {
+		return message, errNotSNMPResponse
+	}
+	// Version and community
+	for _, expected := range []byte{servicediscovery.BER_INTEGER, servicediscovery.BER_OCTET_STRING} {
+		tag, _, content, err = servicediscovery.ReadBER(content)
+		if err != nil || tag != expected {
+			return message, errNotSNMPResponse
+		}
+	}
+	tag, pdu, _, err := servicediscovery.ReadBER(content)
+	if err != nil || tag != snmpResponse {
+		return message, errNotSNMPResponse
+	}
+	tag, requestID, pdu, err := servicediscovery.ReadBER(pdu)
+	if err != nil || tag != servicediscovery.BER_INTEGER || !bytes.Equal(requestID, snmpRequestID) {
+		return message, errNotSNMPResponse
+	}
+	// Error status and index
+	for i := 0; i < 2; i++ {
+		if _, _, pdu, err = servicediscovery.ReadBER(pdu); err != nil {
+			return message, errNotSNMPResponse
+		}
+	}
+
+	// The value of the first variable binding, if it is a string
+	_, bindings, _, err := servicediscovery.ReadBER(pdu)
+	if err != nil {
+		return message, nil
+	}
+	_, binding, _, err := servicediscovery.ReadBER(bindings)
+	if err != nil {
+		return message, nil
+	}
+	_, _, binding, err = servicediscovery.ReadBER(binding) // name
+	if err != nil {
+		return message, nil
+	}
+	tag, value, _, err := servicediscovery.ReadBER(binding)
+	if err == nil && tag == servicediscovery.BER_OCTET_STRING {
+		message.sysDescr = string(value)
+	}
+	return message, nil
+}
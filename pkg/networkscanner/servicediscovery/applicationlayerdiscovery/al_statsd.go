@@ -0,0 +1,95 @@
+package applicationlayerdiscovery
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
+)
+
+const (
+	StatsDProtocolName = "statsd"
+)
+
+// Ports StatsD servers listen on by default
+var statsdPorts = []int{8125}
+
+// Counter increment of zero, well formed but without effect on the metrics
+var statsdProbeMetric = []byte("kubescape_network_scanner.probe:0|c\n")
+
+type StatsDDiscoveryResult struct {
+	isDetected     bool
+	properties     map[string]interface{}
+	authentication servicediscovery.Authentication
+	confidence     int
+	evidence       []string
+}
+
+func (r *StatsDDiscoveryResult) Protocol() string {
+	return StatsDProtocolName
+}
+
+func (r *StatsDDiscoveryResult) GetIsDetected() bool {
+	return r.isDetected
+}
+
+func (r *StatsDDiscoveryResult) GetProperties() map[string]interface{} {
+	return r.properties
+}
+
+func (r *StatsDDiscoveryResult) GetAuthentication() servicediscovery.Authentication {
+	return r.authentication
+}
+
+func (r *StatsDDiscoveryResult) GetConfidence() int {
+	return r.confidence
+}
+
+func (r *StatsDDiscoveryResult) GetEvidence() []string {
+	return r.evidence
+}
+
+type StatsDDiscovery struct {
+}
+
+func (d *StatsDDiscovery) Protocol() string {
+	return StatsDProtocolName
+}
+
+// Discover sends a metric and expects no answer, since StatsD never answers.
+// Silence alone says little, so only a silent StatsD port is detected, with
+// a low confidence; ports that answer are not StatsD.
+func (d *StatsDDiscovery) Discover(ctx context.Context, sessionHandler servicediscovery.ISessionHandler, presentationLayerDiscoveryResult servicediscovery.IPresentationDiscoveryResult) (servicediscovery.IApplicationDiscoveryResult, error) {
+	notDetected := &StatsDDiscoveryResult{
+		isDetected:     false,
+		authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN},
+	}
+
+	err := sessionHandler.Connect(ctx)
+	if err != nil {
+		return notDetected, err
+	}
+	defer sessionHandler.Destory()
+
+	if _, err = sessionHandler.Write(statsdProbeMetric); err != nil {
+		return notDetected, err
+	}
+	_, err = sessionHandler.Read(make([]byte, maxDatagramSize))
+	switch {
+	case err == nil:
+		return notDetected, nil
+	case !isDatagramTimeout(err) || ctx.Err() != nil:
+		// Closed port or cancelled probe
+		return notDetected, err
+	case !slices.Contains(statsdPorts, sessionHandler.GetPort()):
+		return notDetected, nil
+	}
+
+	return &StatsDDiscoveryResult{
+		isDetected:     true,
+		confidence:     servicediscovery.CONFIDENCE_LOW,
+		evidence:       []string{fmt.Sprintf("metric accepted without answer or ICMP error on port %d", sessionHandler.GetPort())},
+		authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN, Reason: "StatsD does not answer"},
+	}, nil
+}
@@ -0,0 +1,29 @@
+package applicationlayerdiscovery
+
+import (
+	"errors"
+
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
+)
+
+// Most data read from a stream session while waiting for an answer
+const maxStreamRead = 64 * 1024
+
+var errAnswerTooLong = errors.New("answer too long")
+
+// readUntil appends what the session reads to data until complete accepts
+// it. Every read waits for the read timeout of the session.
+func readUntil(sessionHandler servicediscovery.ISessionHandler, data []byte, complete func([]byte) bool) ([]byte, error) {
+	buf := make([]byte, 4096)
+	for !complete(data) {
+		if len(data) >= maxStreamRead {
+			return data, errAnswerTooLong
+		}
+		n, err := sessionHandler.Read(buf)
+		data = append(data, buf[:n]...)
+		if err != nil && !complete(data) {
+			return data, err
+		}
+	}
+	return data, nil
+}
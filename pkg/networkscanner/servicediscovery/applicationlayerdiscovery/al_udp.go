@@ -0,0 +1,54 @@
+package applicationlayerdiscovery
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
+)
+
+// Large enough for the answers of the UDP probes, which stay below the
+// usual MTU
+const maxDatagramSize = 1500
+
+// exchangeDatagram sends request over a UDP session and returns the first
+// datagram accepted by answers. Datagrams may be lost, so a request that
+// gets no accepted answer within the read timeout is sent again, up to the
+// number of retries of the context timing.
+func exchangeDatagram(ctx context.Context, sessionHandler servicediscovery.ISessionHandler, request []byte, answers func([]byte) bool) ([]byte, error) {
+	err := sessionHandler.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer sessionHandler.Destory()
+
+	timing := servicediscovery.TimingFromContext(ctx)
+	buf := make([]byte, maxDatagramSize)
+	for attempt := 0; attempt <= timing.Retries; attempt++ {
+		if _, err = sessionHandler.Write(request); err != nil {
+			return nil, err
+		}
+		// Datagrams that are not an answer, such as late answers to an
+		// earlier attempt, are skipped
+		for {
+			var n int
+			n, err = sessionHandler.Read(buf)
+			if err != nil {
+				break
+			}
+			if answers(buf[:n]) {
+				return buf[:n], nil
+			}
+		}
+		if !isDatagramTimeout(err) || ctx.Err() != nil {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+func isDatagramTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
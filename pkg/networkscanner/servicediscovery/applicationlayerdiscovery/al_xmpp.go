@@ -0,0 +1,122 @@
+package applicationlayerdiscovery
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
+)
+
+const XMPPProtocolName = "xmpp"
+
+var xmppMechanism = regexp.MustCompile(`<mechanism>\s*([^<\s]+)\s*</mechanism>`)
+
+type XMPPDiscoveryResult struct {
+	isDetected     bool
+	properties     map[string]interface{}
+	authentication servicediscovery.Authentication
+	confidence     int
+	evidence       []string
+}
+
+func (r *XMPPDiscoveryResult) Protocol() string {
+	return XMPPProtocolName
+}
+
+func (r *XMPPDiscoveryResult) GetIsDetected() bool {
+	return r.isDetected
+}
+
+func (r *XMPPDiscoveryResult) GetProperties() map[string]interface{} {
+	return r.properties
+}
+
+func (r *XMPPDiscoveryResult) GetAuthentication() servicediscovery.Authentication {
+	return r.authentication
+}
+
+func (r *XMPPDiscoveryResult) GetConfidence() int {
+	return r.confidence
+}
+
+func (r *XMPPDiscoveryResult) GetEvidence() []string {
+	return r.evidence
+}
+
+type XMPPDiscovery struct {
+}
+
+func (d *XMPPDiscovery) Protocol() string {
+	return XMPPProtocolName
+}
+
+// Discover opens a client stream to the server name of the TLS options, or
+// to the host, and reads the stream features. A server that does not serve
+// the domain still answers with a stream error, which is enough to detect it.
+func (d *XMPPDiscovery) Discover(ctx context.Context, sessionHandler servicediscovery.ISessionHandler, presentationLayerDiscoveryResult servicediscovery.IPresentationDiscoveryResult) (servicediscovery.IApplicationDiscoveryResult, error) {
+	notDetected := &XMPPDiscoveryResult{
+		isDetected:     false,
+		authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN},
+	}
+
+	domain := servicediscovery.TlsOptionsFromContext(ctx).ServerName
+	if domain == "" {
+		domain = sessionHandler.GetHost()
+	}
+
+	err := sessionHandler.Connect(ctx)
+	if err != nil {
+		return notDetected, err
+	}
+	defer sessionHandler.Destory()
+
+	header := fmt.Sprintf("<?xml version='1.0'?><stream:stream to='%s' xmlns='jabber:client' xmlns:stream='http://etherx.jabber.org/streams' version='1.0'>", domain)
+	if _, err = sessionHandler.Write([]byte(header)); err != nil {
+		return notDetected, err
+	}
+	data, err := readUntil(sessionHandler, nil, func(data []byte) bool {
+		return bytes.Contains(data, []byte("</stream:features>")) || bytes.Contains(data, []byte("</stream:error>"))
+	})
+	if !bytes.Contains(data, []byte("<stream:stream")) {
+		return notDetected, err
+	}
+	sessionHandler.Write([]byte("</stream:stream>"))
+
+	if !bytes.Contains(data, []byte("<stream:features")) {
+		return &XMPPDiscoveryResult{
+			isDetected:     true,
+			confidence:     servicediscovery.CONFIDENCE_MEDIUM,
+			evidence:       []string{fmt.Sprintf("XMPP stream opened for %s without stream features", domain)},
+			authentication: servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN, Reason: "no stream features for " + domain},
+		}, nil
+	}
+
+	var mechanisms []string
+	for _, match := range xmppMechanism.FindAllSubmatch(data, -1) {
+		mechanisms = append(mechanisms, string(match[1]))
+	}
+	properties := map[string]interface{}{
+		"domain":     domain,
+		"starttls":   bytes.Contains(data, []byte("urn:ietf:params:xml:ns:xmpp-tls")),
+		"mechanisms": mechanisms,
+	}
+
+	// Mechanisms are often only offered once TLS is negotiated
+	authentication := servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATION_UNKNOWN, Reason: "no SASL mechanism offered before TLS"}
+	if slices.Contains(mechanisms, "ANONYMOUS") {
+		authentication = servicediscovery.Authentication{Status: servicediscovery.UNAUTHENTICATED, Reason: "SASL ANONYMOUS offered"}
+	} else if len(mechanisms) > 0 {
+		authentication = servicediscovery.Authentication{Status: servicediscovery.AUTHENTICATED, Reason: "SASL authentication required"}
+	}
+
+	return &XMPPDiscoveryResult{
+		isDetected:     true,
+		confidence:     servicediscovery.CONFIDENCE_HIGH,
+		evidence:       []string{fmt.Sprintf("XMPP stream features for %s", domain)},
+		authentication: authentication,
+		properties:     properties,
+	}, nil
+}
@@ -0,0 +1,57 @@
+package servicediscovery
+
+import "errors"
+
+// Universal BER tags
+const (
+	BER_INTEGER      = 0x02
+	BER_OCTET_STRING = 0x04
+	BER_ENUMERATED   = 0x0a
+	BER_SEQUENCE     = 0x30
+	BER_SET          = 0x31
+)
+
+var ErrMalformedBER = errors.New("malformed BER element")
+
+// ReadBER splits the first BER element of data into its tag and content,
+// and returns the data that follows it. Long form lengths need not be
+// minimal, as some servers always use four length bytes.
+func ReadBER(data []byte) (tag byte, content []byte, rest []byte, err error) {
+	if len(data) < 2 {
+		return 0, nil, nil, ErrMalformedBER
+	}
+	tag = data[0]
+	// Accumulated in 32 bits so that four length bytes cannot overflow an
+	// int on 32-bit platforms
+	length := uint32(data[1])
+	offset := 2
+	if length&0x80 != 0 {
+		// Long form, the low bits give the number of length bytes
+		size := int(length & 0x7f)
+		if size == 0 || size > 4 || len(data) < offset+size {
+			return 0, nil, nil, ErrMalformedBER
+		}
+		length = 0
+		for _, b := range data[offset : offset+size] {
+			length = length<<8 | uint32(b)
+		}
+		offset += size
+	}
+	if uint64(length) > uint64(len(data)-offset) {
+		return 0, nil, nil, ErrMalformedBER
+	}
+	end := offset + int(length)
+	return tag, data[offset:end], data[end:], nil
+}
+
+// BERInt decodes the content of an INTEGER or ENUMERATED element
+func BERInt(content []byte) (int, error) {
+	if len(content) == 0 || len(content) > 4 {
+		return 0, ErrMalformedBER
+	}
+	value := int(int8(content[0]))
+	for _, b := range content[1:] {
+		value = value<<8 | int(b)
+	}
+	return value, nil
+}
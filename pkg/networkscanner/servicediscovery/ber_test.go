@@ -0,0 +1,79 @@
+package servicediscovery
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestReadBER(t *testing.T) {
+	long := bytes.Repeat([]byte{0xaa}, 200)
+	tests := []struct {
+		name    string
+		data    []byte
+		tag     byte
+		content []byte
+		rest    []byte
+		err     bool
+	}{
+		{name: "short form", data: []byte{BER_INTEGER, 0x01, 0x05}, tag: BER_INTEGER, content: []byte{0x05}, rest: []byte{}},
+		{name: "empty content", data: []byte{BER_OCTET_STRING, 0x00, 0x30}, tag: BER_OCTET_STRING, content: []byte{}, rest: []byte{0x30}},
+		{name: "rest kept", data: []byte{BER_SEQUENCE, 0x02, 0x02, 0x00, 0x04, 0x00}, tag: BER_SEQUENCE, content: []byte{0x02, 0x00}, rest: []byte{0x04, 0x00}},
+		{name: "long form", data: append([]byte{BER_OCTET_STRING, 0x81, 200}, long...), tag: BER_OCTET_STRING, content: long, rest: []byte{}},
+		{name: "non-minimal four byte length", data: []byte{BER_SEQUENCE, 0x84, 0x00, 0x00, 0x00, 0x01, 0xff}, tag: BER_SEQUENCE, content: []byte{0xff}, rest: []byte{}},
+		{name: "empty", data: nil, err: true},
+		{name: "tag only", data: []byte{BER_SEQUENCE}, err: true},
+		{name: "truncated content", data: []byte{BER_OCTET_STRING, 0x03, 0x01, 0x02}, err: true},
+		{name: "truncated long length", data: []byte{BER_SEQUENCE, 0x82, 0x01}, err: true},
+		{name: "indefinite length", data: []byte{BER_SEQUENCE, 0x80, 0x00, 0x00}, err: true},
+		{name: "five length bytes", data: []byte{BER_SEQUENCE, 0x85, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00}, err: true},
+		// Lengths that would wrap a 32-bit int must not pass the bounds check
+		{name: "largest length", data: []byte{BER_SEQUENCE, 0x84, 0xff, 0xff, 0xff, 0xff, 0x00}, err: true},
+		{name: "negative as int32", data: []byte{BER_SEQUENCE, 0x84, 0x80, 0x00, 0x00, 0x00, 0x00}, err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tag, content, rest, err := ReadBER(test.data)
+			if test.err {
+				if err == nil {
+					t.Errorf("tag %#x, content %x, want an error", tag, content)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tag != test.tag || !bytes.Equal(content, test.content) || !bytes.Equal(rest, test.rest) {
+				t.Errorf("got tag %#x, content %x, rest %x, want %#x, %x, %x", tag, content, rest, test.tag, test.content, test.rest)
+			}
+		})
+	}
+}
+
+func TestBERInt(t *testing.T) {
+	tests := []struct {
+		content []byte
+		want    int
+		err     bool
+	}{
+		{content: []byte{0x00}, want: 0},
+		{content: []byte{0x7f}, want: 127},
+		{content: []byte{0x80}, want: -128},
+		{content: []byte{0x00, 0x80}, want: 128},
+		{content: []byte{0x01, 0x00, 0x00, 0x00}, want: 1 << 24},
+		{content: []byte{0xff, 0xff}, want: -1},
+		{content: nil, err: true},
+		{content: []byte{0x01, 0x00, 0x00, 0x00, 0x00}, err: true},
+	}
+	for _, test := range tests {
+		value, err := BERInt(test.content)
+		if test.err {
+			if err == nil {
+				t.Errorf("BERInt(%x) = %d, want an error", test.content, value)
+			}
+			continue
+		}
+		if err != nil || value != test.want {
+			t.Errorf("BERInt(%x) = %d, %v, want %d", test.content, value, err, test.want)
+		}
+	}
+}
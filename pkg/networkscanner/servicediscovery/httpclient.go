@@ -0,0 +1,178 @@
+package servicediscovery
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	HttpUserAgent = "kubescape-network-scanner"
+	// Most of a response body read, hashes of bodies cover only that much
+	HttpMaxBody = 1024 * 1024
+)
+
+var ErrNotHttp = errors.New("not an HTTP response")
+
+// Ports of the URL schemes redirects may point to
+var httpDefaultPorts = map[string]string{"http": "80", "https": "443", "ws": "80", "wss": "443"}
+
+// HttpClient sends HTTP/1.1 requests over a session handler, opening a new
+// connection for each of them, so HTTP probes speak TLS exactly when the
+// session layer does. It is an http.RoundTripper as well, for net/http
+// clients and client libraries that take a transport.
+type HttpClient struct {
+	ctx            context.Context
+	sessionHandler ISessionHandler
+	// Host header and authority of the requests
+	Host string
+}
+
+// NewHttpClient returns a client for the session. Its connections are
+// opened with ctx, which carries the discovery timings, rather than with
+// the context of each request.
+func NewHttpClient(ctx context.Context, sessionHandler ISessionHandler) *HttpClient {
+	return &HttpClient{ctx: ctx, sessionHandler: sessionHandler, Host: SessionAuthority(ctx, sessionHandler)}
+}
+
+// SessionAuthority returns the host and port requests over the session are
+// addressed to, using the server name of the TLS options when the target
+// was given as a hostname
+func SessionAuthority(ctx context.Context, sessionHandler ISessionHandler) string {
+	host := TlsOptionsFromContext(ctx).ServerName
+	if host == "" {
+		host = sessionHandler.GetHost()
+	}
+	return net.JoinHostPort(host, strconv.Itoa(sessionHandler.GetPort()))
+}
+
+// URL returns the URL of the root of the session, https over TLS sessions
+// and http otherwise
+func (c *HttpClient) URL() string {
+	scheme := "http"
+	if _, ok := c.sessionHandler.(ITlsSessionHandler); ok {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Host
+}
+
+// StdClient returns a net/http client over the session. Redirects are not
+// followed, they could lead away from the target.
+func (c *HttpClient) StdClient() *http.Client {
+	return &http.Client{
+		Transport: c,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Get requests path and returns the response with up to HttpMaxBody bytes
+// of its body. ErrNotHttp is returned when the server answers something
+// else than HTTP.
+func (c *HttpClient) Get(path string) (*http.Response, []byte, error) {
+	request, err := c.NewRequest(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	request.Close = true
+	return c.Do(request)
+}
+
+// NewRequest returns a GET request for path with the headers of the scanner
+func (c *HttpClient) NewRequest(path string) (*http.Request, error) {
+	request, err := http.NewRequestWithContext(c.ctx, http.MethodGet, c.URL()+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("User-Agent", HttpUserAgent)
+	request.Header.Set("Accept", "*/*")
+	return request, nil
+}
+
+// Do sends request over a new connection, closed once up to HttpMaxBody
+// bytes of the body of the response are read
+func (c *HttpClient) Do(request *http.Request) (*http.Response, []byte, error) {
+	response, _, err := c.Open(request)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer c.sessionHandler.Destory()
+	defer response.Body.Close()
+	// A body cut short by the server still tells something about it
+	body, _ := io.ReadAll(io.LimitReader(response.Body, HttpMaxBody))
+	return response, body, nil
+}
+
+// Open sends request over a new connection and reads the head of the
+// response. The connection is left open for the body, or for the protocol
+// the server switched to, and the caller closes it with the session
+// handler; it is closed right away on errors.
+func (c *HttpClient) Open(request *http.Request) (*http.Response, *bufio.Reader, error) {
+	if err := c.sessionHandler.Connect(c.ctx); err != nil {
+		return nil, nil, err
+	}
+	response, reader, err := c.readResponse(request)
+	if err != nil {
+		c.sessionHandler.Destory()
+		return nil, nil, err
+	}
+	return response, reader, nil
+}
+
+func (c *HttpClient) readResponse(request *http.Request) (*http.Response, *bufio.Reader, error) {
+	if err := request.Write(c.sessionHandler); err != nil {
+		return nil, nil, err
+	}
+	reader := bufio.NewReader(c.sessionHandler)
+	prefix, err := reader.Peek(len("HTTP/"))
+	if err != nil {
+		return nil, nil, err
+	}
+	if string(prefix) != "HTTP/" {
+		return nil, nil, ErrNotHttp
+	}
+	response, err := http.ReadResponse(reader, request)
+	if err != nil {
+		return nil, nil, err
+	}
+	return response, reader, nil
+}
+
+// RoundTrip implements http.RoundTripper. The body of the response is read
+// up to HttpMaxBody bytes before the connection is closed.
+func (c *HttpClient) RoundTrip(request *http.Request) (*http.Response, error) {
+	request = request.Clone(request.Context())
+	request.Close = true
+	if request.Header.Get("User-Agent") == "" {
+		request.Header.Set("User-Agent", HttpUserAgent)
+	}
+	response, body, err := c.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	response.Body = io.NopCloser(bytes.NewReader(body))
+	return response, nil
+}
+
+// SameHost tells whether target is on the host and port requests are sent
+// to. Host names are compared whatever their case, and a target without a
+// port is on the default port of its scheme.
+func (c *HttpClient) SameHost(target *url.URL) bool {
+	hostname, port, err := net.SplitHostPort(c.Host)
+	if err != nil {
+		return false
+	}
+	targetPort := target.Port()
+	if targetPort == "" {
+		targetPort = httpDefaultPorts[strings.ToLower(target.Scheme)]
+	}
+	return strings.EqualFold(target.Hostname(), hostname) && targetPort == port
+}
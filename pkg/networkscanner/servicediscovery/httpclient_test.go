@@ -0,0 +1,38 @@
+package servicediscovery
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestHttpClientSameHost(t *testing.T) {
+	tests := []struct {
+		host   string
+		target string
+		want   bool
+	}{
+		{"example.com:80", "/login", true},
+		{"example.com:80", "http://example.com/login", true},
+		{"example.com:80", "http://EXAMPLE.com:80/login", true},
+		{"example.com:443", "https://Example.COM/login", true},
+		{"example.com:443", "wss://example.com/socket", true},
+		{"example.com:8080", "http://example.com:8080/", true},
+		{"[::1]:443", "https://[::1]/", true},
+		{"example.com:80", "https://example.com/login", false},
+		{"example.com:8080", "http://example.com/", false},
+		{"example.com:443", "https://www.example.com/", false},
+		{"example.com:443", "ftp://example.com/", false},
+		{"10.0.0.1:80", "http://10.0.0.2/", false},
+	}
+	for _, test := range tests {
+		client := &HttpClient{Host: test.host}
+		base, _ := url.Parse("http://" + test.host + "/")
+		target, err := base.Parse(test.target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := client.SameHost(target); got != test.want {
+			t.Errorf("SameHost(%q) from %s = %t, want %t", test.target, test.host, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package servicediscovery
+
+import "context"
+
+// HttpOptions holds what HTTP discovery requests besides the root page
+type HttpOptions struct {
+	// Paths fetched after the root page and the favicon, such as /metrics
+	Paths []string
+}
+
+// What an HTTP server answered to GET /
+type HttpFingerprint struct {
+	// HTTP version of the status line, such as 1.1
+	Version    string
+	StatusCode int
+	// Every header of the response, by canonical name
+	Headers   map[string][]string
+	Server    string
+	PoweredBy string // X-Powered-By
+	Cookies   []HttpCookie
+	// Locations redirected to, in order. Redirects within the server are
+	// followed, and the title and body hash are those of the last page.
+	Redirects []string
+	// Schemes of the WWW-Authenticate challenges, such as Basic or Bearer
+	AuthSchemes []string
+	Title       string
+	// Hex SHA-256 of the body and its length, empty for an empty body
+	BodyHash   string
+	BodyLength int
+	// MurmurHash3 of /favicon.ico in base64, as Shodan computes it, nil if
+	// there is none
+	FaviconHash *int32
+	// Answers to the paths of the options
+	Paths []HttpPathResponse
+}
+
+// Cookie set by an HTTP server, without its value
+type HttpCookie struct {
+	Name     string
+	Secure   bool
+	HttpOnly bool
+	SameSite string // Lax, Strict, None or empty
+}
+
+// What an HTTP server answered to GET of one of the paths of the options
+type HttpPathResponse struct {
+	Path       string
+	StatusCode int
+	Title      string
+	BodyHash   string
+	BodyLength int
+	// Why the request failed, the other fields are then empty
+	Error string
+}
+
+// How an HTTP/2 connection was established
+const (
+	HTTP2_MODE_TLS             = "h2"                  // Selected through TLS ALPN
+	HTTP2_MODE_PRIOR_KNOWLEDGE = "h2c-prior-knowledge" // Cleartext, the client starts with the connection preface
+	HTTP2_MODE_UPGRADE         = "h2c-upgrade"         // Cleartext, upgraded from an HTTP/1.1 request
+)
+
+// What an HTTP/2 server told in its SETTINGS frame and its answer to GET /
+type Http2Info struct {
+	Mode string // HTTP2_MODE_*
+	// Values of the settings the server sent, by name such as
+	// MAX_CONCURRENT_STREAMS. Settings left out have their default value.
+	Settings map[string]uint32
+	// Status code of the answer to GET /, 0 if the server sent none
+	StatusCode int
+	Server     string
+	// Content type of the answer, application/grpc for gRPC servers
+	ContentType string
+}
+
+// Path of an HTTP server that accepts WebSocket upgrades
+type WebSocketEndpoint struct {
+	Path string
+	// Status code of the answer to the upgrade, 101 when it succeeded
+	StatusCode int
+	Upgraded   bool
+	// Subprotocols the server selected among those the scanner offers
+	Subprotocols []string
+	// The upgrade was refused with 401 or 403 while a plain request to the
+	// path was not
+	CredentialsRequired bool
+}
+
+type httpOptionsContextKey struct{}
+
+// ContextWithHttpOptions returns a copy of ctx carrying the HTTP options for
+// discovery
+func ContextWithHttpOptions(ctx context.Context, options HttpOptions) context.Context {
+	return context.WithValue(ctx, httpOptionsContextKey{}, options)
+}
+
+// HttpOptionsFromContext returns the HTTP options carried by ctx, or empty
+// options which fetch no extra path
+func HttpOptionsFromContext(ctx context.Context) HttpOptions {
+	if options, ok := ctx.Value(httpOptionsContextKey{}).(HttpOptions); ok {
+		return options
+	}
+	return HttpOptions{}
+}
@@ -0,0 +1,63 @@
+package presentationlayerdiscovery
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"math/bits"
+)
+
+// faviconHash hashes a favicon the way Shodan does: MurmurHash3 of its
+// base64 encoding with a line feed after every 76 characters and at the end
+func faviconHash(favicon []byte) int32 {
+	encoded := base64.StdEncoding.EncodeToString(favicon)
+	var wrapped []byte
+	for len(encoded) > 76 {
+		wrapped = append(append(wrapped, encoded[:76]...), '\n')
+		encoded = encoded[76:]
+	}
+	wrapped = append(append(wrapped, encoded...), '\n')
+	return int32(murmur3(wrapped, 0))
+}
+
+// murmur3 is the 32 bit x86 MurmurHash3
+func murmur3(data []byte, seed uint32) uint32 {
+	const (
+		c1 = 0xcc9e2d51
+		c2 = 0x1b873593
+	)
+	hash := seed
+	length := len(data)
+	for ; len(data) >= 4; data = data[4:] {
+		k := binary.LittleEndian.Uint32(data)
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		hash ^= k
+		hash = bits.RotateLeft32(hash, 13)
+		hash = hash*5 + 0xe6546b64
+	}
+
+	var k uint32
+	switch len(data) {
+	case 3:
+		k ^= uint32(data[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(data[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(data[0])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		hash ^= k
+	}
+
+	hash ^= uint32(length)
+	hash ^= hash >> 16
+	hash *= 0x85ebca6b
+	hash ^= hash >> 13
+	hash *= 0xc2b2ae35
+	hash ^= hash >> 16
+	return hash
+}
@@ -0,0 +1,269 @@
+package presentationlayerdiscovery
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
+)
+
+// Frames read while waiting for the answer to GET /
+const http2MaxFrames = 32
+
+// Settings of the client, push disabled as the scanner would not read it
+var http2ClientSettings = []http2.Setting{{ID: http2.SettingEnablePush, Val: 0}}
+
+// Settings defined after RFC 7540, which the http2 package does not name
+var http2SettingNames = map[http2.SettingID]string{
+	0x8: "ENABLE_CONNECT_PROTOCOL", // RFC 8441
+	0x9: "NO_RFC7540_PRIORITIES",   // RFC 9218
+}
+
+var errNotHttp2 = errors.New("no HTTP/2 SETTINGS frame")
+
+// Http2Discovery detects HTTP/2 over TLS through ALPN, and in cleartext with
+// prior knowledge or an upgrade from HTTP/1.1
+type Http2Discovery struct {
+}
+
+func (d *Http2Discovery) Protocol() servicediscovery.PresentationLayerProtocol {
+	return servicediscovery.HTTP2
+}
+
+type Http2DiscoveryResult struct {
+	IsDetected bool
+	Properties map[string]interface{}
+	info       servicediscovery.Http2Info
+}
+
+func (r *Http2DiscoveryResult) GetProperties() map[string]interface{} {
+	return r.Properties
+}
+
+func (r *Http2DiscoveryResult) GetIsDetected() bool {
+	return r.IsDetected
+}
+
+func (*Http2DiscoveryResult) Protocol() servicediscovery.PresentationLayerProtocol {
+	return servicediscovery.HTTP2
+}
+
+// GetHttp2Info implements IHttp2PresentationDiscoveryResult
+func (r *Http2DiscoveryResult) GetHttp2Info() servicediscovery.Http2Info {
+	return r.info
+}
+
+// Discover negotiates h2 through ALPN over TLS sessions. Over plain TCP it
+// first sends the connection preface right away, then tries the h2c
+// upgrade of an HTTP/1.1 request. Either way GET / is requested to learn
+// the identity of the server.
+func (d *Http2Discovery) Discover(ctx context.Context, sessionHandler servicediscovery.ISessionHandler) (servicediscovery.IPresentationDiscoveryResult, error) {
+	client := servicediscovery.NewHttpClient(ctx, sessionHandler)
+	host := client.Host
+	notDetected := &Http2DiscoveryResult{
+		IsDetected: false,
+		Properties: make(map[string]interface{}),
+	}
+
+	var info servicediscovery.Http2Info
+	var err error
+	if tlsHandler, ok := sessionHandler.(servicediscovery.ITlsSessionHandler); ok {
+		info, err = discoverH2(ctx, tlsHandler, host)
+	} else {
+		info, err = discoverH2cPriorKnowledge(ctx, sessionHandler, host)
+		if err == errNotHttp2 {
+			info, err = discoverH2cUpgrade(client, sessionHandler)
+		}
+	}
+	if err == errNotHttp2 {
+		return notDetected, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	properties := map[string]interface{}{
+		"mode":     info.Mode,
+		"settings": info.Settings,
+	}
+	if info.StatusCode != 0 {
+		properties["statusCode"] = info.StatusCode
+	}
+	if info.Server != "" {
+		properties["server"] = info.Server
+	}
+	if info.ContentType != "" {
+		properties["contentType"] = info.ContentType
+	}
+	return &Http2DiscoveryResult{
+		IsDetected: true,
+		Properties: properties,
+		info:       info,
+	}, nil
+}
+
+func discoverH2(ctx context.Context, sessionHandler servicediscovery.ITlsSessionHandler, host string) (servicediscovery.Http2Info, error) {
+	protocol, err := sessionHandler.ConnectALPN(ctx, []string{http2.NextProtoTLS})
+	if err != nil {
+		return servicediscovery.Http2Info{}, err
+	}
+	defer sessionHandler.Destory()
+	if protocol != http2.NextProtoTLS {
+		return servicediscovery.Http2Info{}, errNotHttp2
+	}
+	info, err := exchangeHttp2(sessionHandler, bufio.NewReader(sessionHandler), "https", host, true)
+	info.Mode = servicediscovery.HTTP2_MODE_TLS
+	return info, err
+}
+
+func discoverH2cPriorKnowledge(ctx context.Context, sessionHandler servicediscovery.ISessionHandler, host string) (servicediscovery.Http2Info, error) {
+	if err := sessionHandler.Connect(ctx); err != nil {
+		return servicediscovery.Http2Info{}, err
+	}
+	defer sessionHandler.Destory()
+	info, err := exchangeHttp2(sessionHandler, bufio.NewReader(sessionHandler), "http", host, true)
+	info.Mode = servicediscovery.HTTP2_MODE_PRIOR_KNOWLEDGE
+	return info, err
+}
+
+// discoverH2cUpgrade asks for an upgrade to h2c with GET /. The answer to
+// that request comes on stream 1 of the HTTP/2 connection.
+func discoverH2cUpgrade(client *servicediscovery.HttpClient, sessionHandler servicediscovery.ISessionHandler) (servicediscovery.Http2Info, error) {
+	request, err := client.NewRequest("/")
+	if err != nil {
+		return servicediscovery.Http2Info{}, err
+	}
+	// HTTP2-Settings holds the payload of the SETTINGS frame of the client
+	var settings []byte
+	for _, setting := range http2ClientSettings {
+		settings = binary.BigEndian.AppendUint16(settings, uint16(setting.ID))
+		settings = binary.BigEndian.AppendUint32(settings, setting.Val)
+	}
+	request.Header.Set("Connection", "Upgrade, HTTP2-Settings")
+	request.Header.Set("Upgrade", "h2c")
+	request.Header.Set("HTTP2-Settings", base64.RawURLEncoding.EncodeToString(settings))
+	response, reader, err := client.Open(request)
+	if err != nil {
+		return servicediscovery.Http2Info{}, errNotHttp2
+	}
+	defer sessionHandler.Destory()
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		return servicediscovery.Http2Info{}, errNotHttp2
+	}
+	info, err := exchangeHttp2(sessionHandler, reader, "http", client.Host, false)
+	info.Mode = servicediscovery.HTTP2_MODE_UPGRADE
+	return info, err
+}
+
+// exchangeHttp2 sends the connection preface and, if request is set, GET /
+// on stream 1, then reads the SETTINGS of the server and the answer on
+// stream 1. errNotHttp2 is returned when the server does not start with a
+// SETTINGS frame.
+func exchangeHttp2(sessionHandler servicediscovery.ISessionHandler, reader *bufio.Reader, scheme string, host string, request bool) (servicediscovery.Http2Info, error) {
+	var info servicediscovery.Http2Info
+	if _, err := sessionHandler.Write([]byte(http2.ClientPreface)); err != nil {
+		return info, err
+	}
+	framer := http2.NewFramer(sessionHandler, reader)
+	framer.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	// HTTP/1.1 servers answer the preface with an error or close the
+	// connection, possibly before the frames that follow it are written
+	if err := framer.WriteSettings(http2ClientSettings...); err != nil {
+		return info, closedAsNotHttp2(err)
+	}
+	if request {
+		var block bytes.Buffer
+		encoder := hpack.NewEncoder(&block)
+		for _, field := range []hpack.HeaderField{
+			{Name: ":method", Value: http.MethodGet},
+			{Name: ":scheme", Value: scheme},
+			{Name: ":authority", Value: host},
+			{Name: ":path", Value: "/"},
+			{Name: "user-agent", Value: servicediscovery.HttpUserAgent},
+		} {
+			encoder.WriteField(field)
+		}
+		err := framer.WriteHeaders(http2.HeadersFrameParam{StreamID: 1, BlockFragment: block.Bytes(), EndStream: true, EndHeaders: true})
+		if err != nil {
+			return info, closedAsNotHttp2(err)
+		}
+	}
+
+	// A frame header is 9 bytes, the fourth being the type
+	header, err := reader.Peek(9)
+	if err != nil {
+		return info, closedAsNotHttp2(err)
+	}
+	if http2.FrameType(header[3]) != http2.FrameSettings {
+		return info, errNotHttp2
+	}
+
+	for i := 0; i < http2MaxFrames; i++ {
+		frame, err := framer.ReadFrame()
+		if err != nil {
+			if info.Settings != nil {
+				// Already told apart by its SETTINGS
+				return info, nil
+			}
+			return info, errNotHttp2
+		}
+		switch frame := frame.(type) {
+		case *http2.SettingsFrame:
+			if frame.IsAck() || info.Settings != nil {
+				continue
+			}
+			info.Settings = map[string]uint32{}
+			frame.ForeachSetting(func(setting http2.Setting) error {
+				name, ok := http2SettingNames[setting.ID]
+				if !ok {
+					name = setting.ID.String()
+				}
+				info.Settings[name] = setting.Val
+				return nil
+			})
+			framer.WriteSettingsAck()
+		case *http2.MetaHeadersFrame:
+			if frame.StreamID != 1 {
+				continue
+			}
+			info.StatusCode, _ = strconv.Atoi(frame.PseudoValue("status"))
+			for _, field := range frame.RegularFields() {
+				switch field.Name {
+				case "server":
+					info.Server = field.Value
+				case "content-type":
+					info.ContentType = field.Value
+				}
+			}
+			framer.WriteGoAway(1, http2.ErrCodeNo, nil)
+			return info, nil
+		case *http2.GoAwayFrame:
+			return info, nil
+		case *http2.RSTStreamFrame:
+			if frame.StreamID == 1 {
+				return info, nil
+			}
+		}
+	}
+	return info, nil
+}
+
+// closedAsNotHttp2 returns errNotHttp2 for errors of a connection closed by
+// the server, else err
+func closedAsNotHttp2(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return errNotHttp2
+	}
+	return err
+}
@@ -1,12 +1,28 @@
 package presentationlayerdiscovery
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"html"
+	"net/http"
 	"regexp"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
 )
 
+const (
+	// Redirects within the server followed from the root page
+	httpMaxRedirects = 5
+	// Longest page title kept
+	httpMaxTitle = 256
+)
+
+var httpTitle = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
 // For HTTP example implementation of the PresentationLayerDiscovery interface
 type HttpDiscovery struct {
 }
@@ -27,8 +43,9 @@ func (s *SessionHandler) Connect() error {
 }
 
 type HttpDiscoveryResult struct {
-	IsDetected bool
-	Properties map[string]interface{}
+	IsDetected  bool
+	Properties  map[string]interface{}
+	fingerprint servicediscovery.HttpFingerprint
 }
 
 // GetProperties implements iPresentationDiscoveryResult
@@ -46,42 +63,219 @@ func (*HttpDiscoveryResult) Protocol() servicediscovery.PresentationLayerProtoco
 	return servicediscovery.HTTP
 }
 
-func (d *HttpDiscovery) Discover(sessionHandler servicediscovery.ISessionHandler) (servicediscovery.IPresentationDiscoveryResult, error) {
-	// Connect to sessionHandler
-	err := sessionHandler.Connect()
+// GetFingerprint implements IHttpPresentationDiscoveryResult
+func (hh *HttpDiscoveryResult) GetFingerprint() servicediscovery.HttpFingerprint {
+	return hh.fingerprint
+}
+
+// Discover fetches the root page, following redirects within the server,
+// then the favicon and the paths of the HTTP options of ctx. Every request
+// goes over its own connection.
+func (d *HttpDiscovery) Discover(ctx context.Context, sessionHandler servicediscovery.ISessionHandler) (servicediscovery.IPresentationDiscoveryResult, error) {
+	client := servicediscovery.NewHttpClient(ctx, sessionHandler)
+
+	response, body, err := client.Get("/")
+	if err == servicediscovery.ErrNotHttp {
+		return &HttpDiscoveryResult{
+			IsDetected: false,
+			Properties: make(map[string]interface{}),
+		}, nil
+	}
 	if err != nil {
 		return nil, err
 	}
-	defer sessionHandler.Destory()
 
-	// Try to write an HTTP request to sessionHandler
-	_, err = sessionHandler.Write([]byte(fmt.Sprintf("GET / HTTP/1.1\r\nHost: %s\r\n\r\n", sessionHandler.GetHost())))
-	if err != nil {
-		return nil, err
+	fingerprint := servicediscovery.HttpFingerprint{
+		Version:     fmt.Sprintf("%d.%d", response.ProtoMajor, response.ProtoMinor),
+		StatusCode:  response.StatusCode,
+		Headers:     response.Header,
+		Server:      response.Header.Get("Server"),
+		PoweredBy:   response.Header.Get("X-Powered-By"),
+		AuthSchemes: authSchemes(response.Header.Values("WWW-Authenticate")),
+	}
+	for _, cookie := range response.Cookies() {
+		fingerprint.Cookies = append(fingerprint.Cookies, servicediscovery.HttpCookie{
+			Name:     cookie.Name,
+			Secure:   cookie.Secure,
+			HttpOnly: cookie.HttpOnly,
+			SameSite: sameSite(cookie.SameSite),
+		})
 	}
 
-	// Read response from sessionHandler
-	headerBuf := make([]byte, 1024)
-	_, err = sessionHandler.Read(headerBuf)
-	if err != nil {
-		return nil, err
+	for i := 0; i < httpMaxRedirects && isRedirect(response.StatusCode); i++ {
+		location := response.Header.Get("Location")
+		if location == "" {
+			break
+		}
+		fingerprint.Redirects = append(fingerprint.Redirects, location)
+		target, err := response.Request.URL.Parse(location)
+		if err != nil || !client.SameHost(target) {
+			break
+		}
+		next, nextBody, err := client.Get(target.RequestURI())
+		if err != nil {
+			break
+		}
+		response, body = next, nextBody
+	}
+	fingerprint.Title = pageTitle(body)
+	fingerprint.BodyHash, fingerprint.BodyLength = bodyHash(body)
+
+	favicon, faviconBody, err := client.Get("/favicon.ico")
+	if err == nil && favicon.StatusCode == http.StatusOK && len(faviconBody) > 0 && !strings.Contains(favicon.Header.Get("Content-Type"), "html") {
+		hash := faviconHash(faviconBody)
+		fingerprint.FaviconHash = &hash
+	}
+
+	for _, path := range servicediscovery.HttpOptionsFromContext(ctx).Paths {
+		if ctx.Err() != nil {
+			break
+		}
+		pathResponse := servicediscovery.HttpPathResponse{Path: path}
+		response, body, err := client.Get(path)
+		if err != nil {
+			pathResponse.Error = err.Error()
+		} else {
+			pathResponse.StatusCode = response.StatusCode
+			pathResponse.Title = pageTitle(body)
+			pathResponse.BodyHash, pathResponse.BodyLength = bodyHash(body)
+		}
+		fingerprint.Paths = append(fingerprint.Paths, pathResponse)
 	}
 
-	r := &HttpDiscoveryResult{
-		IsDetected: false,
-		Properties: make(map[string]interface{}),
+	return &HttpDiscoveryResult{
+		IsDetected:  true,
+		Properties:  fingerprintProperties(fingerprint),
+		fingerprint: fingerprint,
+	}, nil
+}
+
+func isRedirect(statusCode int) bool {
+	switch statusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
 	}
+	return false
+}
 
-	// Write regexp to parse HTTP response header and extract version
-	re := regexp.MustCompile(`HTTP\/(\d+\.\d+) \d+ .+\r\n`)
-	match := re.FindSubmatch(headerBuf)
-	if match != nil && len(match) > 1 {
-		r.IsDetected = true
-		r.Properties["version"] = string(match[1])
-		// we should return all important header fields
-	} else {
-		r.IsDetected = false
+// authSchemes returns the schemes of WWW-Authenticate challenges. A header
+// may hold several challenges separated by commas, whose parameters are
+// told apart by their equal sign.
+func authSchemes(challenges []string) []string {
+	var schemes []string
+	for _, challenge := range challenges {
+		for _, part := range splitUnquoted(challenge, ',') {
+			// Parameters of the previous challenge are name=value, with
+			// optional spaces around the equals sign
+			fields := strings.Fields(part)
+			if len(fields) > 0 && !strings.Contains(fields[0], "=") && (len(fields) == 1 || !strings.HasPrefix(fields[1], "=")) {
+				schemes = append(schemes, fields[0])
+			}
+		}
 	}
+	return schemes
+}
 
-	return r, nil
+// splitUnquoted splits s around the separators outside of quoted strings
+func splitUnquoted(s string, separator byte) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == separator && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func sameSite(mode http.SameSite) string {
+	switch mode {
+	case http.SameSiteLaxMode:
+		return "Lax"
+	case http.SameSiteStrictMode:
+		return "Strict"
+	case http.SameSiteNoneMode:
+		return "None"
+	}
+	return ""
+}
+
+// pageTitle returns the title of an HTML page, empty if it has none
+func pageTitle(body []byte) string {
+	match := httpTitle.FindSubmatch(body)
+	if match == nil {
+		return ""
+	}
+	title := strings.Join(strings.Fields(html.UnescapeString(string(match[1]))), " ")
+	if len(title) > httpMaxTitle {
+		// Cut before the character that goes past the limit
+		end := httpMaxTitle
+		for end > 0 && !utf8.RuneStart(title[end]) {
+			end--
+		}
+		title = title[:end]
+	}
+	return title
+}
+
+func bodyHash(body []byte) (string, int) {
+	if len(body) == 0 {
+		return "", 0
+	}
+	hash := sha256.Sum256(body)
+	return hex.EncodeToString(hash[:]), len(body)
+}
+
+// fingerprintProperties flattens a fingerprint into presentation properties,
+// leaving out what the server did not send
+func fingerprintProperties(fingerprint servicediscovery.HttpFingerprint) map[string]interface{} {
+	properties := map[string]interface{}{
+		"version":    fingerprint.Version,
+		"statusCode": fingerprint.StatusCode,
+		"headers":    fingerprint.Headers,
+	}
+	optional := map[string]string{
+		"server":    fingerprint.Server,
+		"poweredBy": fingerprint.PoweredBy,
+		"title":     fingerprint.Title,
+		"bodyHash":  fingerprint.BodyHash,
+	}
+	for name, value := range optional {
+		if value != "" {
+			properties[name] = value
+		}
+	}
+	if len(fingerprint.Cookies) > 0 {
+		var names []string
+		for _, cookie := range fingerprint.Cookies {
+			names = append(names, cookie.Name)
+		}
+		properties["cookies"] = names
+	}
+	if len(fingerprint.Redirects) > 0 {
+		properties["redirects"] = fingerprint.Redirects
+	}
+	if len(fingerprint.AuthSchemes) > 0 {
+		properties["authSchemes"] = fingerprint.AuthSchemes
+	}
+	if fingerprint.FaviconHash != nil {
+		properties["faviconHash"] = *fingerprint.FaviconHash
+	}
+	if len(fingerprint.Paths) > 0 {
+		paths := map[string]int{}
+		for _, path := range fingerprint.Paths {
+			if path.Error == "" {
+				paths[path.Path] = path.StatusCode
+			}
+		}
+		properties["paths"] = paths
+	}
+	return properties
 }
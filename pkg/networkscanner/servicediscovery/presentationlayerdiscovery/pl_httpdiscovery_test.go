@@ -0,0 +1,82 @@
+package presentationlayerdiscovery
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestAuthSchemes(t *testing.T) {
+	tests := []struct {
+		challenges []string
+		want       []string
+	}{
+		{[]string{`Basic realm="kibana"`}, []string{"Basic"}},
+		{[]string{`Bearer`, `Basic realm="a, b", charset="UTF-8"`}, []string{"Bearer", "Basic"}},
+		{[]string{`Negotiate, NTLM`}, []string{"Negotiate", "NTLM"}},
+		{[]string{`Bearer realm="k8s", error="invalid_token", Basic realm=x`}, []string{"Bearer", "Basic"}},
+		{[]string{`Digest realm = "x", nonce = "y", qop="auth"`}, []string{"Digest"}},
+		{[]string{`Negotiate YIIBhwYGKwYBBQUCoIIBezCCAXeg==`}, []string{"Negotiate"}},
+		{[]string{`Basic realm="escaped \", quote", Bearer`}, []string{"Basic", "Bearer"}},
+		// Unterminated quote, the rest is taken as a parameter
+		{[]string{`Basic realm="open, Bearer`}, []string{"Basic"}},
+		{[]string{``, ` , `}, nil},
+		{nil, nil},
+	}
+	for _, test := range tests {
+		if got := authSchemes(test.challenges); !slices.Equal(got, test.want) {
+			t.Errorf("authSchemes(%q) = %q, want %q", test.challenges, got, test.want)
+		}
+	}
+}
+
+func TestSplitUnquoted(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{`a,b,c`, []string{"a", "b", "c"}},
+		{`a="b,c",d`, []string{`a="b,c"`, "d"}},
+		{`a="b\",c",d`, []string{`a="b\",c"`, "d"}},
+		{`a,`, []string{"a", ""}},
+		{``, []string{""}},
+		{`a="b,c`, []string{`a="b,c`}},
+		{`a\`, []string{`a\`}},
+		{`"a\`, []string{`"a\`}},
+	}
+	for _, test := range tests {
+		if got := splitUnquoted(test.s, ','); !slices.Equal(got, test.want) {
+			t.Errorf("splitUnquoted(%q) = %q, want %q", test.s, got, test.want)
+		}
+	}
+}
+
+func TestPageTitle(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`<html><head><title>Grafana</title></head></html>`, "Grafana"},
+		{`<TITLE lang="en">
+		  Kubernetes   Dashboard
+		</TITLE>`, "Kubernetes Dashboard"},
+		{`<title>Tom &amp; Jerry&#39;s</title>`, "Tom & Jerry's"},
+		{`<title></title>`, ""},
+		{`<title>First</title><title>Second</title>`, "First"},
+		{`<title>Unterminated`, ""},
+		{`no markup`, ""},
+		{``, ""},
+	}
+	for _, test := range tests {
+		if got := pageTitle([]byte(test.body)); got != test.want {
+			t.Errorf("pageTitle(%q) = %q, want %q", test.body, got, test.want)
+		}
+	}
+
+	// Long titles are cut whole characters first
+	long := pageTitle([]byte("<title>a" + strings.Repeat("é", httpMaxTitle) + "</title>"))
+	if len(long) > httpMaxTitle || len(long) < httpMaxTitle-1 || !utf8.ValidString(long) {
+		t.Errorf("title of %d bytes cut to %d bytes, valid UTF-8 %t", 1+2*httpMaxTitle, len(long), utf8.ValidString(long))
+	}
+}
@@ -5,13 +5,31 @@ import (
 )
 
 type PresentationLayerDiscoveryListItem struct {
-	Discovery  servicediscovery.PresentationLayerDiscovery
-	Reqirement string
+	Discovery   servicediscovery.PresentationLayerDiscovery
+	Reqirement  string
+	CommonPorts []int
 }
 
 var PresentationDiscoveryList = []PresentationLayerDiscoveryListItem{
 	{
 		Discovery:  &HttpDiscovery{},
 		Reqirement: string(servicediscovery.TCP),
+		CommonPorts: []int{
+			80, 8000, 8080, 8081, 8888,
+		},
+	},
+	{
+		Discovery:  &Http2Discovery{},
+		Reqirement: string(servicediscovery.TCP),
+		CommonPorts: []int{
+			443, 8443, 50051,
+		},
+	},
+	{
+		Discovery:  &WebSocketDiscovery{},
+		Reqirement: string(servicediscovery.TCP),
+		CommonPorts: []int{
+			3000, 7681, 8888,
+		},
 	},
 }
@@ -0,0 +1,238 @@
+package presentationlayerdiscovery
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
+)
+
+// Appended to the key of an upgrade request to compute the accept value
+const webSocketGuid = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var errWebSocketAccept = errors.New("WebSocket accept value does not match the key")
+
+// Paths where web terminals, notebooks and dashboards commonly accept
+// WebSocket upgrades, tried after the root page and the paths of the HTTP
+// options
+var webSocketPaths = []string{
+	"/ws",
+	"/websocket",
+	"/socket.io/?EIO=4&transport=websocket", // Socket.IO
+	"/terminals/websocket/1",                // Jupyter terminals
+	"/api/events/subscribe",                 // Jupyter Server
+	"/api/live/ws",                          // Grafana Live
+}
+
+// Subprotocols offered on upgrades, to learn those the server supports
+var webSocketSubprotocols = []string{
+	"tty",    // ttyd
+	"webtty", // GoTTY
+	"v4.channel.k8s.io",
+	"channel.k8s.io",
+	"base64.channel.k8s.io",
+	"graphql-transport-ws",
+	"graphql-ws",
+	"mqtt",
+	"wamp.2.json",
+	"v12.stomp",
+}
+
+// WebSocketDiscovery looks for paths of an HTTP server that upgrade to
+// WebSocket
+type WebSocketDiscovery struct {
+}
+
+func (d *WebSocketDiscovery) Protocol() servicediscovery.PresentationLayerProtocol {
+	return servicediscovery.WEBSOCKET
+}
+
+type WebSocketDiscoveryResult struct {
+	IsDetected bool
+	Properties map[string]interface{}
+	endpoints  []servicediscovery.WebSocketEndpoint
+}
+
+func (r *WebSocketDiscoveryResult) GetProperties() map[string]interface{} {
+	return r.Properties
+}
+
+func (r *WebSocketDiscoveryResult) GetIsDetected() bool {
+	return r.IsDetected
+}
+
+func (*WebSocketDiscoveryResult) Protocol() servicediscovery.PresentationLayerProtocol {
+	return servicediscovery.WEBSOCKET
+}
+
+// GetWebSocketEndpoints implements IWebSocketPresentationDiscoveryResult
+func (r *WebSocketDiscoveryResult) GetWebSocketEndpoints() []servicediscovery.WebSocketEndpoint {
+	return r.endpoints
+}
+
+// Discover asks for an upgrade on the root page, the page it redirects to
+// within the server, the paths of the HTTP options and webSocketPaths. The
+// server is detected when a path upgrades, or refuses the upgrade for lack
+// of credentials.
+func (d *WebSocketDiscovery) Discover(ctx context.Context, sessionHandler servicediscovery.ISessionHandler) (servicediscovery.IPresentationDiscoveryResult, error) {
+	client := servicediscovery.NewHttpClient(ctx, sessionHandler)
+	notDetected := &WebSocketDiscoveryResult{
+		IsDetected: false,
+		Properties: make(map[string]interface{}),
+	}
+
+	response, _, err := client.Get("/")
+	if err == servicediscovery.ErrNotHttp {
+		return notDetected, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{"/"}
+	if isRedirect(response.StatusCode) {
+		target, err := response.Request.URL.Parse(response.Header.Get("Location"))
+		if err == nil && client.SameHost(target) {
+			paths = append(paths, target.RequestURI())
+		}
+	}
+	paths = append(paths, servicediscovery.HttpOptionsFromContext(ctx).Paths...)
+	paths = append(paths, webSocketPaths...)
+
+	var endpoints []servicediscovery.WebSocketEndpoint
+	for i, path := range paths {
+		if ctx.Err() != nil {
+			break
+		}
+		if slices.Contains(paths[:i], path) {
+			continue
+		}
+		if endpoint, ok := webSocketEndpoint(ctx, client, path); ok {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	if len(endpoints) == 0 {
+		return notDetected, nil
+	}
+
+	var upgraded, credentialsRequired []string
+	subprotocols := map[string][]string{}
+	for _, endpoint := range endpoints {
+		if endpoint.CredentialsRequired {
+			credentialsRequired = append(credentialsRequired, endpoint.Path)
+			continue
+		}
+		upgraded = append(upgraded, endpoint.Path)
+		if len(endpoint.Subprotocols) > 0 {
+			subprotocols[endpoint.Path] = endpoint.Subprotocols
+		}
+	}
+	properties := map[string]interface{}{}
+	if len(upgraded) > 0 {
+		properties["paths"] = upgraded
+	}
+	if len(subprotocols) > 0 {
+		properties["subprotocols"] = subprotocols
+	}
+	if len(credentialsRequired) > 0 {
+		properties["credentialsRequired"] = credentialsRequired
+	}
+	return &WebSocketDiscoveryResult{
+		IsDetected: true,
+		Properties: properties,
+		endpoints:  endpoints,
+	}, nil
+}
+
+// webSocketEndpoint asks for an upgrade on path offering every subprotocol
+// of webSocketSubprotocols. Once it succeeds, the subprotocols the server
+// selected are offered no more, until it selects none. ok is false when
+// path is no WebSocket endpoint.
+func webSocketEndpoint(ctx context.Context, client *servicediscovery.HttpClient, path string) (servicediscovery.WebSocketEndpoint, bool) {
+	endpoint := servicediscovery.WebSocketEndpoint{Path: path}
+	offered := webSocketSubprotocols
+	response, err := upgradeWebSocket(client, path, offered)
+	if err == nil && response.StatusCode == http.StatusBadRequest {
+		// Some servers refuse subprotocols they do not know
+		offered = nil
+		response, err = upgradeWebSocket(client, path, offered)
+	}
+	if err != nil {
+		return endpoint, false
+	}
+	endpoint.StatusCode = response.StatusCode
+
+	switch response.StatusCode {
+	case http.StatusSwitchingProtocols:
+		endpoint.Upgraded = true
+	case http.StatusUnauthorized, http.StatusForbidden:
+		// Servers refusing every request without credentials tell nothing
+		// about WebSocket
+		plain, _, err := client.Get(path)
+		if err != nil || plain.StatusCode == http.StatusUnauthorized || plain.StatusCode == http.StatusForbidden {
+			return endpoint, false
+		}
+		endpoint.CredentialsRequired = true
+		return endpoint, true
+	default:
+		return endpoint, false
+	}
+
+	for ctx.Err() == nil {
+		selected := response.Header.Get("Sec-WebSocket-Protocol")
+		if !slices.Contains(offered, selected) {
+			break
+		}
+		endpoint.Subprotocols = append(endpoint.Subprotocols, selected)
+		offered = slices.DeleteFunc(slices.Clone(offered), func(protocol string) bool {
+			return protocol == selected
+		})
+		if len(offered) == 0 {
+			break
+		}
+		response, err = upgradeWebSocket(client, path, offered)
+		if err != nil || response.StatusCode != http.StatusSwitchingProtocols {
+			break
+		}
+	}
+	return endpoint, true
+}
+
+// upgrade asks for an upgrade of path to WebSocket, offering subprotocols.
+// A 101 answer is only returned when its accept value matches the key,
+// the connection is closed right after it.
+func upgradeWebSocket(client *servicediscovery.HttpClient, path string, subprotocols []string) (*http.Response, error) {
+	request, err := client.NewRequest(path)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Upgrade", "websocket")
+	request.Header.Set("Sec-WebSocket-Version", "13")
+	request.Header.Set("Sec-WebSocket-Key", key)
+	if len(subprotocols) > 0 {
+		request.Header.Set("Sec-WebSocket-Protocol", strings.Join(subprotocols, ", "))
+	}
+
+	response, _, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode == http.StatusSwitchingProtocols {
+		accept := sha1.Sum([]byte(key + webSocketGuid))
+		if !strings.EqualFold(response.Header.Get("Upgrade"), "websocket") || response.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(accept[:]) {
+			return nil, errWebSocketAccept
+		}
+	}
+	return response, nil
+}
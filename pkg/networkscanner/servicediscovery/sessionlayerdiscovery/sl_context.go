@@ -0,0 +1,107 @@
+package sessionlayerdiscovery
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
+)
+
+// closeOnDone ties the lifetime of conn to ctx: the context deadline becomes
+// the connection deadline and cancelling the context closes the connection,
+// which unblocks any pending Read or Write. The returned function detaches
+// conn from ctx and must be called when the connection is destroyed.
+func closeOnDone(ctx context.Context, conn net.Conn) func() bool {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	return context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+		conn.Close()
+	})
+}
+
+// dialTCP connects to host:port within the connect timeout of the context
+// timing, retrying attempts that timed out
+func dialTCP(ctx context.Context, host string, port int) (net.Conn, error) {
+	timing := servicediscovery.TimingFromContext(ctx)
+	dialer := net.Dialer{Timeout: timing.ConnectTimeout}
+
+	var conn net.Conn
+	err := withRetries(ctx, timing, func() error {
+		var err error
+		conn, err = dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+		return err
+	})
+	return conn, err
+}
+
+// dialUDP opens a connected UDP socket to host:port. Nothing is sent, so
+// this only fails if the address cannot be resolved or routed.
+func dialUDP(ctx context.Context, host string, port int) (net.Conn, error) {
+	timing := servicediscovery.TimingFromContext(ctx)
+	dialer := net.Dialer{Timeout: timing.ConnectTimeout}
+	return dialer.DialContext(ctx, "udp", net.JoinHostPort(host, strconv.Itoa(port)))
+}
+
+// dialTLS connects to host:port and completes a TLS handshake within the
+// connect timeout of the context timing, retrying attempts that timed out.
+// A non nil upgrade first negotiates STARTTLS over the plaintext connection.
+func dialTLS(ctx context.Context, host string, port int, upgrade startTlsUpgrade, config *tls.Config) (*tls.Conn, error) {
+	timing := servicediscovery.TimingFromContext(ctx)
+	dialer := net.Dialer{Timeout: timing.ConnectTimeout}
+
+	var conn *tls.Conn
+	err := withRetries(ctx, timing, func() error {
+		rawConn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+		if err != nil {
+			return err
+		}
+		if upgrade != nil {
+			if err := upgrade(newStartTlsConn(rawConn, timing, host, config.ServerName)); err != nil {
+				rawConn.Close()
+				return err
+			}
+			rawConn.SetDeadline(time.Time{})
+		}
+		handshakeCtx, cancel := context.WithTimeout(ctx, timing.ConnectTimeout)
+		defer cancel()
+		conn = tls.Client(rawConn, config)
+		if err := conn.HandshakeContext(handshakeCtx); err != nil {
+			rawConn.Close()
+			return err
+		}
+		return nil
+	})
+	return conn, err
+}
+
+// withRetries runs attempt once, and again up to timing.Retries times as long
+// as it times out
+func withRetries(ctx context.Context, timing servicediscovery.Timing, attempt func() error) error {
+	var err error
+	for i := 0; i <= timing.Retries; i++ {
+		err = attempt()
+		if err == nil || !isTimeout(err) || ctx.Err() != nil {
+			break
+		}
+	}
+	return err
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// ioDeadline returns the deadline for a single read or write
+func ioDeadline(timing servicediscovery.Timing) time.Time {
+	return time.Now().Add(timing.ReadTimeout)
+}
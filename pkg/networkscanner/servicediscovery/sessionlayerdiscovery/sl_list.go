@@ -5,17 +5,38 @@ import (
 )
 
 type SessionLayerDiscoveryListItem struct {
-	Discovery  servicediscovery.SessionLayerProtocolDiscovery
-	Reqirement string
+	Discovery servicediscovery.SessionLayerProtocolDiscovery
+	// Session layer protocol the discovery detects
+	Protocol    servicediscovery.SessionLayerProtocol
+	Reqirement  string
+	CommonPorts []int
 }
 
 var SessionDiscoveryList = []SessionLayerDiscoveryListItem{
 	{
 		Discovery:  &TlsSessionDiscovery{},
+		Protocol:   servicediscovery.TLS,
 		Reqirement: string(servicediscovery.TCP),
+		CommonPorts: []int{
+			443, 8443, 10250,
+		},
+	},
+	{
+		Discovery:  &SshSessionDiscovery{},
+		Protocol:   servicediscovery.SSH,
+		Reqirement: string(servicediscovery.TCP),
+		CommonPorts: []int{
+			22, 2222,
+		},
 	},
 	{
 		Discovery:  &TcpSessionDiscovery{},
+		Protocol:   servicediscovery.NO_SESSION_LAYER,
 		Reqirement: string(servicediscovery.TCP),
 	},
+	{
+		Discovery:  &UdpSessionDiscovery{},
+		Protocol:   servicediscovery.NO_SESSION_LAYER_UDP,
+		Reqirement: string(servicediscovery.UDP),
+	},
 }
@@ -0,0 +1,262 @@
+package sessionlayerdiscovery
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
+)
+
+const (
+	sshClientVersion    = "SSH-2.0-kubescape_network_scanner"
+	sshMsgKexInit       = 20
+	sshKexInitCookieLen = 16
+	sshMaxPacketLength  = 35000
+	// User of the authentication check, no credentials are sent for it
+	sshProbeUser = "root"
+)
+
+var errNotSsh = errors.New("no SSH identification string")
+
+type SshSessionDiscovery struct {
+}
+
+type SshSessionDiscoveryResult struct {
+	host string
+	port int
+	info servicediscovery.SshServerInfo
+}
+
+func (d *SshSessionDiscovery) Protocol() servicediscovery.TransportProtocol {
+	return servicediscovery.TCP
+}
+
+// SessionLayerDiscover reads the identification string and the KEXINIT of
+// the server, then opens a second connection to find out which
+// authentication methods it offers. No password or key is ever sent.
+func (d *SshSessionDiscovery) SessionLayerDiscover(ctx context.Context, hostAddr string, port int) (servicediscovery.ISessionLayerDiscoveryResult, error) {
+	info, err := readSshServerInfo(ctx, hostAddr, port)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkSshAuthentication(ctx, hostAddr, port, &info); err != nil {
+		log.Debugf("SSH authentication check failed: %v", err)
+	}
+
+	return &SshSessionDiscoveryResult{host: hostAddr, port: port, info: info}, nil
+}
+
+func (d *SshSessionDiscoveryResult) Protocol() servicediscovery.SessionLayerProtocol {
+	return servicediscovery.SSH
+}
+
+func (d *SshSessionDiscoveryResult) GetIsDetected() bool {
+	return true
+}
+
+func (d *SshSessionDiscoveryResult) GetProperties() map[string]interface{} {
+	return nil
+}
+
+func (d *SshSessionDiscoveryResult) GetServerInfo() servicediscovery.SshServerInfo {
+	return d.info
+}
+
+// GetSessionHandler returns a plain TCP session, as the channels of an SSH
+// session are only open to authenticated clients
+func (d *SshSessionDiscoveryResult) GetSessionHandler() (servicediscovery.ISessionHandler, error) {
+	return &TcpSessionHandler{host: d.host, port: d.port}, nil
+}
+
+// readSshServerInfo reads what the server sends before the key exchange
+func readSshServerInfo(ctx context.Context, host string, port int) (servicediscovery.SshServerInfo, error) {
+	var info servicediscovery.SshServerInfo
+
+	conn, err := dialTCP(ctx, host, port)
+	if err != nil {
+		return info, err
+	}
+	defer conn.Close()
+	stop := closeOnDone(ctx, conn)
+	defer stop()
+
+	timing := servicediscovery.TimingFromContext(ctx)
+	conn.SetDeadline(ioDeadline(timing))
+	reader := bufio.NewReader(conn)
+
+	// Checked before reading a line, so that binary protocols are told
+	// apart without waiting for a line end
+	prefix, err := reader.Peek(4)
+	if err != nil {
+		return info, err
+	}
+	if string(prefix) != "SSH-" {
+		return info, errNotSsh
+	}
+	line, err := reader.ReadSlice('\n')
+	if err != nil {
+		return info, err
+	}
+	parseSshIdentification(strings.TrimRight(string(line), "\r\n"), &info)
+
+	// The server may wait for the client identification before its KEXINIT
+	if _, err := conn.Write([]byte(sshClientVersion + "\r\n")); err != nil {
+		return info, err
+	}
+	conn.SetDeadline(ioDeadline(timing))
+	payload, err := readSshPacket(reader)
+	if err != nil {
+		return info, fmt.Errorf("failed to read SSH KEXINIT: %w", err)
+	}
+	if err := parseSshKexInit(payload, &info); err != nil {
+		return info, err
+	}
+	return info, nil
+}
+
+// parseSshIdentification splits an identification string such as
+// "SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13"
+func parseSshIdentification(line string, info *servicediscovery.SshServerInfo) {
+	line = strings.TrimPrefix(line, "SSH-")
+	info.ProtocolVersion, line, _ = strings.Cut(line, "-")
+	software, comments, _ := strings.Cut(line, " ")
+	info.Comments = comments
+	info.Software = software
+	if i := strings.IndexAny(software, "_-"); i > 0 {
+		info.Software = software[:i]
+		info.SoftwareVersion = software[i+1:]
+	}
+}
+
+// readSshPacket returns the payload of an unencrypted binary packet
+func readSshPacket(reader *bufio.Reader) ([]byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+	length := int(binary.BigEndian.Uint32(header[:4]))
+	padding := int(header[4])
+	if length > sshMaxPacketLength || padding+1 >= length {
+		return nil, fmt.Errorf("invalid SSH packet length %d", length)
+	}
+	body := make([]byte, length-1)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return nil, err
+	}
+	return body[:length-1-padding], nil
+}
+
+// parseSshKexInit reads the algorithm name-lists of a KEXINIT payload. The
+// lists of both directions are merged.
+func parseSshKexInit(payload []byte, info *servicediscovery.SshServerInfo) error {
+	lists, err := splitSshKexInit(payload)
+	if err != nil {
+		return err
+	}
+
+	info.KexAlgorithms = lists[0]
+	info.HostKeyAlgorithms = lists[1]
+	info.Ciphers = mergeAlgorithms(lists[2], lists[3])
+	info.MACs = mergeAlgorithms(lists[4], lists[5])
+	info.Compressions = mergeAlgorithms(lists[6], lists[7])
+
+	for _, algorithms := range [][]string{info.KexAlgorithms, info.HostKeyAlgorithms, info.Ciphers, info.MACs} {
+		for _, algorithm := range algorithms {
+			if isWeakSshAlgorithm(algorithm) {
+				info.WeakAlgorithms = append(info.WeakAlgorithms, algorithm)
+			}
+		}
+	}
+	return nil
+}
+
+// splitSshKexInit returns the kex and host key name-lists of a KEXINIT
+// payload, then those of the ciphers, MACs and compressions, client to
+// server first
+func splitSshKexInit(payload []byte) ([8][]string, error) {
+	var lists [8][]string
+	if len(payload) < 1+sshKexInitCookieLen || payload[0] != sshMsgKexInit {
+		return lists, fmt.Errorf("unexpected SSH message instead of KEXINIT")
+	}
+	data := payload[1+sshKexInitCookieLen:]
+	for i := range lists {
+		list, rest, ok := readSshString(data)
+		if !ok {
+			return lists, fmt.Errorf("truncated SSH KEXINIT")
+		}
+		if len(list) > 0 {
+			lists[i] = strings.Split(string(list), ",")
+		}
+		data = rest
+	}
+	return lists, nil
+}
+
+func mergeAlgorithms(first []string, second []string) []string {
+	merged := append([]string{}, first...)
+	for _, algorithm := range second {
+		if !slices.Contains(merged, algorithm) {
+			merged = append(merged, algorithm)
+		}
+	}
+	return merged
+}
+
+// isWeakSshAlgorithm flags SHA-1 and MD5 based algorithms, DSA and SHA-1 RSA
+// host keys, CBC and RC4 ciphers, 64 bit MACs and the none cipher and MAC
+func isWeakSshAlgorithm(algorithm string) bool {
+	switch {
+	case algorithm == "none",
+		algorithm == "ssh-rsa",
+		algorithm == "ssh-rsa-cert-v01@openssh.com",
+		strings.HasPrefix(algorithm, "ssh-dss"),
+		strings.Contains(algorithm, "sha1"),
+		strings.Contains(algorithm, "md5"),
+		strings.HasSuffix(algorithm, "-cbc"),
+		algorithm == "rijndael-cbc@lysator.liu.se",
+		strings.HasPrefix(algorithm, "arcfour"),
+		strings.HasPrefix(algorithm, "umac-64"):
+		return true
+	}
+	return false
+}
+
+// checkSshAuthentication asks to log in with the none method and records
+// the methods the server lists in its answer as they are, gssapi-with-mic
+// and hostbased included. No password or key is ever sent.
+func checkSshAuthentication(ctx context.Context, host string, port int, info *servicediscovery.SshServerInfo) error {
+	conn, err := dialTCP(ctx, host, port)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := closeOnDone(ctx, conn)
+	defer stop()
+
+	transport := newSshTransport(conn, servicediscovery.TimingFromContext(ctx))
+	accepted, methods, err := transport.tryNoneAuthentication(sshProbeUser)
+	if key, keyErr := ssh.ParsePublicKey(transport.hostKey); keyErr == nil {
+		info.HostKeyType = key.Type()
+		info.HostKeyFingerprint = ssh.FingerprintSHA256(key)
+	}
+	if err != nil {
+		return err
+	}
+	if accepted {
+		info.NoneAuthentication = true
+		info.AuthMethods = []string{"none"}
+		return nil
+	}
+	info.AuthMethods = methods
+	return nil
+}
@@ -0,0 +1,300 @@
+package sessionlayerdiscovery
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
+)
+
+// nullGssapiServer only lets the server offer gssapi-with-mic, the check
+// never gets as far as using it
+type nullGssapiServer struct{}
+
+func (nullGssapiServer) AcceptSecContext([]byte) ([]byte, string, bool, error) {
+	return nil, "", false, errors.New("not implemented")
+}
+
+func (nullGssapiServer) VerifyMIC([]byte, []byte) error {
+	return errors.New("not implemented")
+}
+
+func (nullGssapiServer) DeleteSecContext() error {
+	return nil
+}
+
+// startSshServer runs handshakes with config on a loopback port and returns
+// the port and the host key
+func startSshServer(t *testing.T, config *ssh.ServerConfig) (int, ssh.PublicKey) {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if serverConn, _, _, err := ssh.NewServerConn(conn, config); err == nil {
+					serverConn.Close()
+				}
+			}()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port, signer.PublicKey()
+}
+
+func TestCheckSshAuthentication(t *testing.T) {
+	password := func(ssh.ConnMetadata, []byte) (*ssh.Permissions, error) {
+		return nil, errors.New("denied")
+	}
+	publicKey := func(ssh.ConnMetadata, ssh.PublicKey) (*ssh.Permissions, error) {
+		return nil, errors.New("denied")
+	}
+	keyboardInteractive := func(ssh.ConnMetadata, ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+		return nil, errors.New("denied")
+	}
+	gssapi := &ssh.GSSAPIWithMICConfig{
+		AllowLogin: func(ssh.ConnMetadata, string) (*ssh.Permissions, error) {
+			return nil, errors.New("denied")
+		},
+		Server: nullGssapiServer{},
+	}
+
+	tests := []struct {
+		name        string
+		config      ssh.ServerConfig
+		wantMethods []string
+		wantNone    bool
+	}{
+		{
+			name:        "password and public key",
+			config:      ssh.ServerConfig{PasswordCallback: password, PublicKeyCallback: publicKey},
+			wantMethods: []string{"password", "publickey"},
+		},
+		{
+			name: "every method",
+			config: ssh.ServerConfig{
+				PasswordCallback:            password,
+				PublicKeyCallback:           publicKey,
+				KeyboardInteractiveCallback: keyboardInteractive,
+				GSSAPIWithMICConfig:         gssapi,
+			},
+			wantMethods: []string{"password", "publickey", "keyboard-interactive", "gssapi-with-mic"},
+		},
+		{
+			name:        "gssapi-with-mic only",
+			config:      ssh.ServerConfig{GSSAPIWithMICConfig: gssapi},
+			wantMethods: []string{"gssapi-with-mic"},
+		},
+		{
+			name:        "no client authentication",
+			config:      ssh.ServerConfig{NoClientAuth: true},
+			wantMethods: []string{"none"},
+			wantNone:    true,
+		},
+		{
+			name: "group14-sha256 with aes-ctr and hmac",
+			config: ssh.ServerConfig{
+				Config: ssh.Config{
+					KeyExchanges: []string{"diffie-hellman-group14-sha256"},
+					Ciphers:      []string{"aes128-ctr"},
+					MACs:         []string{"hmac-sha2-256"},
+				},
+				PasswordCallback: password,
+			},
+			wantMethods: []string{"password"},
+		},
+		{
+			name: "group14-sha1 with aes-ctr and hmac-sha1",
+			config: ssh.ServerConfig{
+				Config: ssh.Config{
+					KeyExchanges: []string{"diffie-hellman-group14-sha1"},
+					Ciphers:      []string{"aes256-ctr"},
+					MACs:         []string{"hmac-sha1"},
+				},
+				PasswordCallback: password,
+			},
+			wantMethods: []string{"password"},
+		},
+		{
+			name: "aes-ctr with encrypt-then-mac",
+			config: ssh.ServerConfig{
+				Config: ssh.Config{
+					Ciphers: []string{"aes192-ctr"},
+					MACs:    []string{"hmac-sha2-512-etm@openssh.com"},
+				},
+				PasswordCallback: password,
+			},
+			wantMethods: []string{"password"},
+		},
+		{
+			name: "aes-gcm",
+			config: ssh.ServerConfig{
+				Config: ssh.Config{
+					KeyExchanges: []string{"curve25519-sha256@libssh.org"},
+					Ciphers:      []string{"aes256-gcm@openssh.com"},
+				},
+				PasswordCallback: password,
+			},
+			wantMethods: []string{"password"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			port, hostKey := startSshServer(t, &test.config)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			var info servicediscovery.SshServerInfo
+			if err := checkSshAuthentication(ctx, "127.0.0.1", port, &info); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(info.AuthMethods, test.wantMethods) {
+				t.Errorf("methods %v, want %v", info.AuthMethods, test.wantMethods)
+			}
+			if info.NoneAuthentication != test.wantNone {
+				t.Errorf("none authentication %v, want %v", info.NoneAuthentication, test.wantNone)
+			}
+			if info.HostKeyType != ssh.KeyAlgoED25519 {
+				t.Errorf("host key type %q, want %q", info.HostKeyType, ssh.KeyAlgoED25519)
+			}
+			if want := ssh.FingerprintSHA256(hostKey); info.HostKeyFingerprint != want {
+				t.Errorf("host key fingerprint %q, want %q", info.HostKeyFingerprint, want)
+			}
+		})
+	}
+}
+
+func TestParseSshIdentification(t *testing.T) {
+	tests := []struct {
+		line string
+		want servicediscovery.SshServerInfo
+	}{
+		{
+			line: "SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13",
+			want: servicediscovery.SshServerInfo{ProtocolVersion: "2.0", Software: "OpenSSH", SoftwareVersion: "9.6p1", Comments: "Ubuntu-3ubuntu13"},
+		},
+		{
+			line: "SSH-2.0-dropbear_2022.83",
+			want: servicediscovery.SshServerInfo{ProtocolVersion: "2.0", Software: "dropbear", SoftwareVersion: "2022.83"},
+		},
+		{
+			line: "SSH-1.99-Cisco-1.25",
+			want: servicediscovery.SshServerInfo{ProtocolVersion: "1.99", Software: "Cisco", SoftwareVersion: "1.25"},
+		},
+		{
+			line: "SSH-2.0-Go",
+			want: servicediscovery.SshServerInfo{ProtocolVersion: "2.0", Software: "Go"},
+		},
+		{
+			// Truncated after the protocol version
+			line: "SSH-2.0",
+			want: servicediscovery.SshServerInfo{ProtocolVersion: "2.0"},
+		},
+		{
+			line: "SSH-",
+			want: servicediscovery.SshServerInfo{},
+		},
+	}
+	for _, test := range tests {
+		var info servicediscovery.SshServerInfo
+		parseSshIdentification(test.line, &info)
+		if info.ProtocolVersion != test.want.ProtocolVersion || info.Software != test.want.Software ||
+			info.SoftwareVersion != test.want.SoftwareVersion || info.Comments != test.want.Comments {
+			t.Errorf("parseSshIdentification(%q) = %+v, want %+v", test.line, info, test.want)
+		}
+	}
+}
+
+// sshKexInitFixture returns a KEXINIT payload with the name-lists, the
+// first kex packet follows flag and the reserved field
+func sshKexInitFixture(lists ...string) []byte {
+	payload := append([]byte{sshMsgKexInit}, make([]byte, sshKexInitCookieLen)...)
+	for _, list := range lists {
+		payload = appendSshString(payload, []byte(list))
+	}
+	return append(payload, 0, 0, 0, 0, 0)
+}
+
+func TestParseSshKexInit(t *testing.T) {
+	payload := sshKexInitFixture(
+		"curve25519-sha256,diffie-hellman-group1-sha1",
+		"ssh-ed25519,ssh-rsa",
+		"aes128-ctr,aes256-cbc", "aes128-ctr,arcfour",
+		"hmac-sha2-256", "hmac-sha2-256,hmac-md5",
+		"none", "none,zlib@openssh.com",
+		"", "",
+	)
+	var info servicediscovery.SshServerInfo
+	if err := parseSshKexInit(payload, &info); err != nil {
+		t.Fatal(err)
+	}
+	for _, check := range []struct {
+		name string
+		got  []string
+		want []string
+	}{
+		{"kex", info.KexAlgorithms, []string{"curve25519-sha256", "diffie-hellman-group1-sha1"}},
+		{"host key", info.HostKeyAlgorithms, []string{"ssh-ed25519", "ssh-rsa"}},
+		{"ciphers", info.Ciphers, []string{"aes128-ctr", "aes256-cbc", "arcfour"}},
+		{"MACs", info.MACs, []string{"hmac-sha2-256", "hmac-md5"}},
+		{"compressions", info.Compressions, []string{"none", "zlib@openssh.com"}},
+		{"weak", info.WeakAlgorithms, []string{"diffie-hellman-group1-sha1", "ssh-rsa", "aes256-cbc", "arcfour", "hmac-md5"}},
+	} {
+		if !slices.Equal(check.got, check.want) {
+			t.Errorf("%s %v, want %v", check.name, check.got, check.want)
+		}
+	}
+}
+
+func TestParseSshKexInitErrors(t *testing.T) {
+	valid := sshKexInitFixture("curve25519-sha256", "ssh-ed25519", "aes128-ctr", "aes128-ctr", "hmac-sha2-256", "hmac-sha2-256", "none", "none", "", "")
+	// Name-list length beyond the payload, and wrapping on 32-bit platforms
+	overlong := append(slices.Clone(valid[:1+sshKexInitCookieLen]), 0x00, 0x01, 0x00, 0x00, 'a')
+	wrapping := append(slices.Clone(valid[:1+sshKexInitCookieLen]), 0xff, 0xff, 0xff, 0xff, 'a')
+
+	tests := []struct {
+		name    string
+		payload []byte
+	}{
+		{"empty", nil},
+		{"other message", append([]byte{21}, valid[1:]...)},
+		{"cookie cut short", valid[:10]},
+		{"no name-lists", valid[:1+sshKexInitCookieLen]},
+		{"length cut short", valid[:1+sshKexInitCookieLen+2]},
+		{"list cut short", valid[:1+sshKexInitCookieLen+4+5]},
+		{"seven name-lists", sshKexInitFixture("a", "b", "c", "d", "e", "f", "g")[:1+sshKexInitCookieLen+7*5]},
+		{"overlong name-list", overlong},
+		{"wrapping name-list", wrapping},
+	}
+	for _, test := range tests {
+		var info servicediscovery.SshServerInfo
+		if err := parseSshKexInit(test.payload, &info); err == nil {
+			t.Errorf("%s: parsed as %+v, want an error", test.name, info)
+		}
+	}
+}
@@ -0,0 +1,655 @@
+package sessionlayerdiscovery
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
+)
+
+// SSH messages of the key exchange and of the none authentication request
+const (
+	sshMsgDisconnect      = 1
+	sshMsgIgnore          = 2
+	sshMsgDebug           = 4
+	sshMsgServiceRequest  = 5
+	sshMsgServiceAccept   = 6
+	sshMsgExtInfo         = 7
+	sshMsgNewKeys         = 21
+	sshMsgKexDhInit       = 30 // Also KEX_ECDH_INIT
+	sshMsgKexDhReply      = 31 // Also KEX_ECDH_REPLY
+	sshMsgUserAuthRequest = 50
+	sshMsgUserAuthFailure = 51
+	sshMsgUserAuthSuccess = 52
+	sshMsgUserAuthBanner  = 53
+)
+
+// Algorithms the scanner offers, in order of preference. The ciphers and
+// MACs are those the transport below implements.
+var (
+	sshClientKexAlgorithms     = []string{"curve25519-sha256", "curve25519-sha256@libssh.org", "diffie-hellman-group14-sha256", "diffie-hellman-group14-sha1"}
+	sshClientHostKeyAlgorithms = []string{"ssh-ed25519", "ecdsa-sha2-nistp256", "ecdsa-sha2-nistp384", "ecdsa-sha2-nistp521", "rsa-sha2-512", "rsa-sha2-256", "ssh-rsa", "ssh-dss"}
+	sshClientCiphers           = []string{"aes128-ctr", "aes192-ctr", "aes256-ctr", "aes128-gcm@openssh.com", "aes256-gcm@openssh.com"}
+	sshClientMACs              = []string{"hmac-sha2-256-etm@openssh.com", "hmac-sha2-512-etm@openssh.com", "hmac-sha2-256", "hmac-sha2-512", "hmac-sha1"}
+	// zlib@openssh.com only starts once authenticated, which the scanner
+	// never is
+	sshClientCompressions = []string{"none", "zlib@openssh.com"}
+)
+
+// 2048-bit MODP group of RFC 3526, generator 2
+var sshGroup14Prime, _ = new(big.Int).SetString("FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7EDEE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F83655D23DCA3AD961C62F356208552BB9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3BE39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF6955817183995497CEA956AE515D2261898FA051015728E5A8AACAA68FFFFFFFFFFFFFFFF", 16)
+
+var errSshNoCommonAlgorithm = errors.New("no SSH algorithm in common with the server")
+
+// sshTransport is the client side of an SSH connection, up to the first
+// authentication request. The host key signature is not checked, as
+// nothing secret is sent over the connection.
+type sshTransport struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	timing servicediscovery.Timing
+	// Sequence numbers of the next packet read and written
+	readSequence  uint32
+	writeSequence uint32
+	// Packet protection of each direction, plain until NEWKEYS
+	read  sshPacketCipher
+	write sshPacketCipher
+	// Host key the server presented in the key exchange
+	hostKey []byte
+}
+
+func newSshTransport(conn net.Conn, timing servicediscovery.Timing) *sshTransport {
+	return &sshTransport{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		timing: timing,
+		read:   sshPlainCipher{},
+		write:  sshPlainCipher{},
+	}
+}
+
+// readPacket returns the payload of the next packet, skipping IGNORE and
+// DEBUG messages
+func (t *sshTransport) readPacket() ([]byte, error) {
+	for {
+		t.conn.SetReadDeadline(ioDeadline(t.timing))
+		payload, err := t.read.readPacket(t.reader, t.readSequence)
+		t.readSequence++
+		if err != nil {
+			return nil, err
+		}
+		if len(payload) == 0 {
+			return nil, errors.New("empty SSH packet")
+		}
+		switch payload[0] {
+		case sshMsgIgnore, sshMsgDebug:
+			continue
+		case sshMsgDisconnect:
+			return nil, errors.New("SSH server disconnected")
+		}
+		return payload, nil
+	}
+}
+
+func (t *sshTransport) writePacket(payload []byte) error {
+	t.conn.SetWriteDeadline(ioDeadline(t.timing))
+	err := t.write.writePacket(t.conn, t.writeSequence, payload)
+	t.writeSequence++
+	return err
+}
+
+// tryNoneAuthentication exchanges keys and asks to log in as user with the
+// none method. It returns whether the server accepted, and otherwise the
+// methods listed in its USERAUTH_FAILURE as they are.
+func (t *sshTransport) tryNoneAuthentication(user string) (bool, []string, error) {
+	clientKexInit := sshKexInit()
+	t.conn.SetWriteDeadline(ioDeadline(t.timing))
+	if _, err := t.conn.Write([]byte(sshClientVersion + "\r\n")); err != nil {
+		return false, nil, err
+	}
+	if err := t.writePacket(clientKexInit); err != nil {
+		return false, nil, err
+	}
+	serverVersion, err := t.readVersion()
+	if err != nil {
+		return false, nil, err
+	}
+	serverKexInit, err := t.readPacket()
+	if err != nil {
+		return false, nil, err
+	}
+	if err := t.exchangeKeys([]byte(serverVersion), clientKexInit, serverKexInit); err != nil {
+		return false, nil, err
+	}
+
+	if err := t.writePacket(appendSshString([]byte{sshMsgServiceRequest}, []byte("ssh-userauth"))); err != nil {
+		return false, nil, err
+	}
+	for {
+		payload, err := t.readPacket()
+		if err != nil {
+			return false, nil, err
+		}
+		if payload[0] == sshMsgExtInfo {
+			continue
+		}
+		if payload[0] != sshMsgServiceAccept {
+			return false, nil, fmt.Errorf("unexpected SSH message %d instead of SERVICE_ACCEPT", payload[0])
+		}
+		break
+	}
+
+	request := []byte{sshMsgUserAuthRequest}
+	request = appendSshString(request, []byte(user))
+	request = appendSshString(request, []byte("ssh-connection"))
+	request = appendSshString(request, []byte("none"))
+	if err := t.writePacket(request); err != nil {
+		return false, nil, err
+	}
+	for {
+		payload, err := t.readPacket()
+		if err != nil {
+			return false, nil, err
+		}
+		switch payload[0] {
+		case sshMsgUserAuthBanner:
+			continue
+		case sshMsgUserAuthSuccess:
+			return true, nil, nil
+		case sshMsgUserAuthFailure:
+			list, _, ok := readSshString(payload[1:])
+			if !ok {
+				return false, nil, errors.New("truncated SSH USERAUTH_FAILURE")
+			}
+			methods := []string{}
+			if len(list) > 0 {
+				methods = strings.Split(string(list), ",")
+			}
+			return false, methods, nil
+		}
+		return false, nil, fmt.Errorf("unexpected SSH message %d in answer to the none authentication", payload[0])
+	}
+}
+
+// readVersion returns the identification string of the server, skipping
+// the lines it may send before it
+func (t *sshTransport) readVersion() (string, error) {
+	for i := 0; i < 16; i++ {
+		t.conn.SetReadDeadline(ioDeadline(t.timing))
+		line, err := t.reader.ReadSlice('\n')
+		if err != nil {
+			return "", err
+		}
+		if strings.HasPrefix(string(line), "SSH-") {
+			return strings.TrimRight(string(line), "\r\n"), nil
+		}
+	}
+	return "", errNotSsh
+}
+
+// sshKexInit returns the KEXINIT payload of the scanner
+func sshKexInit() []byte {
+	payload := make([]byte, 1+sshKexInitCookieLen)
+	payload[0] = sshMsgKexInit
+	rand.Read(payload[1:])
+	for _, list := range [][]string{
+		sshClientKexAlgorithms, sshClientHostKeyAlgorithms,
+		sshClientCiphers, sshClientCiphers,
+		sshClientMACs, sshClientMACs,
+		sshClientCompressions, sshClientCompressions,
+		nil, nil, // Languages
+	} {
+		payload = appendSshString(payload, []byte(strings.Join(list, ",")))
+	}
+	// No guessed key exchange packet follows, and the reserved field
+	return append(payload, 0, 0, 0, 0, 0)
+}
+
+// negotiateSshAlgorithm returns the first client algorithm the server
+// also offers
+func negotiateSshAlgorithm(client []string, server []string) (string, error) {
+	for _, algorithm := range client {
+		if slices.Contains(server, algorithm) {
+			return algorithm, nil
+		}
+	}
+	return "", errSshNoCommonAlgorithm
+}
+
+// exchangeKeys runs a curve25519 or group14 Diffie-Hellman key exchange and
+// switches both directions to the negotiated ciphers
+func (t *sshTransport) exchangeKeys(serverVersion []byte, clientKexInit []byte, serverKexInit []byte) error {
+	lists, err := splitSshKexInit(serverKexInit)
+	if err != nil {
+		return err
+	}
+	kex, err := negotiateSshAlgorithm(sshClientKexAlgorithms, lists[0])
+	if err != nil {
+		return err
+	}
+	if _, err := negotiateSshAlgorithm(sshClientHostKeyAlgorithms, lists[1]); err != nil {
+		return err
+	}
+	var directions [2]sshDirection
+	for i := range directions {
+		// Client to server, then server to client
+		if directions[i].cipher, err = negotiateSshAlgorithm(sshClientCiphers, lists[2+i]); err != nil {
+			return err
+		}
+		if !sshCipherSpecs[directions[i].cipher].aead {
+			if directions[i].mac, err = negotiateSshAlgorithm(sshClientMACs, lists[4+i]); err != nil {
+				return err
+			}
+		}
+		if _, err := negotiateSshAlgorithm(sshClientCompressions, lists[6+i]); err != nil {
+			return err
+		}
+	}
+
+	newHash := sha256.New
+	if kex == "diffie-hellman-group14-sha1" {
+		newHash = sha1.New
+	}
+	exchangeHash := newHash()
+	for _, s := range [][]byte{[]byte(sshClientVersion), serverVersion, clientKexInit, serverKexInit} {
+		exchangeHash.Write(appendSshString(nil, s))
+	}
+
+	// The secret is hashed as an mpint, with its length
+	var secret []byte
+	if strings.HasPrefix(kex, "curve25519") {
+		secret, err = t.exchangeCurve25519(exchangeHash)
+	} else {
+		secret, err = t.exchangeGroup14(exchangeHash)
+	}
+	if err != nil {
+		return err
+	}
+	exchangeHash.Write(secret)
+	sessionID := exchangeHash.Sum(nil)
+
+	if err := t.writePacket([]byte{sshMsgNewKeys}); err != nil {
+		return err
+	}
+	payload, err := t.readPacket()
+	if err != nil {
+		return err
+	}
+	if payload[0] != sshMsgNewKeys {
+		return fmt.Errorf("unexpected SSH message %d instead of NEWKEYS", payload[0])
+	}
+
+	// Keys A to F of RFC 4253, IV, key and MAC key of each direction
+	key := func(letter byte, size int) []byte {
+		return deriveSshKey(newHash, secret, sessionID, letter, size)
+	}
+	if t.write, err = directions[0].newCipher(key, 'A', 'C', 'E'); err != nil {
+		return err
+	}
+	t.read, err = directions[1].newCipher(key, 'B', 'D', 'F')
+	return err
+}
+
+// exchangeCurve25519 sends the ephemeral key of the scanner, adds the key
+// exchange reply to the exchange hash and returns the shared secret
+func (t *sshTransport) exchangeCurve25519(exchangeHash hash.Hash) ([]byte, error) {
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	clientPublic := private.PublicKey().Bytes()
+	if err := t.writePacket(appendSshString([]byte{sshMsgKexDhInit}, clientPublic)); err != nil {
+		return nil, err
+	}
+	hostKey, serverPublic, err := t.readKexReply()
+	if err != nil {
+		return nil, err
+	}
+	public, err := ecdh.X25519().NewPublicKey(serverPublic)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := private.ECDH(public)
+	if err != nil {
+		return nil, err
+	}
+	exchangeHash.Write(appendSshString(nil, hostKey))
+	exchangeHash.Write(appendSshString(nil, clientPublic))
+	exchangeHash.Write(appendSshString(nil, serverPublic))
+	return appendSshMpint(nil, new(big.Int).SetBytes(shared)), nil
+}
+
+// exchangeGroup14 is exchangeCurve25519 for the finite field group 14
+func (t *sshTransport) exchangeGroup14(exchangeHash hash.Hash) ([]byte, error) {
+	private, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 512))
+	if err != nil {
+		return nil, err
+	}
+	private.Add(private, big.NewInt(2))
+	e := new(big.Int).Exp(big.NewInt(2), private, sshGroup14Prime)
+	if err := t.writePacket(appendSshMpint([]byte{sshMsgKexDhInit}, e)); err != nil {
+		return nil, err
+	}
+	hostKey, mpint, err := t.readKexReply()
+	if err != nil {
+		return nil, err
+	}
+	f := new(big.Int).SetBytes(mpint)
+	if f.Cmp(big.NewInt(1)) <= 0 || f.Cmp(new(big.Int).Sub(sshGroup14Prime, big.NewInt(1))) >= 0 {
+		return nil, errors.New("invalid SSH Diffie-Hellman public value")
+	}
+	exchangeHash.Write(appendSshString(nil, hostKey))
+	exchangeHash.Write(appendSshMpint(nil, e))
+	exchangeHash.Write(appendSshMpint(nil, f))
+	return appendSshMpint(nil, new(big.Int).Exp(f, private, sshGroup14Prime)), nil
+}
+
+// readKexReply returns the host key and the public value of the key
+// exchange reply of the server
+func (t *sshTransport) readKexReply() ([]byte, []byte, error) {
+	payload, err := t.readPacket()
+	if err != nil {
+		return nil, nil, err
+	}
+	if payload[0] != sshMsgKexDhReply {
+		return nil, nil, fmt.Errorf("unexpected SSH message %d instead of the key exchange reply", payload[0])
+	}
+	hostKey, rest, ok := readSshString(payload[1:])
+	if !ok {
+		return nil, nil, errors.New("truncated SSH key exchange reply")
+	}
+	public, _, ok := readSshString(rest)
+	if !ok {
+		return nil, nil, errors.New("truncated SSH key exchange reply")
+	}
+	t.hostKey = hostKey
+	return hostKey, public, nil
+}
+
+// deriveSshKey derives size bytes of key material from the shared secret,
+// encoded as an mpint, and the exchange hash, as in RFC 4253 section 7.2
+func deriveSshKey(newHash func() hash.Hash, secret []byte, sessionID []byte, letter byte, size int) []byte {
+	h := newHash()
+	h.Write(secret)
+	h.Write(sessionID)
+	h.Write([]byte{letter})
+	h.Write(sessionID)
+	key := h.Sum(nil)
+	for len(key) < size {
+		h := newHash()
+		h.Write(secret)
+		h.Write(sessionID)
+		h.Write(key)
+		key = h.Sum(key)
+	}
+	return key[:size]
+}
+
+// sshDirection holds the algorithms negotiated for one direction
+type sshDirection struct {
+	cipher string
+	mac    string // Empty for AEAD ciphers
+}
+
+func (d sshDirection) newCipher(key func(letter byte, size int) []byte, ivLetter byte, keyLetter byte, macLetter byte) (sshPacketCipher, error) {
+	spec := sshCipherSpecs[d.cipher]
+	block, err := aes.NewCipher(key(keyLetter, spec.keySize))
+	if err != nil {
+		return nil, err
+	}
+	if spec.aead {
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		return &sshGcmCipher{aead: aead, nonce: key(ivLetter, aead.NonceSize())}, nil
+	}
+	mac := sshMacSpecs[d.mac]
+	return &sshCtrCipher{
+		stream: cipher.NewCTR(block, key(ivLetter, aes.BlockSize)),
+		mac:    hmac.New(mac.hash, key(macLetter, mac.keySize)),
+		etm:    mac.etm,
+	}, nil
+}
+
+type sshCipherSpec struct {
+	keySize int
+	// AES-GCM, which needs no MAC
+	aead bool
+}
+
+var sshCipherSpecs = map[string]sshCipherSpec{
+	"aes128-ctr":             {keySize: 16},
+	"aes192-ctr":             {keySize: 24},
+	"aes256-ctr":             {keySize: 32},
+	"aes128-gcm@openssh.com": {keySize: 16, aead: true},
+	"aes256-gcm@openssh.com": {keySize: 32, aead: true},
+}
+
+type sshMacSpec struct {
+	keySize int
+	hash    func() hash.Hash
+	// Encrypt-then-MAC, the length is sent in the clear
+	etm bool
+}
+
+var sshMacSpecs = map[string]sshMacSpec{
+	"hmac-sha2-256-etm@openssh.com": {keySize: 32, hash: sha256.New, etm: true},
+	"hmac-sha2-512-etm@openssh.com": {keySize: 64, hash: sha512.New, etm: true},
+	"hmac-sha2-256":                 {keySize: 32, hash: sha256.New},
+	"hmac-sha2-512":                 {keySize: 64, hash: sha512.New},
+	"hmac-sha1":                     {keySize: 20, hash: sha1.New},
+}
+
+// sshPacketCipher reads and writes the binary packets of one direction
+type sshPacketCipher interface {
+	readPacket(reader *bufio.Reader, sequence uint32) ([]byte, error)
+	writePacket(writer io.Writer, sequence uint32, payload []byte) error
+}
+
+// newSshPacket returns the packet of a payload, its length first, padded to
+// whole blocks. The length is left out of the blocks when it is sent in the
+// clear.
+func newSshPacket(payload []byte, blockSize int, clearLength bool) []byte {
+	size := 1 + len(payload)
+	if !clearLength {
+		size += 4
+	}
+	padding := blockSize - size%blockSize
+	if padding < 4 {
+		padding += blockSize
+	}
+	packet := binary.BigEndian.AppendUint32(nil, uint32(1+len(payload)+padding))
+	packet = append(packet, byte(padding))
+	packet = append(packet, payload...)
+	paddingBytes := make([]byte, padding)
+	rand.Read(paddingBytes)
+	return append(packet, paddingBytes...)
+}
+
+// sshPayload returns the payload of a packet, less its length
+func sshPayload(packet []byte) ([]byte, error) {
+	if len(packet) < 1 || int(packet[0])+1 > len(packet) {
+		return nil, errors.New("invalid SSH packet padding")
+	}
+	return packet[1 : len(packet)-int(packet[0])], nil
+}
+
+// readSshLength reads the clear length of a packet, which must fill whole
+// blocks
+func readSshLength(reader io.Reader, blockSize int) ([]byte, int, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, 0, err
+	}
+	length := binary.BigEndian.Uint32(header)
+	if length < 5 || length > sshMaxPacketLength || length%uint32(blockSize) != 0 {
+		return nil, 0, fmt.Errorf("invalid SSH packet length %d", length)
+	}
+	return header, int(length), nil
+}
+
+// Packets before the first key exchange
+type sshPlainCipher struct{}
+
+func (sshPlainCipher) readPacket(reader *bufio.Reader, sequence uint32) ([]byte, error) {
+	return readSshPacket(reader)
+}
+
+func (sshPlainCipher) writePacket(writer io.Writer, sequence uint32, payload []byte) error {
+	_, err := writer.Write(newSshPacket(payload, 8, false))
+	return err
+}
+
+// AES-CTR with an HMAC, encrypt-and-MAC or encrypt-then-MAC
+type sshCtrCipher struct {
+	stream cipher.Stream
+	mac    hash.Hash
+	etm    bool
+}
+
+func (c *sshCtrCipher) sum(sequence uint32, data ...[]byte) []byte {
+	c.mac.Reset()
+	c.mac.Write(binary.BigEndian.AppendUint32(nil, sequence))
+	for _, d := range data {
+		c.mac.Write(d)
+	}
+	return c.mac.Sum(nil)
+}
+
+func (c *sshCtrCipher) readPacket(reader *bufio.Reader, sequence uint32) ([]byte, error) {
+	if c.etm {
+		header, length, err := readSshLength(reader, aes.BlockSize)
+		if err != nil {
+			return nil, err
+		}
+		body := make([]byte, length+c.mac.Size())
+		if _, err := io.ReadFull(reader, body); err != nil {
+			return nil, err
+		}
+		body, mac := body[:length], body[length:]
+		if !hmac.Equal(mac, c.sum(sequence, header, body)) {
+			return nil, errors.New("invalid SSH packet MAC")
+		}
+		c.stream.XORKeyStream(body, body)
+		return sshPayload(body)
+	}
+
+	first := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(reader, first); err != nil {
+		return nil, err
+	}
+	c.stream.XORKeyStream(first, first)
+	length := binary.BigEndian.Uint32(first[:4])
+	if length > sshMaxPacketLength || (4+length)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("invalid SSH packet length %d", length)
+	}
+	packet := make([]byte, 4+int(length)+c.mac.Size())
+	copy(packet, first)
+	if _, err := io.ReadFull(reader, packet[len(first):]); err != nil {
+		return nil, err
+	}
+	packet, mac := packet[:4+length], packet[4+length:]
+	c.stream.XORKeyStream(packet[len(first):], packet[len(first):])
+	if !hmac.Equal(mac, c.sum(sequence, packet)) {
+		return nil, errors.New("invalid SSH packet MAC")
+	}
+	return sshPayload(packet[4:])
+}
+
+func (c *sshCtrCipher) writePacket(writer io.Writer, sequence uint32, payload []byte) error {
+	packet := newSshPacket(payload, aes.BlockSize, c.etm)
+	var mac []byte
+	if c.etm {
+		c.stream.XORKeyStream(packet[4:], packet[4:])
+		mac = c.sum(sequence, packet)
+	} else {
+		mac = c.sum(sequence, packet)
+		c.stream.XORKeyStream(packet, packet)
+	}
+	_, err := writer.Write(append(packet, mac...))
+	return err
+}
+
+// AES-GCM of RFC 5647 as OpenSSH implements it, the length is authenticated
+// but sent in the clear
+type sshGcmCipher struct {
+	aead cipher.AEAD
+	// Fixed field and invocation counter
+	nonce []byte
+}
+
+func (c *sshGcmCipher) next() {
+	counter := binary.BigEndian.Uint64(c.nonce[4:])
+	binary.BigEndian.PutUint64(c.nonce[4:], counter+1)
+}
+
+func (c *sshGcmCipher) readPacket(reader *bufio.Reader, sequence uint32) ([]byte, error) {
+	header, length, err := readSshLength(reader, aes.BlockSize)
+	if err != nil {
+		return nil, err
+	}
+	body := make([]byte, length+c.aead.Overhead())
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return nil, err
+	}
+	body, err = c.aead.Open(body[:0], c.nonce, body, header)
+	if err != nil {
+		return nil, err
+	}
+	c.next()
+	return sshPayload(body)
+}
+
+func (c *sshGcmCipher) writePacket(writer io.Writer, sequence uint32, payload []byte) error {
+	packet := newSshPacket(payload, aes.BlockSize, true)
+	sealed := c.aead.Seal(packet[:4], c.nonce, packet[4:], packet[:4])
+	c.next()
+	_, err := writer.Write(sealed)
+	return err
+}
+
+// appendSshString appends s with its length
+func appendSshString(b []byte, s []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+// appendSshMpint appends a non-negative integer in two's complement, with
+// its length
+func appendSshMpint(b []byte, n *big.Int) []byte {
+	bytes := n.Bytes()
+	if len(bytes) > 0 && bytes[0]&0x80 != 0 {
+		bytes = append([]byte{0}, bytes...)
+	}
+	return appendSshString(b, bytes)
+}
+
+// readSshString splits a string, or name-list, from the data that follows
+// it
+func readSshString(data []byte) (s []byte, rest []byte, ok bool) {
+	if len(data) < 4 {
+		return nil, nil, false
+	}
+	length := binary.BigEndian.Uint32(data)
+	if uint64(length) > uint64(len(data)-4) {
+		return nil, nil, false
+	}
+	return data[4 : 4+length], data[4+length:], true
+}
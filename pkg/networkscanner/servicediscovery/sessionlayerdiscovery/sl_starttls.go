@@ -0,0 +1,408 @@
+package sessionlayerdiscovery
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
+)
+
+const (
+	// Name the scanner greets servers with
+	startTlsClientName = "kubescape-network-scanner"
+	// Longest line or element read during a negotiation
+	startTlsMaxLine = 4096
+	// Most data read while waiting for an answer
+	startTlsMaxRead = 64 * 1024
+)
+
+var (
+	errStartTlsNotOffered = errors.New("STARTTLS not offered")
+	errNoStartTls         = errors.New("no STARTTLS upgrade for this protocol")
+)
+
+// Negotiates STARTTLS over a fresh plaintext connection, up to the point
+// where the server waits for the TLS handshake. Returns
+// errStartTlsNotOffered if the server declines.
+type startTlsUpgrade func(conn *startTlsConn) error
+
+type startTlsProtocol struct {
+	upgrade startTlsUpgrade
+	// Tells over a fresh plaintext connection whether the server refuses
+	// to go on without TLS
+	required func(conn *startTlsConn) (bool, error)
+	// The required check attempts a login, it only runs with
+	// TlsOptions.StartTlsLogin
+	login bool
+}
+
+// Protocols upgraded in-band, by the name of their application layer
+// discovery
+var startTlsProtocols = map[string]startTlsProtocol{
+	"postgresql": {upgrade: upgradePostgres, required: postgresRequiresTls, login: true},
+	"mysql":      {upgrade: upgradeMysql, required: mysqlRequiresTls, login: true},
+	"smtp":       {upgrade: upgradeSmtp, required: smtpRequiresTls},
+	"ldap":       {upgrade: upgradeLdap, required: ldapRequiresTls},
+	"imap":       {upgrade: upgradeImap, required: imapRequiresTls},
+	"xmpp":       {upgrade: upgradeXmpp, required: xmppRequiresTls},
+}
+
+// SupportsStartTls tells whether an application layer protocol can be
+// upgraded to TLS by DiscoverStartTls
+func SupportsStartTls(protocol string) bool {
+	_, ok := startTlsProtocols[protocol]
+	return ok
+}
+
+// DiscoverStartTls checks whether the server of an application protocol
+// upgrades to TLS in-band and requires it. When it does, the upgraded
+// session is discovered like direct TLS, and its result returns handlers
+// that upgrade every connection they open.
+//
+// Whether STARTTLS is offered is only told by the capabilities of the
+// server: the SSL flag of the MySQL greeting, the answer to the PostgreSQL
+// SSLRequest and the STARTTLS capability or feature of the others.
+// Whether TLS is required is told by the answer to MAIL FROM for SMTP; by the
+// LOGINDISABLED capability for IMAP; by the stream features for XMPP; and
+// by an anonymous root DSE search for LDAP. For PostgreSQL and MySQL it
+// takes a plaintext login attempt, which only shows when the server checks
+// transport security before credentials, and is only made with
+// TlsOptions.StartTlsLogin.
+func DiscoverStartTls(ctx context.Context, host string, port int, protocol string) (servicediscovery.StartTlsStatus, servicediscovery.ITlsSessionLayerDiscoveryResult, error) {
+	var status servicediscovery.StartTlsStatus
+	startTls, ok := startTlsProtocols[protocol]
+	if !ok {
+		return status, nil, errNoStartTls
+	}
+	options := servicediscovery.TlsOptionsFromContext(ctx)
+
+	if !startTls.login || options.StartTlsLogin {
+		required, err := checkStartTlsRequired(ctx, host, port, options, startTls)
+		if err != nil {
+			log.Debugf("Failed to check whether %s requires TLS: %v", protocol, err)
+		}
+		status.Required = required
+	}
+
+	// Whether the server agreed is only known from within the negotiation
+	upgrade := func(conn *startTlsConn) error {
+		err := startTls.upgrade(conn)
+		if err == nil {
+			status.Offered = true
+		}
+		return err
+	}
+	result, err := discoverTls(ctx, host, port, upgrade)
+	if errors.Is(err, errStartTlsNotOffered) {
+		return status, nil, nil
+	}
+	if err != nil {
+		return status, nil, err
+	}
+	result.upgrade = startTls.upgrade
+	return status, result, nil
+}
+
+func checkStartTlsRequired(ctx context.Context, host string, port int, options servicediscovery.TlsOptions, startTls startTlsProtocol) (bool, error) {
+	conn, err := dialTCP(ctx, host, port)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	stop := closeOnDone(ctx, conn)
+	defer stop()
+
+	return startTls.required(newStartTlsConn(conn, servicediscovery.TimingFromContext(ctx), host, options.ServerName))
+}
+
+// Plaintext connection of a STARTTLS negotiation. Every read and write has
+// its own deadline.
+type startTlsConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	timing servicediscovery.Timing
+	// Name the server is addressed by, the server name or else the host
+	domain string
+}
+
+func newStartTlsConn(conn net.Conn, timing servicediscovery.Timing, host string, serverName string) *startTlsConn {
+	domain := serverName
+	if domain == "" {
+		domain = host
+	}
+	return &startTlsConn{conn: conn, reader: bufio.NewReaderSize(conn, startTlsMaxLine), timing: timing, domain: domain}
+}
+
+func (c *startTlsConn) write(data []byte) error {
+	c.conn.SetWriteDeadline(ioDeadline(c.timing))
+	_, err := c.conn.Write(data)
+	return err
+}
+
+func (c *startTlsConn) writeString(data string) error {
+	return c.write([]byte(data))
+}
+
+// readLine reads a line without its end
+func (c *startTlsConn) readLine() (string, error) {
+	c.conn.SetReadDeadline(ioDeadline(c.timing))
+	line, err := c.reader.ReadSlice('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+func (c *startTlsConn) readFull(length int) ([]byte, error) {
+	c.conn.SetReadDeadline(ioDeadline(c.timing))
+	data := make([]byte, length)
+	_, err := io.ReadFull(c.reader, data)
+	return data, err
+}
+
+// readElements reads XML elements until the data read contains one of the
+// markers
+func (c *startTlsConn) readElements(markers ...string) (string, error) {
+	var data strings.Builder
+	for data.Len() < startTlsMaxRead {
+		c.conn.SetReadDeadline(ioDeadline(c.timing))
+		element, err := c.reader.ReadSlice('>')
+		data.Write(element)
+		if err != nil && !errors.Is(err, bufio.ErrBufferFull) {
+			return data.String(), err
+		}
+		for _, marker := range markers {
+			if strings.Contains(data.String(), marker) {
+				return data.String(), nil
+			}
+		}
+	}
+	return data.String(), fmt.Errorf("no %s within %d bytes", strings.Join(markers, " or "), startTlsMaxRead)
+}
+
+// readSmtpReply reads a reply, which spans several lines when the code of
+// all but the last one is followed by a dash, and returns the code and the
+// text of each line
+func readSmtpReply(conn *startTlsConn) (int, []string, error) {
+	var lines []string
+	for len(lines) < 100 {
+		line, err := conn.readLine()
+		if err != nil {
+			return 0, lines, err
+		}
+		if len(line) < 3 {
+			return 0, lines, fmt.Errorf("not an SMTP reply: %q", line)
+		}
+		code, err := strconv.Atoi(line[:3])
+		if err != nil {
+			return 0, lines, fmt.Errorf("not an SMTP reply: %q", line)
+		}
+		if len(line) == 3 || line[3] == ' ' {
+			return code, append(lines, strings.TrimSpace(line[3:])), nil
+		}
+		lines = append(lines, strings.TrimSpace(line[4:]))
+	}
+	return 0, lines, errors.New("SMTP reply too long")
+}
+
+// smtpEhlo reads the greeting and returns the extensions of the EHLO reply
+func smtpEhlo(conn *startTlsConn) ([]string, error) {
+	if code, _, err := readSmtpReply(conn); err != nil || code != 220 {
+		return nil, fmt.Errorf("unexpected SMTP greeting %d: %v", code, err)
+	}
+	if err := conn.writeString("EHLO " + startTlsClientName + "\r\n"); err != nil {
+		return nil, err
+	}
+	code, lines, err := readSmtpReply(conn)
+	if err != nil || code != 250 {
+		return nil, fmt.Errorf("unexpected SMTP EHLO reply %d: %v", code, err)
+	}
+	// The first line greets the client
+	return lines[1:], nil
+}
+
+func hasSmtpExtension(extensions []string, name string) bool {
+	return slices.ContainsFunc(extensions, func(extension string) bool {
+		keyword, _, _ := strings.Cut(extension, " ")
+		return strings.EqualFold(keyword, name)
+	})
+}
+
+func upgradeSmtp(conn *startTlsConn) error {
+	extensions, err := smtpEhlo(conn)
+	if err != nil {
+		return err
+	}
+	if !hasSmtpExtension(extensions, "STARTTLS") {
+		return errStartTlsNotOffered
+	}
+	if err := conn.writeString("STARTTLS\r\n"); err != nil {
+		return err
+	}
+	code, _, err := readSmtpReply(conn)
+	if err != nil {
+		return err
+	}
+	if code != 220 {
+		return errStartTlsNotOffered
+	}
+	return nil
+}
+
+// smtpRequiresTls starts a mail transaction with the null sender, which
+// servers requiring TLS refuse with 530
+func smtpRequiresTls(conn *startTlsConn) (bool, error) {
+	if _, err := smtpEhlo(conn); err != nil {
+		return false, err
+	}
+	if err := conn.writeString("MAIL FROM:<>\r\n"); err != nil {
+		return false, err
+	}
+	code, _, err := readSmtpReply(conn)
+	if err != nil {
+		return false, err
+	}
+	conn.writeString("QUIT\r\n")
+	return code == 530, nil
+}
+
+// imapCommand sends a tagged command and returns the untagged lines of the
+// answer and the status of its tagged line
+func imapCommand(conn *startTlsConn, tag string, command string) ([]string, string, error) {
+	if err := conn.writeString(tag + " " + command + "\r\n"); err != nil {
+		return nil, "", err
+	}
+	var untagged []string
+	for len(untagged) < 100 {
+		line, err := conn.readLine()
+		if err != nil {
+			return untagged, "", err
+		}
+		if rest, ok := strings.CutPrefix(line, tag+" "); ok {
+			status, _, _ := strings.Cut(rest, " ")
+			return untagged, strings.ToUpper(status), nil
+		}
+		untagged = append(untagged, line)
+	}
+	return untagged, "", errors.New("IMAP answer too long")
+}
+
+// imapCapabilities reads the greeting and asks for the capabilities
+func imapCapabilities(conn *startTlsConn) ([]string, error) {
+	greeting, err := conn.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(greeting, "* PREAUTH") {
+		// TLS can only be started before authentication
+		return nil, errStartTlsNotOffered
+	}
+	if !strings.HasPrefix(greeting, "* OK") {
+		return nil, fmt.Errorf("unexpected IMAP greeting %q", greeting)
+	}
+	untagged, status, err := imapCommand(conn, "a1", "CAPABILITY")
+	if err != nil {
+		return nil, err
+	}
+	if status != "OK" {
+		return nil, fmt.Errorf("IMAP CAPABILITY failed with %s", status)
+	}
+	for _, line := range untagged {
+		if capabilities, ok := strings.CutPrefix(strings.ToUpper(line), "* CAPABILITY "); ok {
+			return strings.Fields(capabilities), nil
+		}
+	}
+	return nil, nil
+}
+
+func upgradeImap(conn *startTlsConn) error {
+	capabilities, err := imapCapabilities(conn)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(capabilities, "STARTTLS") {
+		return errStartTlsNotOffered
+	}
+	_, status, err := imapCommand(conn, "a2", "STARTTLS")
+	if err != nil {
+		return err
+	}
+	if status != "OK" {
+		return errStartTlsNotOffered
+	}
+	return nil
+}
+
+// imapRequiresTls checks for LOGINDISABLED, which servers announce when
+// they refuse plaintext logins
+func imapRequiresTls(conn *startTlsConn) (bool, error) {
+	capabilities, err := imapCapabilities(conn)
+	if err != nil {
+		return false, err
+	}
+	conn.writeString("a2 LOGOUT\r\n")
+	return slices.Contains(capabilities, "LOGINDISABLED"), nil
+}
+
+const xmppTlsNamespace = "urn:ietf:params:xml:ns:xmpp-tls"
+
+// xmppFeatures opens a client stream and returns the stream features
+func xmppFeatures(conn *startTlsConn) (string, error) {
+	header := fmt.Sprintf("<?xml version='1.0'?><stream:stream to='%s' xmlns='jabber:client' xmlns:stream='http://etherx.jabber.org/streams' version='1.0'>", conn.domain)
+	if err := conn.writeString(header); err != nil {
+		return "", err
+	}
+	features, err := conn.readElements("</stream:features>", "</stream:error>")
+	if err != nil {
+		return "", err
+	}
+	if !strings.Contains(features, "<stream:features") {
+		return "", errors.New("no XMPP stream features")
+	}
+	return features, nil
+}
+
+func upgradeXmpp(conn *startTlsConn) error {
+	features, err := xmppFeatures(conn)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(features, xmppTlsNamespace) {
+		return errStartTlsNotOffered
+	}
+	if err := conn.writeString("<starttls xmlns='" + xmppTlsNamespace + "'/>"); err != nil {
+		return err
+	}
+	answer, err := conn.readElements("<proceed", "<failure")
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(answer, "<proceed") {
+		return errStartTlsNotOffered
+	}
+	return nil
+}
+
+// xmppRequiresTls looks for the required child of the starttls feature
+func xmppRequiresTls(conn *startTlsConn) (bool, error) {
+	features, err := xmppFeatures(conn)
+	if err != nil {
+		return false, err
+	}
+	conn.writeString("</stream:stream>")
+	_, starttls, found := strings.Cut(features, xmppTlsNamespace)
+	if !found {
+		return false, nil
+	}
+	starttls, _, _ = strings.Cut(starttls, "</starttls>")
+	return strings.Contains(starttls, "<required"), nil
+}
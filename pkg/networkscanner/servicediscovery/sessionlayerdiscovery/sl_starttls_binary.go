@@ -0,0 +1,287 @@
+package sessionlayerdiscovery
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
+)
+
+// PostgreSQL SSLRequest, a length of 8 and the code 80877103
+var postgresSslRequest = []byte{0x00, 0x00, 0x00, 0x08, 0x04, 0xd2, 0x16, 0x2f}
+
+func upgradePostgres(conn *startTlsConn) error {
+	if err := conn.write(postgresSslRequest); err != nil {
+		return err
+	}
+	answer, err := conn.readFull(1)
+	if err != nil {
+		return err
+	}
+	switch answer[0] {
+	case 'S':
+		return nil
+	case 'N':
+		return errStartTlsNotOffered
+	}
+	return fmt.Errorf("unexpected answer %q to the PostgreSQL SSLRequest", answer[0])
+}
+
+// postgresRequiresTls starts a plaintext session as user postgres, which
+// servers allowing only TLS sessions refuse before any authentication
+func postgresRequiresTls(conn *startTlsConn) (bool, error) {
+	parameters := "user\x00postgres\x00database\x00postgres\x00\x00"
+	startup := binary.BigEndian.AppendUint32(nil, uint32(8+len(parameters)))
+	startup = binary.BigEndian.AppendUint32(startup, 3<<16) // Protocol 3.0
+	startup = append(startup, parameters...)
+	if err := conn.write(startup); err != nil {
+		return false, err
+	}
+
+	header, err := conn.readFull(5)
+	if err != nil {
+		return false, err
+	}
+	if header[0] != 'E' {
+		// Authentication request, the transport was accepted
+		return false, nil
+	}
+	length := int(binary.BigEndian.Uint32(header[1:]))
+	if length < 4 || length > startTlsMaxRead {
+		return false, errors.New("invalid PostgreSQL message length")
+	}
+	message, err := conn.readFull(length - 4)
+	if err != nil {
+		return false, err
+	}
+	// pg_hba.conf rejections end with "no encryption", or "SSL off" before
+	// PostgreSQL 12
+	return bytes.Contains(message, []byte("no encryption")) || bytes.Contains(message, []byte("SSL off")), nil
+}
+
+// MySQL capability flags
+const (
+	mysqlClientProtocol41       = 0x00000200
+	mysqlClientSsl              = 0x00000800
+	mysqlClientSecureConnection = 0x00008000
+	mysqlClientPluginAuth       = 0x00080000
+	// Error sent when require_secure_transport refuses a connection
+	mysqlErrSecureTransportRequired = 3159
+)
+
+// readMysqlPacket returns the payload of the next packet
+func readMysqlPacket(conn *startTlsConn) ([]byte, error) {
+	header, err := conn.readFull(4)
+	if err != nil {
+		return nil, err
+	}
+	length := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	if length > startTlsMaxRead {
+		return nil, errors.New("MySQL packet too long")
+	}
+	return conn.readFull(length)
+}
+
+// writeMysqlPacket sends the payload as the packet of the given sequence
+// number
+func writeMysqlPacket(conn *startTlsConn, sequence byte, payload []byte) error {
+	length := len(payload)
+	packet := append([]byte{byte(length), byte(length >> 8), byte(length >> 16), sequence}, payload...)
+	return conn.write(packet)
+}
+
+// mysqlCapabilities reads the greeting of the server and returns its
+// capability flags
+func mysqlCapabilities(conn *startTlsConn) (uint32, error) {
+	greeting, err := readMysqlPacket(conn)
+	if err != nil {
+		return 0, err
+	}
+	if len(greeting) == 0 || greeting[0] != 10 {
+		return 0, errors.New("not a MySQL protocol 10 greeting")
+	}
+	// Version, connection ID, first part of the auth data, filler, lower
+	// capability flags, charset, status and upper capability flags
+	end := bytes.IndexByte(greeting[1:], 0)
+	if end < 0 {
+		return 0, errors.New("truncated MySQL greeting")
+	}
+	rest := greeting[1+end+1:]
+	if len(rest) < 15 {
+		return 0, errors.New("truncated MySQL greeting")
+	}
+	capabilities := uint32(binary.LittleEndian.Uint16(rest[13:15]))
+	if len(rest) >= 20 {
+		capabilities |= uint32(binary.LittleEndian.Uint16(rest[18:20])) << 16
+	}
+	return capabilities, nil
+}
+
+// mysqlHandshakeResponse starts a HandshakeResponse41 with the maximal
+// packet size, the utf8 charset and the reserved bytes
+func mysqlHandshakeResponse(capabilities uint32) []byte {
+	response := binary.LittleEndian.AppendUint32(nil, capabilities)
+	response = binary.LittleEndian.AppendUint32(response, 1<<24)
+	response = append(response, 33)
+	return append(response, make([]byte, 23)...)
+}
+
+func upgradeMysql(conn *startTlsConn) error {
+	capabilities, err := mysqlCapabilities(conn)
+	if err != nil {
+		return err
+	}
+	if capabilities&mysqlClientSsl == 0 {
+		return errStartTlsNotOffered
+	}
+	// SSLRequest, the handshake response truncated before the user name
+	return writeMysqlPacket(conn, 1, mysqlHandshakeResponse(mysqlClientSsl|mysqlClientProtocol41|mysqlClientSecureConnection))
+}
+
+// mysqlRequiresTls logs in as root without a password, which
+// require_secure_transport refuses with its own error when it is checked
+// before the credentials
+func mysqlRequiresTls(conn *startTlsConn) (bool, error) {
+	if _, err := mysqlCapabilities(conn); err != nil {
+		return false, err
+	}
+	response := mysqlHandshakeResponse(mysqlClientProtocol41 | mysqlClientSecureConnection | mysqlClientPluginAuth)
+	response = append(response, "root\x00"...)
+	response = append(response, 0) // No auth data
+	response = append(response, "mysql_native_password\x00"...)
+	if err := writeMysqlPacket(conn, 1, response); err != nil {
+		return false, err
+	}
+
+	answer, err := readMysqlPacket(conn)
+	if err != nil {
+		return false, err
+	}
+	return len(answer) >= 3 && answer[0] == 0xff && binary.LittleEndian.Uint16(answer[1:3]) == mysqlErrSecureTransportRequired, nil
+}
+
+// LDAP protocol operations
+const (
+	ldapSearchResultEntry = 0x64 // [APPLICATION 4]
+	ldapSearchResultDone  = 0x65 // [APPLICATION 5]
+	ldapExtendedResponse  = 0x78 // [APPLICATION 24]
+)
+
+// LDAP result codes
+const (
+	ldapSuccess                 = 0
+	ldapConfidentialityRequired = 13
+)
+
+// StartTLS extended request of message ID 1
+var ldapStartTlsRequest = append([]byte{0x30, 0x1d, 0x02, 0x01, 0x01, 0x77, 0x18, 0x80, 0x16}, "1.3.6.1.4.1.1466.20037"...)
+
+// Search of the root DSE with message ID 1, asking for no attribute
+var ldapRootDseSearch = append(append([]byte{
+	0x30, 0x25, 0x02, 0x01, 0x01, 0x63, 0x20,
+	0x04, 0x00, // Empty base object
+	0x0a, 0x01, 0x00, // Base object scope
+	0x0a, 0x01, 0x00, // Never dereference aliases
+	0x02, 0x01, 0x00, // No size limit
+	0x02, 0x01, 0x00, // No time limit
+	0x01, 0x01, 0x00, // Types and values
+	0x87, 0x0b, // Present filter
+}, "objectClass"...), 0x30, 0x00)
+
+// readLdapMessage returns the protocol operation of the next message and
+// its content
+func readLdapMessage(conn *startTlsConn) (byte, []byte, error) {
+	header, err := conn.readFull(2)
+	if err != nil {
+		return 0, nil, err
+	}
+	if header[0] != servicediscovery.BER_SEQUENCE {
+		return 0, nil, errors.New("not an LDAP message")
+	}
+	length := uint32(header[1])
+	if length&0x80 != 0 {
+		// Long form, the low bits give the number of length bytes
+		size := int(length & 0x7f)
+		if size == 0 || size > 4 {
+			return 0, nil, errors.New("invalid LDAP message length")
+		}
+		lengthBytes, err := conn.readFull(size)
+		if err != nil {
+			return 0, nil, err
+		}
+		length = 0
+		for _, b := range lengthBytes {
+			length = length<<8 | uint32(b)
+		}
+	}
+	if length > startTlsMaxRead {
+		return 0, nil, errors.New("LDAP message too long")
+	}
+	content, err := conn.readFull(int(length))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// Message ID, then the protocol operation
+	_, _, rest, err := servicediscovery.ReadBER(content)
+	if err != nil {
+		return 0, nil, err
+	}
+	tag, operation, _, err := servicediscovery.ReadBER(rest)
+	return tag, operation, err
+}
+
+// ldapResultCode reads the result code that starts an LDAPResult
+func ldapResultCode(result []byte) (int, error) {
+	tag, code, _, err := servicediscovery.ReadBER(result)
+	if err != nil || tag != servicediscovery.BER_ENUMERATED {
+		return 0, errors.New("malformed LDAP result")
+	}
+	return servicediscovery.BERInt(code)
+}
+
+func upgradeLdap(conn *startTlsConn) error {
+	if err := conn.write(ldapStartTlsRequest); err != nil {
+		return err
+	}
+	tag, operation, err := readLdapMessage(conn)
+	if err != nil {
+		return err
+	}
+	if tag != ldapExtendedResponse {
+		return errors.New("unexpected answer to the LDAP StartTLS request")
+	}
+	code, err := ldapResultCode(operation)
+	if err != nil {
+		return err
+	}
+	if code != ldapSuccess {
+		return errStartTlsNotOffered
+	}
+	return nil
+}
+
+// ldapRequiresTls searches the root DSE anonymously, which servers
+// requiring TLS refuse with confidentialityRequired
+func ldapRequiresTls(conn *startTlsConn) (bool, error) {
+	if err := conn.write(ldapRootDseSearch); err != nil {
+		return false, err
+	}
+	for i := 0; i < 10; i++ {
+		tag, operation, err := readLdapMessage(conn)
+		if err != nil {
+			return false, err
+		}
+		switch tag {
+		case ldapSearchResultEntry:
+			continue
+		case ldapSearchResultDone:
+			code, err := ldapResultCode(operation)
+			return code == ldapConfidentialityRequired, err
+		}
+		return false, fmt.Errorf("unexpected LDAP operation %#x", tag)
+	}
+	return false, errors.New("too many LDAP search results")
+}
@@ -1,17 +1,12 @@
 package sessionlayerdiscovery
 
 import (
-	"fmt"
+	"context"
 	"net"
-	"time"
 
 	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
 )
 
-const (
-	DEFAULT_TIMEOUT = 1
-)
-
 type TcpSessionDiscovery struct {
 }
 
@@ -20,17 +15,19 @@ type TcpSessionDiscoveryResult struct {
 	port int
 }
 type TcpSessionHandler struct {
-	host string
-	port int
-	conn net.Conn
+	host   string
+	port   int
+	conn   net.Conn
+	stop   func() bool
+	timing servicediscovery.Timing
 }
 
 func (d *TcpSessionDiscovery) Protocol() servicediscovery.TransportProtocol {
 	return servicediscovery.TCP
 }
 
-func (d *TcpSessionDiscovery) SessionLayerDiscover(hostAddr string, port int) (servicediscovery.ISessionLayerDiscoveryResult, error) {
-	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", hostAddr, port), time.Second*DEFAULT_TIMEOUT)
+func (d *TcpSessionDiscovery) SessionLayerDiscover(ctx context.Context, hostAddr string, port int) (servicediscovery.ISessionLayerDiscoveryResult, error) {
+	conn, err := dialTCP(ctx, hostAddr, port)
 	if err != nil {
 		return nil, err
 	}
@@ -55,24 +52,29 @@ func (d *TcpSessionDiscoveryResult) GetSessionHandler() (servicediscovery.ISessi
 	return &TcpSessionHandler{host: d.host, port: d.port}, nil
 }
 
-func (d *TcpSessionHandler) Connect() error {
-	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", d.host, d.port), time.Second*DEFAULT_TIMEOUT)
+func (d *TcpSessionHandler) Connect(ctx context.Context) error {
+	conn, err := dialTCP(ctx, d.host, d.port)
 	if err != nil {
 		return err
 	}
 	d.conn = conn
+	d.timing = servicediscovery.TimingFromContext(ctx)
+	d.stop = closeOnDone(ctx, conn)
 	return nil
 }
 
 func (d *TcpSessionHandler) Destory() error {
+	d.stop()
 	return d.conn.Close()
 }
 
 func (d *TcpSessionHandler) Write(data []byte) (int, error) {
+	d.conn.SetWriteDeadline(ioDeadline(d.timing))
 	return d.conn.Write(data)
 }
 
 func (d *TcpSessionHandler) Read(data []byte) (int, error) {
+	d.conn.SetReadDeadline(ioDeadline(d.timing))
 	return d.conn.Read(data)
 }
 
@@ -1,10 +1,14 @@
 package sessionlayerdiscovery
 
 import (
+	"context"
 	"crypto/tls"
-	"fmt"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
 	"net"
-	"time"
+	"reflect"
 
 	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
 )
@@ -13,43 +17,262 @@ type TlsSessionDiscovery struct {
 }
 
 type TlsSessionDiscoveryResult struct {
-	isTls bool
-	host  string
-	port  int
+	isTls        bool
+	host         string
+	port         int
+	state        tls.ConnectionState
+	verification servicediscovery.TlsVerification
+	// nil if the server did not ask for a client certificate
+	clientCertificateRequest *servicediscovery.TlsClientCertificateRequest
+	enumeration              *servicediscovery.TlsEnumeration // nil until enumerated
+	// STARTTLS negotiation of the application protocol, nil for TLS from
+	// the first byte
+	upgrade startTlsUpgrade
 }
 
 type TlsSessionHandler struct {
-	host string
-	port int
-	conn *tls.Conn
+	host    string
+	port    int
+	upgrade startTlsUpgrade
+	conn    net.Conn
+	stop    func() bool
+	timing  servicediscovery.Timing
 }
 
 func (d *TlsSessionDiscovery) Protocol() servicediscovery.TransportProtocol {
 	return servicediscovery.TCP
 }
 
-func (d *TlsSessionDiscovery) SessionLayerDiscover(hostAddr string, port int) (servicediscovery.ISessionLayerDiscoveryResult, error) {
-	// Create a dialer with a timeout of 50 ms
-	dialer := net.Dialer{
-		Timeout: 180 * time.Millisecond,
+func (d *TlsSessionDiscovery) SessionLayerDiscover(ctx context.Context, hostAddr string, port int) (servicediscovery.ISessionLayerDiscoveryResult, error) {
+	result, err := discoverTls(ctx, hostAddr, port, nil)
+	if err != nil {
+		return nil, err
 	}
+	return result, nil
+}
 
-	// Create a TLS config with InsecureSkipVerify set
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: true,
+// discoverTls handshakes without a client certificate first. A server that
+// refuses the handshake for lack of one is still detected, as requiring
+// mutual TLS, and the client certificate of the options is then tried on it.
+// An error is returned if the server sent no certificate.
+func discoverTls(ctx context.Context, host string, port int, upgrade startTlsUpgrade) (*TlsSessionDiscoveryResult, error) {
+	// The chain is verified after the handshake, so that servers with
+	// untrusted certificates are still detected
+	options := servicediscovery.TlsOptionsFromContext(ctx)
+	withoutCertificate := options
+	withoutCertificate.ClientCertificate = nil
+
+	handshake, err := handshakeTls(ctx, host, port, upgrade, withoutCertificate)
+	if handshake.state == nil {
+		return nil, err
+	}
+
+	result := &TlsSessionDiscoveryResult{
+		isTls:        true,
+		host:         host,
+		port:         port,
+		state:        *handshake.state,
+		verification: verifyTls(*handshake.state, options, host),
+		upgrade:      upgrade,
 	}
+	if handshake.request != nil {
+		result.clientCertificateRequest = &servicediscovery.TlsClientCertificateRequest{
+			Required:      mtlsRequired(err),
+			AcceptableCAs: distinguishedNames(handshake.request.AcceptableCAs),
+		}
+		if options.ClientCertificate != nil {
+			_, err := handshakeTls(ctx, host, port, upgrade, options)
+			result.clientCertificateRequest.Accepted = err == nil
+		}
+	}
+	return result, nil
+}
+
+// Discovery handshake, kept when it fails after the server sent its
+// certificate
+type tlsHandshake struct {
+	state   *tls.ConnectionState        // nil if no server certificate was received
+	request *tls.CertificateRequestInfo // nil if no client certificate was asked for
+}
 
-	// Dial with the specified dialer and TLS config
-	conn, err := tls.DialWithDialer(&dialer, "tcp", fmt.Sprintf("%s:%d", hostAddr, port), tlsConfig)
+// handshakeTls connects to host:port with the options and returns what the
+// server sent, and whether it refused the handshake
+func handshakeTls(ctx context.Context, host string, port int, upgrade startTlsUpgrade, options servicediscovery.TlsOptions) (tlsHandshake, error) {
+	var handshake tlsHandshake
+	// No protocol is offered through ALPN, so that the server answers as
+	// it would any client. The HTTP/2 probe negotiates h2 on a connection
+	// of its own.
+	tlsConfig := clientTlsConfig(options)
+	tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+		handshake.state = &state
+		return nil
+	}
+	getClientCertificate := tlsConfig.GetClientCertificate
+	tlsConfig.GetClientCertificate = func(request *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		handshake.request = request
+		return getClientCertificate(request)
+	}
+
+	// Dial within the connect timeout, handshake included
+	conn, err := dialTLS(ctx, host, port, upgrade, tlsConfig)
 	if err != nil {
-		return nil, err
+		return handshake, err
 	}
 	defer conn.Close()
 
-	return &TlsSessionDiscoveryResult{isTls: true, host: hostAddr, port: port}, nil
+	state := conn.ConnectionState()
+	handshake.state = &state
+	if handshake.request != nil && state.Version == tls.VersionTLS13 {
+		err = readTlsRefusal(ctx, conn)
+	}
+	return handshake, err
+}
+
+// readTlsRefusal waits for the alert of a TLS 1.3 server refusing the client
+// certificate, which it checks after the client finished its handshake.
+// Servers that accepted the handshake wait for the client to speak first,
+// or send data.
+func readTlsRefusal(ctx context.Context, conn *tls.Conn) error {
+	conn.SetReadDeadline(ioDeadline(servicediscovery.TimingFromContext(ctx)))
+	_, err := conn.Read(make([]byte, 1))
+	if err == nil || isTimeout(err) {
+		return nil
+	}
+	return err
+}
+
+// TLS alerts telling that the client certificate is missing
+const (
+	tlsAlertHandshakeFailure    = 40
+	tlsAlertBadCertificate      = 42
+	tlsAlertCertificateRequired = 116
+)
+
+// mtlsRequired tells from the error of a handshake in which the scanner
+// answered the certificate request with an empty Certificate message whether
+// the server requires a client certificate. Servers that predate the
+// certificate_required alert of TLS 1.3 refuse the empty certificate with
+// handshake_failure or bad_certificate; any other failure does not tell, and
+// nil is returned.
+func mtlsRequired(err error) *bool {
+	required := err != nil
+	if !required {
+		return &required
+	}
+	alert, ok := receivedTlsAlert(err)
+	if !ok || (alert != tlsAlertCertificateRequired && alert != tlsAlertHandshakeFailure && alert != tlsAlertBadCertificate) {
+		return nil
+	}
+	return &required
+}
+
+// receivedTlsAlert returns the alert the server ended the connection with.
+// crypto/tls does not export the type of received alerts, only that they
+// are uint8 wrapped in a "remote error".
+func receivedTlsAlert(err error) (uint8, bool) {
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) || opErr.Op != "remote error" || opErr.Err == nil {
+		return 0, false
+	}
+	value := reflect.ValueOf(opErr.Err)
+	if value.Kind() != reflect.Uint8 {
+		return 0, false
+	}
+	return uint8(value.Uint()), true
+}
+
+// clientTlsConfig returns the config of discovery connections, which accept
+// any certificate, send the server name of the options as SNI and present
+// the client certificate of the options to any server asking for one,
+// whichever CAs it accepts
+func clientTlsConfig(options servicediscovery.TlsOptions) *tls.Config {
+	return &tls.Config{
+		InsecureSkipVerify: true,
+		ServerName:         options.ServerName,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if options.ClientCertificate != nil {
+				return options.ClientCertificate, nil
+			}
+			// Sends no certificate
+			return &tls.Certificate{}, nil
+		},
+	}
+}
+
+// distinguishedNames decodes the DER names of the CAs a server accepts
+// client certificates from
+func distinguishedNames(rawNames [][]byte) []string {
+	var names []string
+	for _, rawName := range rawNames {
+		var sequence pkix.RDNSequence
+		if rest, err := asn1.Unmarshal(rawName, &sequence); err != nil || len(rest) > 0 {
+			continue
+		}
+		var name pkix.Name
+		name.FillFromRDNSequence(&sequence)
+		names = append(names, name.String())
+	}
+	return names
+}
+
+// verifyTls verifies the certificate chain of a session against the trust
+// anchors of the options and the system roots, and the leaf certificate
+// against the server name, or host if there is none
+func verifyTls(state tls.ConnectionState, options servicediscovery.TlsOptions, host string) servicediscovery.TlsVerification {
+	var verification servicediscovery.TlsVerification
+	if len(state.PeerCertificates) == 0 {
+		verification.Error = "no certificate sent"
+		return verification
+	}
+	leaf := state.PeerCertificates[0]
+	intermediates := x509.NewCertPool()
+	for _, certificate := range state.PeerCertificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+
+	type trustAnchor struct {
+		name  string
+		roots *x509.CertPool // nil for the system roots
+	}
+	var anchors []trustAnchor
+	if options.CABundle != nil {
+		anchors = append(anchors, trustAnchor{name: servicediscovery.TRUSTED_BY_CA_BUNDLE, roots: options.CABundle})
+	}
+	if options.ClusterCA != nil {
+		anchors = append(anchors, trustAnchor{name: servicediscovery.TRUSTED_BY_CLUSTER, roots: options.ClusterCA})
+	}
+	anchors = append(anchors, trustAnchor{name: servicediscovery.TRUSTED_BY_SYSTEM})
+
+	for _, anchor := range anchors {
+		_, err := leaf.Verify(x509.VerifyOptions{
+			Roots:         anchor.roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		})
+		if err == nil {
+			verification.Trusted = true
+			verification.TrustedBy = anchor.name
+			verification.Error = ""
+			break
+		}
+		// The error against the first anchor tried is the most telling
+		if verification.Error == "" {
+			verification.Error = err.Error()
+		}
+	}
+
+	serverName := options.ServerName
+	if serverName == "" {
+		serverName = host
+	}
+	verification.HostnameMismatch = leaf.VerifyHostname(serverName) != nil
+	return verification
 }
 
 func (d *TlsSessionDiscoveryResult) Protocol() servicediscovery.SessionLayerProtocol {
+	if d.upgrade != nil {
+		return servicediscovery.STARTTLS
+	}
 	return servicediscovery.TLS
 }
 
@@ -58,42 +281,77 @@ func (d *TlsSessionDiscoveryResult) GetIsDetected() bool {
 }
 
 func (d *TlsSessionDiscoveryResult) GetProperties() map[string]interface{} {
-	return nil
+	properties := map[string]interface{}{
+		"version":     tls.VersionName(d.state.Version),
+		"cipherSuite": tls.CipherSuiteName(d.state.CipherSuite),
+		"serverName":  d.state.ServerName,
+		"trusted":     d.verification.Trusted,
+	}
+	if d.clientCertificateRequest != nil {
+		if d.clientCertificateRequest.Required != nil {
+			properties["mtlsRequired"] = *d.clientCertificateRequest.Required
+		}
+		properties["acceptableCAs"] = d.clientCertificateRequest.AcceptableCAs
+	}
+	if d.enumeration != nil {
+		properties["versions"] = d.enumeration.Versions
+		properties["cipherSuites"] = d.enumeration.CipherSuites
+		properties["serverCipherPreference"] = d.enumeration.ServerCipherPreference
+		properties["weakCipherSuites"] = d.enumeration.WeakCipherSuites
+		properties["grade"] = d.enumeration.Grade
+	}
+	return properties
+}
+
+func (d *TlsSessionDiscoveryResult) GetConnectionState() tls.ConnectionState {
+	return d.state
+}
+
+func (d *TlsSessionDiscoveryResult) GetVerification() servicediscovery.TlsVerification {
+	return d.verification
+}
+
+func (d *TlsSessionDiscoveryResult) GetClientCertificateRequest() *servicediscovery.TlsClientCertificateRequest {
+	return d.clientCertificateRequest
 }
 
 func (d *TlsSessionDiscoveryResult) GetSessionHandler() (servicediscovery.ISessionHandler, error) {
-	return &TlsSessionHandler{host: d.host, port: d.port}, nil
+	return &TlsSessionHandler{host: d.host, port: d.port, upgrade: d.upgrade}, nil
 }
 
-func (d *TlsSessionHandler) Connect() error {
-	// Create a dialer with a timeout of 50 ms
-	dialer := net.Dialer{
-		Timeout: 180 * time.Millisecond,
-	}
+func (d *TlsSessionHandler) Connect(ctx context.Context) error {
+	_, err := d.ConnectALPN(ctx, nil)
+	return err
+}
 
-	// Create a TLS config with InsecureSkipVerify set
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: true,
-	}
+// ConnectALPN implements ITlsSessionHandler
+func (d *TlsSessionHandler) ConnectALPN(ctx context.Context, protocols []string) (string, error) {
+	tlsConfig := clientTlsConfig(servicediscovery.TlsOptionsFromContext(ctx))
+	tlsConfig.NextProtos = protocols
 
-	// Dial with the specified dialer and TLS config
-	conn, err := tls.DialWithDialer(&dialer, "tcp", fmt.Sprintf("%s:%d", d.host, d.port), tlsConfig)
+	// Dial within the connect timeout, handshake included
+	conn, err := dialTLS(ctx, d.host, d.port, d.upgrade, tlsConfig)
 	if err != nil {
-		return err
+		return "", err
 	}
 	d.conn = conn
-	return nil
+	d.timing = servicediscovery.TimingFromContext(ctx)
+	d.stop = closeOnDone(ctx, conn)
+	return conn.ConnectionState().NegotiatedProtocol, nil
 }
 
 func (d *TlsSessionHandler) Destory() error {
+	d.stop()
 	return d.conn.Close()
 }
 
 func (d *TlsSessionHandler) Write(data []byte) (int, error) {
+	d.conn.SetWriteDeadline(ioDeadline(d.timing))
 	return d.conn.Write(data)
 }
 
 func (d *TlsSessionHandler) Read(data []byte) (int, error) {
+	d.conn.SetReadDeadline(ioDeadline(d.timing))
 	return d.conn.Read(data)
 }
 
@@ -0,0 +1,320 @@
+package sessionlayerdiscovery
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/cryptobyte"
+
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
+)
+
+// Versions tried by the enumeration, oldest first. The TLS client cannot
+// speak SSL 3.0, so it is never tried.
+var enumeratedVersions = []uint16{tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12, tls.VersionTLS13}
+
+var errNoTlsVersion = errors.New("no TLS version accepted")
+
+const (
+	tlsRecordAlert          = 21
+	tlsRecordHandshake      = 22
+	tlsHandshakeClientHello = 1
+	tlsHandshakeServerHello = 2
+	tlsMaxRecordLength      = 16384 + 2048
+)
+
+// Enumerate offers every version alone, then every cipher suite alone with
+// each accepted version below TLS 1.3, one handshake each. The server
+// preference is checked by offering the accepted suites in both orders.
+func (d *TlsSessionDiscoveryResult) Enumerate(ctx context.Context) (servicediscovery.TlsEnumeration, error) {
+	options := servicediscovery.TlsOptionsFromContext(ctx)
+	enumeration := servicediscovery.TlsEnumeration{CipherSuites: map[string][]string{}}
+	var accepted []*tls.CipherSuite
+	// Suites accepted with the newest version that accepts at least two
+	var preferenceVersion uint16
+	var preferenceSuites []uint16
+
+	for _, version := range enumeratedVersions {
+		suites := cipherSuitesOf(version)
+		state, err := d.handshake(ctx, options, version, suiteIDs(suites))
+		if ctx.Err() != nil {
+			return enumeration, ctx.Err()
+		}
+		if err != nil {
+			log.Debugf("%s rejected: %v", tls.VersionName(version), err)
+			continue
+		}
+		name := tls.VersionName(version)
+		enumeration.Versions = append(enumeration.Versions, name)
+		if version == tls.VersionTLS13 {
+			enumeration.CipherSuites[name] = []string{tls.CipherSuiteName(state.CipherSuite)}
+			continue
+		}
+
+		var versionSuites []uint16
+		for _, suite := range suites {
+			_, err := d.handshake(ctx, options, version, []uint16{suite.ID})
+			if ctx.Err() != nil {
+				return enumeration, ctx.Err()
+			}
+			if err != nil {
+				continue
+			}
+			versionSuites = append(versionSuites, suite.ID)
+			enumeration.CipherSuites[name] = append(enumeration.CipherSuites[name], suite.Name)
+			if !slices.ContainsFunc(accepted, func(other *tls.CipherSuite) bool { return other.ID == suite.ID }) {
+				accepted = append(accepted, suite)
+			}
+		}
+		if len(versionSuites) >= 2 {
+			preferenceVersion, preferenceSuites = version, versionSuites
+		}
+	}
+	if len(enumeration.Versions) == 0 {
+		return enumeration, errNoTlsVersion
+	}
+
+	if preferenceSuites != nil {
+		preference, err := d.hasServerCipherPreference(ctx, options, preferenceVersion, preferenceSuites)
+		if err != nil {
+			log.Debugf("Failed to check the cipher suite preference: %v", err)
+		}
+		enumeration.ServerCipherPreference = preference
+	}
+	gradeTls(&enumeration, accepted)
+
+	d.enumeration = &enumeration
+	return enumeration, nil
+}
+
+// handshake connects with only the given version and cipher suites offered.
+// The server accepted them once it sent its certificate, even if it refuses
+// the client certificate afterwards.
+func (d *TlsSessionDiscoveryResult) handshake(ctx context.Context, options servicediscovery.TlsOptions, version uint16, suites []uint16) (tls.ConnectionState, error) {
+	var accepted *tls.ConnectionState
+	tlsConfig := clientTlsConfig(options)
+	tlsConfig.MinVersion = version
+	tlsConfig.MaxVersion = version
+	tlsConfig.CipherSuites = suites
+	tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+		accepted = &state
+		return nil
+	}
+
+	conn, err := dialTLS(ctx, d.host, d.port, d.upgrade, tlsConfig)
+	if err != nil {
+		if accepted != nil {
+			return *accepted, nil
+		}
+		return tls.ConnectionState{}, err
+	}
+	defer conn.Close()
+	return conn.ConnectionState(), nil
+}
+
+// hasServerCipherPreference tells whether the server picks the same cipher
+// suite whichever order the client offers them in. The TLS client orders
+// cipher suites by its own preference, so the hellos are written by hand.
+func (d *TlsSessionDiscoveryResult) hasServerCipherPreference(ctx context.Context, options servicediscovery.TlsOptions, version uint16, suites []uint16) (bool, error) {
+	forward, err := d.negotiateCipherSuite(ctx, options, version, suites)
+	if err != nil {
+		return false, err
+	}
+	reversedSuites := slices.Clone(suites)
+	slices.Reverse(reversedSuites)
+	reversed, err := d.negotiateCipherSuite(ctx, options, version, reversedSuites)
+	if err != nil {
+		return false, err
+	}
+	return forward == reversed, nil
+}
+
+// negotiateCipherSuite sends a ClientHello offering suites in the given
+// order and returns the cipher suite of the ServerHello
+func (d *TlsSessionDiscoveryResult) negotiateCipherSuite(ctx context.Context, options servicediscovery.TlsOptions, version uint16, suites []uint16) (uint16, error) {
+	conn, err := dialTCP(ctx, d.host, d.port)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	stop := closeOnDone(ctx, conn)
+	defer stop()
+
+	timing := servicediscovery.TimingFromContext(ctx)
+	if d.upgrade != nil {
+		if err := d.upgrade(newStartTlsConn(conn, timing, d.host, options.ServerName)); err != nil {
+			return 0, err
+		}
+	}
+	conn.SetDeadline(ioDeadline(timing))
+	if _, err := conn.Write(clientHello(version, suites, options.ServerName)); err != nil {
+		return 0, err
+	}
+	return readServerHelloCipherSuite(bufio.NewReader(conn))
+}
+
+// clientHello returns a TLS 1.2 or older ClientHello record with the
+// extensions ECDHE and RSA or ECDSA certificates need
+func clientHello(version uint16, suites []uint16, serverName string) []byte {
+	random := make([]byte, 32)
+	rand.Read(random)
+
+	var hello cryptobyte.Builder
+	hello.AddUint8(tlsRecordHandshake)
+	hello.AddUint16(tls.VersionTLS10)
+	hello.AddUint16LengthPrefixed(func(record *cryptobyte.Builder) {
+		record.AddUint8(tlsHandshakeClientHello)
+		record.AddUint24LengthPrefixed(func(message *cryptobyte.Builder) {
+			message.AddUint16(version)
+			message.AddBytes(random)
+			message.AddUint8(0) // No session ID
+			message.AddUint16LengthPrefixed(func(list *cryptobyte.Builder) {
+				for _, suite := range suites {
+					list.AddUint16(suite)
+				}
+			})
+			message.AddBytes([]byte{1, 0}) // Null compression only
+			message.AddUint16LengthPrefixed(func(extensions *cryptobyte.Builder) {
+				if serverName != "" {
+					extensions.AddUint16(0x0000) // server_name
+					extensions.AddUint16LengthPrefixed(func(extension *cryptobyte.Builder) {
+						extension.AddUint16LengthPrefixed(func(list *cryptobyte.Builder) {
+							list.AddUint8(0) // host_name
+							list.AddUint16LengthPrefixed(func(name *cryptobyte.Builder) {
+								name.AddBytes([]byte(serverName))
+							})
+						})
+					})
+				}
+				extensions.AddUint16(0x000a) // supported_groups: x25519, P-256, P-384
+				extensions.AddUint16LengthPrefixed(func(extension *cryptobyte.Builder) {
+					extension.AddUint16LengthPrefixed(func(list *cryptobyte.Builder) {
+						for _, group := range []uint16{0x001d, 0x0017, 0x0018} {
+							list.AddUint16(group)
+						}
+					})
+				})
+				extensions.AddUint16(0x000b) // ec_point_formats: uncompressed
+				extensions.AddUint16LengthPrefixed(func(extension *cryptobyte.Builder) {
+					extension.AddBytes([]byte{1, 0})
+				})
+				extensions.AddUint16(0x000d) // signature_algorithms
+				extensions.AddUint16LengthPrefixed(func(extension *cryptobyte.Builder) {
+					extension.AddUint16LengthPrefixed(func(list *cryptobyte.Builder) {
+						for _, algorithm := range []uint16{0x0804, 0x0805, 0x0401, 0x0501, 0x0601, 0x0403, 0x0503, 0x0201, 0x0203} {
+							list.AddUint16(algorithm)
+						}
+					})
+				})
+				extensions.AddUint16(0xff01) // renegotiation_info, empty
+				extensions.AddUint16LengthPrefixed(func(extension *cryptobyte.Builder) {
+					extension.AddUint8(0)
+				})
+			})
+		})
+	})
+	return hello.BytesOrPanic()
+}
+
+// readServerHelloCipherSuite reads the cipher suite of the ServerHello at
+// the start of the first handshake record
+func readServerHelloCipherSuite(reader *bufio.Reader) (uint16, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return 0, err
+	}
+	if header[0] == tlsRecordAlert {
+		return 0, errors.New("handshake refused with an alert")
+	}
+	length := int(binary.BigEndian.Uint16(header[3:5]))
+	if header[0] != tlsRecordHandshake || length > tlsMaxRecordLength {
+		return 0, errors.New("unexpected TLS record instead of ServerHello")
+	}
+	record := make([]byte, length)
+	if _, err := io.ReadFull(reader, record); err != nil {
+		return 0, err
+	}
+
+	message := cryptobyte.String(record)
+	var messageType uint8
+	var body, sessionID cryptobyte.String
+	var suite uint16
+	if !message.ReadUint8(&messageType) || messageType != tlsHandshakeServerHello ||
+		!message.ReadUint24LengthPrefixed(&body) ||
+		!body.Skip(2+32) || // Version and random
+		!body.ReadUint8LengthPrefixed(&sessionID) ||
+		!body.ReadUint16(&suite) {
+		return 0, errors.New("malformed ServerHello")
+	}
+	return suite, nil
+}
+
+// cipherSuitesOf returns the cipher suites of the TLS client that can be
+// negotiated with version, insecure ones included
+func cipherSuitesOf(version uint16) []*tls.CipherSuite {
+	var suites []*tls.CipherSuite
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		if slices.Contains(suite.SupportedVersions, version) {
+			suites = append(suites, suite)
+		}
+	}
+	return suites
+}
+
+func suiteIDs(suites []*tls.CipherSuite) []uint16 {
+	ids := make([]uint16, 0, len(suites))
+	for _, suite := range suites {
+		ids = append(ids, suite.ID)
+	}
+	return ids
+}
+
+// gradeTls lists the weak cipher suites among the accepted ones and grades
+// the endpoint with the worst grade any of its versions or suites deserves
+func gradeTls(enumeration *servicediscovery.TlsEnumeration, accepted []*tls.CipherSuite) {
+	enumeration.Grade = servicediscovery.TLS_GRADE_A
+	lower := func(grade string, reason string) {
+		// Grades are single letters, worse ones sort after better ones
+		if grade > enumeration.Grade {
+			enumeration.Grade = grade
+		}
+		enumeration.GradeReasons = append(enumeration.GradeReasons, reason)
+	}
+
+	for _, version := range []uint16{tls.VersionTLS10, tls.VersionTLS11} {
+		if slices.Contains(enumeration.Versions, tls.VersionName(version)) {
+			lower(servicediscovery.TLS_GRADE_B, tls.VersionName(version)+" accepted")
+		}
+	}
+	if !slices.Contains(enumeration.Versions, tls.VersionName(tls.VersionTLS12)) &&
+		!slices.Contains(enumeration.Versions, tls.VersionName(tls.VersionTLS13)) {
+		lower(servicediscovery.TLS_GRADE_C, "neither TLS 1.2 nor TLS 1.3 accepted")
+	}
+
+	for _, suite := range accepted {
+		var grade, reason string
+		switch {
+		case strings.Contains(suite.Name, "_RC4_"):
+			grade, reason = servicediscovery.TLS_GRADE_F, "uses the broken RC4 cipher"
+		case strings.Contains(suite.Name, "_3DES_"):
+			grade, reason = servicediscovery.TLS_GRADE_C, "uses the 64 bit block cipher 3DES"
+		case strings.HasPrefix(suite.Name, "TLS_RSA_"):
+			grade, reason = servicediscovery.TLS_GRADE_B, "lacks forward secrecy"
+		case suite.Insecure:
+			grade, reason = servicediscovery.TLS_GRADE_B, "is insecure"
+		default:
+			continue
+		}
+		enumeration.WeakCipherSuites = append(enumeration.WeakCipherSuites, suite.Name)
+		lower(grade, fmt.Sprintf("%s %s", suite.Name, reason))
+	}
+}
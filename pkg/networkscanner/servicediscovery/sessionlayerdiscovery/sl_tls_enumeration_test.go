@@ -0,0 +1,154 @@
+package sessionlayerdiscovery
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"slices"
+	"testing"
+
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
+)
+
+// serverHelloFixture returns a handshake record holding a TLS 1.2
+// ServerHello of suite, with a session ID and no extensions
+func serverHelloFixture(suite uint16, sessionID []byte) []byte {
+	body := []byte{0x03, 0x03}
+	body = append(body, make([]byte, 32)...)
+	body = append(body, byte(len(sessionID)))
+	body = append(body, sessionID...)
+	body = append(body, byte(suite>>8), byte(suite), 0)
+	message := append([]byte{tlsHandshakeServerHello, 0, byte(len(body) >> 8), byte(len(body))}, body...)
+	return append([]byte{tlsRecordHandshake, 0x03, 0x03, byte(len(message) >> 8), byte(len(message))}, message...)
+}
+
+func TestReadServerHelloCipherSuite(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		record []byte
+		want   uint16
+	}{
+		{"session ID", serverHelloFixture(tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, bytes.Repeat([]byte{0xaa}, 32)), tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+		{"no session ID", serverHelloFixture(tls.TLS_RSA_WITH_RC4_128_SHA, nil), tls.TLS_RSA_WITH_RC4_128_SHA},
+	} {
+		suite, err := readServerHelloCipherSuite(bufio.NewReader(bytes.NewReader(test.record)))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if suite != test.want {
+			t.Errorf("%s: suite %#04x, want %#04x", test.name, suite, test.want)
+		}
+	}
+}
+
+func TestReadServerHelloCipherSuiteErrors(t *testing.T) {
+	valid := serverHelloFixture(tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, []byte{1, 2, 3, 4})
+	withRecord := func(change func(record []byte)) []byte {
+		record := slices.Clone(valid)
+		change(record)
+		return record
+	}
+	tests := []struct {
+		name   string
+		record []byte
+	}{
+		{"empty", nil},
+		{"header cut short", valid[:3]},
+		{"record cut short", valid[:20]},
+		{"alert", []byte{tlsRecordAlert, 0x03, 0x03, 0x00, 0x02, 0x02, 0x28}},
+		{"application data", withRecord(func(record []byte) { record[0] = 23 })},
+		{"record too long", withRecord(func(record []byte) { record[3], record[4] = 0xff, 0xff })},
+		{"other handshake message", withRecord(func(record []byte) { record[5] = 11 })},
+		{"message longer than the record", withRecord(func(record []byte) { record[6] = 0x01 })},
+		{"session ID longer than the message", withRecord(func(record []byte) { record[5+4+2+32] = 0xff })},
+		{"no cipher suite", func() []byte {
+			// Ends right after the session ID
+			message := []byte{tlsHandshakeServerHello, 0, 0, 2 + 32 + 1}
+			message = append(message, make([]byte, 2+32+1)...)
+			return append([]byte{tlsRecordHandshake, 0x03, 0x03, 0, byte(len(message))}, message...)
+		}()},
+	}
+	for _, test := range tests {
+		if suite, err := readServerHelloCipherSuite(bufio.NewReader(bytes.NewReader(test.record))); err == nil {
+			t.Errorf("%s: read suite %#04x, want an error", test.name, suite)
+		}
+	}
+}
+
+func cipherSuitesByID(ids ...uint16) []*tls.CipherSuite {
+	var suites []*tls.CipherSuite
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		if slices.Contains(ids, suite.ID) {
+			suites = append(suites, suite)
+		}
+	}
+	return suites
+}
+
+func TestGradeTls(t *testing.T) {
+	tests := []struct {
+		name     string
+		versions []string
+		suites   []uint16
+		want     string
+		weak     []string
+	}{
+		{
+			name:     "modern",
+			versions: []string{"TLS 1.2", "TLS 1.3"},
+			suites:   []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256},
+			want:     servicediscovery.TLS_GRADE_A,
+		},
+		{
+			name:     "TLS 1.3 only",
+			versions: []string{"TLS 1.3"},
+			want:     servicediscovery.TLS_GRADE_A,
+		},
+		{
+			name:     "old versions",
+			versions: []string{"TLS 1.0", "TLS 1.1", "TLS 1.2"},
+			suites:   []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA},
+			want:     servicediscovery.TLS_GRADE_B,
+		},
+		{
+			name:     "no forward secrecy",
+			versions: []string{"TLS 1.2"},
+			suites:   []uint16{tls.TLS_RSA_WITH_AES_128_GCM_SHA256},
+			want:     servicediscovery.TLS_GRADE_B,
+			weak:     []string{"TLS_RSA_WITH_AES_128_GCM_SHA256"},
+		},
+		{
+			name:     "3DES",
+			versions: []string{"TLS 1.2"},
+			suites:   []uint16{tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA},
+			want:     servicediscovery.TLS_GRADE_C,
+			weak:     []string{"TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA"},
+		},
+		{
+			name:     "TLS 1.0 only",
+			versions: []string{"TLS 1.0"},
+			suites:   []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA},
+			want:     servicediscovery.TLS_GRADE_C,
+		},
+		{
+			// The worst suite sets the grade whatever the order
+			name:     "RC4",
+			versions: []string{"TLS 1.2"},
+			suites:   []uint16{tls.TLS_ECDHE_RSA_WITH_RC4_128_SHA, tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA},
+			want:     servicediscovery.TLS_GRADE_F,
+			weak:     []string{"TLS_RSA_WITH_3DES_EDE_CBC_SHA", "TLS_ECDHE_RSA_WITH_RC4_128_SHA"},
+		},
+	}
+	for _, test := range tests {
+		enumeration := servicediscovery.TlsEnumeration{Versions: test.versions}
+		gradeTls(&enumeration, cipherSuitesByID(test.suites...))
+		if enumeration.Grade != test.want {
+			t.Errorf("%s: grade %s, want %s, for %v", test.name, enumeration.Grade, test.want, enumeration.GradeReasons)
+		}
+		if !slices.Equal(enumeration.WeakCipherSuites, test.weak) {
+			t.Errorf("%s: weak suites %v, want %v", test.name, enumeration.WeakCipherSuites, test.weak)
+		}
+		if (test.want == servicediscovery.TLS_GRADE_A) != (len(enumeration.GradeReasons) == 0) {
+			t.Errorf("%s: grade %s with reasons %v", test.name, enumeration.Grade, enumeration.GradeReasons)
+		}
+	}
+}
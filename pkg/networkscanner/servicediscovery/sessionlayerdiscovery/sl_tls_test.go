@@ -0,0 +1,152 @@
+package sessionlayerdiscovery
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// startTlsServer serves handshakes with config on a loopback port. The
+// connections are read until the client closes them, or closed right after
+// the handshake if hangUp is set.
+func startTlsServer(t *testing.T, config *tls.Config, hangUp bool) int {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Certificates = []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if hangUp {
+					conn.(*tls.Conn).Handshake()
+					return
+				}
+				io.Copy(io.Discard, conn)
+			}()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestDiscoverTlsClientCertificateRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		clientAuth tls.ClientAuthType
+		version    uint16
+		hangUp     bool
+		want       *bool // nil if unknown
+	}{
+		{
+			name:       "required, TLS 1.3",
+			clientAuth: tls.RequireAnyClientCert,
+			version:    tls.VersionTLS13,
+			want:       newBool(true),
+		},
+		{
+			name:       "required, TLS 1.2",
+			clientAuth: tls.RequireAnyClientCert,
+			version:    tls.VersionTLS12,
+			want:       newBool(true),
+		},
+		{
+			name:       "optional, TLS 1.3",
+			clientAuth: tls.RequestClientCert,
+			version:    tls.VersionTLS13,
+			want:       newBool(false),
+		},
+		{
+			name:       "optional, TLS 1.2",
+			clientAuth: tls.RequestClientCert,
+			version:    tls.VersionTLS12,
+			want:       newBool(false),
+		},
+		{
+			// The connection is closed after the empty certificate, without
+			// an alert telling why
+			name:       "closed, TLS 1.3",
+			clientAuth: tls.RequestClientCert,
+			version:    tls.VersionTLS13,
+			hangUp:     true,
+			want:       nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &tls.Config{ClientAuth: test.clientAuth, MinVersion: test.version, MaxVersion: test.version}
+			port := startTlsServer(t, config, test.hangUp)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			result, err := discoverTls(ctx, "127.0.0.1", port, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			request := result.GetClientCertificateRequest()
+			if request == nil {
+				t.Fatal("no client certificate request")
+			}
+			if !equalBool(request.Required, test.want) {
+				t.Errorf("required %v, want %v", formatBool(request.Required), formatBool(test.want))
+			}
+		})
+	}
+}
+
+func TestMtlsRequiredUnknown(t *testing.T) {
+	for _, err := range []error{io.EOF, &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}} {
+		if required := mtlsRequired(err); required != nil {
+			t.Errorf("mtlsRequired(%v) = %t, want unknown", err, *required)
+		}
+	}
+}
+
+func newBool(value bool) *bool {
+	return &value
+}
+
+func equalBool(a *bool, b *bool) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
+
+func formatBool(value *bool) string {
+	if value == nil {
+		return "unknown"
+	}
+	if *value {
+		return "true"
+	}
+	return "false"
+}
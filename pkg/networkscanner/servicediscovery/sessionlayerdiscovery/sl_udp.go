@@ -0,0 +1,95 @@
+package sessionlayerdiscovery
+
+import (
+	"context"
+	"net"
+
+	"github.com/kubescape/kubescape-network-scanner/pkg/networkscanner/servicediscovery"
+)
+
+type UdpSessionDiscovery struct {
+}
+
+type UdpSessionDiscoveryResult struct {
+	host string
+	port int
+}
+
+// UdpSessionHandler exchanges datagrams with a UDP port. Every Write sends a
+// single datagram and every Read returns a single datagram, truncated to the
+// buffer size. Datagrams may be lost, so callers resend requests that are
+// not answered within the read timeout.
+type UdpSessionHandler struct {
+	host   string
+	port   int
+	conn   net.Conn
+	stop   func() bool
+	timing servicediscovery.Timing
+}
+
+func (d *UdpSessionDiscovery) Protocol() servicediscovery.TransportProtocol {
+	return servicediscovery.UDP
+}
+
+func (d *UdpSessionDiscovery) SessionLayerDiscover(ctx context.Context, hostAddr string, port int) (servicediscovery.ISessionLayerDiscoveryResult, error) {
+	// There is no handshake, port discovery already found the port open
+	conn, err := dialUDP(ctx, hostAddr, port)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return &UdpSessionDiscoveryResult{host: hostAddr, port: port}, nil
+}
+
+func (d *UdpSessionDiscoveryResult) Protocol() servicediscovery.SessionLayerProtocol {
+	return servicediscovery.NO_SESSION_LAYER_UDP
+}
+
+func (d *UdpSessionDiscoveryResult) GetIsDetected() bool {
+	return true
+}
+
+func (d *UdpSessionDiscoveryResult) GetProperties() map[string]interface{} {
+	return nil
+}
+
+func (d *UdpSessionDiscoveryResult) GetSessionHandler() (servicediscovery.ISessionHandler, error) {
+	return &UdpSessionHandler{host: d.host, port: d.port}, nil
+}
+
+func (d *UdpSessionHandler) Connect(ctx context.Context) error {
+	conn, err := dialUDP(ctx, d.host, d.port)
+	if err != nil {
+		return err
+	}
+	d.conn = conn
+	d.timing = servicediscovery.TimingFromContext(ctx)
+	d.stop = closeOnDone(ctx, conn)
+	return nil
+}
+
+func (d *UdpSessionHandler) Destory() error {
+	d.stop()
+	return d.conn.Close()
+}
+
+func (d *UdpSessionHandler) Write(data []byte) (int, error) {
+	d.conn.SetWriteDeadline(ioDeadline(d.timing))
+	return d.conn.Write(data)
+}
+
+// Read fails with ECONNREFUSED when the port answered an earlier datagram
+// with an ICMP port unreachable
+func (d *UdpSessionHandler) Read(data []byte) (int, error) {
+	d.conn.SetReadDeadline(ioDeadline(d.timing))
+	return d.conn.Read(data)
+}
+
+func (d *UdpSessionHandler) GetHost() string {
+	return d.host
+}
+
+func (d *UdpSessionHandler) GetPort() int {
+	return d.port
+}
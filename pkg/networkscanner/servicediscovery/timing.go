@@ -0,0 +1,84 @@
+package servicediscovery
+
+import (
+	"context"
+	"time"
+)
+
+// Timing holds the timeouts and retries used by every discovery layer.
+// Zero durations fall back to the DefaultTiming values.
+type Timing struct {
+	// Establishing a connection, including the TLS handshake
+	ConnectTimeout time.Duration
+	// Waiting for data on an established connection
+	ReadTimeout time.Duration
+	// A single discovery probe, from connecting to its verdict
+	ProbeTimeout time.Duration
+	// Everything done on one target host in each scan phase, unlimited if zero
+	TargetTimeout time.Duration
+	// Additional connection attempts after a timeout
+	Retries int
+	// Raise timeouts for targets with a long round trip time
+	Adaptive bool
+}
+
+func DefaultTiming() Timing {
+	return Timing{
+		ConnectTimeout: time.Second,
+		ReadTimeout:    500 * time.Millisecond,
+		ProbeTimeout:   3 * time.Second,
+	}
+}
+
+// WithDefaults returns t with its unset timeouts taken from DefaultTiming
+func (t Timing) WithDefaults() Timing {
+	defaults := DefaultTiming()
+	if t.ConnectTimeout <= 0 {
+		t.ConnectTimeout = defaults.ConnectTimeout
+	}
+	if t.ReadTimeout <= 0 {
+		t.ReadTimeout = defaults.ReadTimeout
+	}
+	if t.ProbeTimeout <= 0 {
+		t.ProbeTimeout = defaults.ProbeTimeout
+	}
+	if t.Retries < 0 {
+		t.Retries = 0
+	}
+	return t
+}
+
+// Adapt raises the connect, read and probe timeouts so that they are not
+// shorter than a few round trips to the target. It does nothing unless
+// Adaptive is set and a round trip time was measured.
+func (t Timing) Adapt(rtt time.Duration) Timing {
+	if !t.Adaptive || rtt <= 0 {
+		return t
+	}
+	floor := 4 * rtt
+	if t.ConnectTimeout < floor {
+		t.ConnectTimeout = floor
+	}
+	if t.ReadTimeout < floor {
+		t.ReadTimeout = floor
+	}
+	if t.ProbeTimeout < 4*floor {
+		t.ProbeTimeout = 4 * floor
+	}
+	return t
+}
+
+type timingContextKey struct{}
+
+// ContextWithTiming returns a copy of ctx carrying the timing for discovery
+func ContextWithTiming(ctx context.Context, timing Timing) context.Context {
+	return context.WithValue(ctx, timingContextKey{}, timing.WithDefaults())
+}
+
+// TimingFromContext returns the timing carried by ctx, or DefaultTiming
+func TimingFromContext(ctx context.Context) Timing {
+	if timing, ok := ctx.Value(timingContextKey{}).(Timing); ok {
+		return timing
+	}
+	return DefaultTiming()
+}
@@ -0,0 +1,138 @@
+package servicediscovery
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// Where the service account of a pod finds the CA of its cluster
+const ClusterCAFile = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+
+// Names of the trust anchors a TLS certificate chain is verified against
+const (
+	TRUSTED_BY_CA_BUNDLE = "caBundle"
+	TRUSTED_BY_CLUSTER   = "clusterCA"
+	TRUSTED_BY_SYSTEM    = "system"
+)
+
+// TlsOptions holds what TLS discovery verifies certificates against
+type TlsOptions struct {
+	// Sent as SNI and matched against the certificate. Empty when the
+	// target was given as an address, which is then matched instead.
+	ServerName string
+	// CAs given by the user, nil if none
+	CABundle *x509.CertPool
+	// CA of the cluster the scanner runs in, nil outside of a pod
+	ClusterCA *x509.CertPool
+	// Presented to servers that ask for a client certificate, nil if none
+	ClientCertificate *tls.Certificate
+	// Try every TLS version and cipher suite once TLS is detected. This
+	// takes a handshake per cipher suite, so it is off by default.
+	Enumerate bool
+	// Attempt a plaintext login to tell whether PostgreSQL and MySQL
+	// servers require STARTTLS. The attempt shows in the logs of the
+	// server, so it is off by default.
+	StartTlsLogin bool
+}
+
+// Result of verifying the certificate chain of a TLS session
+type TlsVerification struct {
+	// Whether the chain leads to one of the trust anchors, the first of
+	// the CA bundle, the cluster CA and the system roots that it leads to
+	Trusted   bool
+	TrustedBy string // TRUSTED_BY_*
+	// Why the chain is not trusted
+	Error string
+	// The leaf certificate is not valid for the server name or address
+	HostnameMismatch bool
+}
+
+// What a TLS server asked for when it requested a client certificate
+type TlsClientCertificateRequest struct {
+	// Whether the handshake is refused without a client certificate, that is
+	// mutual TLS is required. nil if the handshake failed in a way that does
+	// not tell.
+	Required *bool
+	// Distinguished names of the CAs client certificates must be issued by,
+	// empty if the server accepts any
+	AcceptableCAs []string
+	// The client certificate of the options was presented and accepted
+	Accepted bool
+}
+
+// Grades of a TLS endpoint, from its versions and cipher suites only
+const (
+	TLS_GRADE_A = "A" // TLS 1.2 or later with forward secret cipher suites only
+	TLS_GRADE_B = "B" // TLS 1.0 or 1.1, or cipher suites without forward secrecy
+	TLS_GRADE_C = "C" // 3DES cipher suites, or neither TLS 1.2 nor 1.3
+	TLS_GRADE_F = "F" // RC4 cipher suites
+)
+
+// Result of trying every TLS version and cipher suite the scanner supports
+type TlsEnumeration struct {
+	// Versions the server accepts, oldest first
+	Versions []string
+	// Cipher suites the server accepts with each version. TLS 1.3 suites
+	// cannot be offered one at a time, so only the one negotiated is listed.
+	CipherSuites map[string][]string
+	// The server picks the cipher suite instead of following the order of
+	// the client. Only known when it accepts two suites with one version.
+	ServerCipherPreference bool
+	// Accepted cipher suites that are broken or lack forward secrecy
+	WeakCipherSuites []string
+	Grade            string // TLS_GRADE_*
+	// What lowered the grade
+	GradeReasons []string
+}
+
+// LoadCertPool reads the PEM certificates of a CA bundle file
+func LoadCertPool(fileName string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no PEM certificate found in %s", fileName)
+	}
+	return pool, nil
+}
+
+// LoadClientCertificate reads a PEM client certificate chain and its key
+func LoadClientCertificate(certFile string, keyFile string) (*tls.Certificate, error) {
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &certificate, nil
+}
+
+// LoadClusterCA returns the CA of the cluster the scanner runs in, nil if
+// it does not run in a pod with a service account
+func LoadClusterCA() *x509.CertPool {
+	pool, err := LoadCertPool(ClusterCAFile)
+	if err != nil {
+		return nil
+	}
+	return pool
+}
+
+type tlsOptionsContextKey struct{}
+
+// ContextWithTlsOptions returns a copy of ctx carrying the TLS options for
+// discovery
+func ContextWithTlsOptions(ctx context.Context, options TlsOptions) context.Context {
+	return context.WithValue(ctx, tlsOptionsContextKey{}, options)
+}
+
+// TlsOptionsFromContext returns the TLS options carried by ctx, or empty
+// options which only verify against the system roots
+func TlsOptionsFromContext(ctx context.Context) TlsOptions {
+	if options, ok := ctx.Value(tlsOptionsContextKey{}).(TlsOptions); ok {
+		return options
+	}
+	return TlsOptions{}
+}
@@ -1,16 +1,25 @@
 package servicediscovery
 
+import (
+	"context"
+	"crypto/tls"
+)
+
 type TransportProtocol string
 type PresentationLayerProtocol string
 type SessionLayerProtocol string
 
 const (
-	TCP              TransportProtocol         = "tcp"
-	UDP              TransportProtocol         = "udp"
-	TLS              SessionLayerProtocol      = "tls"
-	SSH              SessionLayerProtocol      = "ssh"
-	NO_SESSION_LAYER SessionLayerProtocol      = "tcp"
-	HTTP             PresentationLayerProtocol = "http"
+	TCP                  TransportProtocol         = "tcp"
+	UDP                  TransportProtocol         = "udp"
+	TLS                  SessionLayerProtocol      = "tls"
+	STARTTLS             SessionLayerProtocol      = "starttls" // TLS negotiated within the application protocol
+	SSH                  SessionLayerProtocol      = "ssh"
+	NO_SESSION_LAYER     SessionLayerProtocol      = "tcp"
+	NO_SESSION_LAYER_UDP SessionLayerProtocol      = "udp" // Plain datagrams
+	HTTP                 PresentationLayerProtocol = "http"
+	HTTP2                PresentationLayerProtocol = "http2" // Over TLS (h2) or cleartext (h2c)
+	WEBSOCKET            PresentationLayerProtocol = "websocket"
 )
 
 ///////////////////////////////////////////////////////////////////////////////
@@ -18,7 +27,7 @@ const (
 ///////////////////////////////////////////////////////////////////////////////
 
 type ISessionHandler interface {
-	Connect() error
+	Connect(ctx context.Context) error
 	Destory() error
 	Write([]byte) (int, error)
 	Read([]byte) (int, error)
@@ -33,9 +42,67 @@ type ISessionLayerDiscoveryResult interface {
 	GetSessionHandler() (ISessionHandler, error)
 }
 
+// Implemented by the session handlers of TLS sessions
+type ITlsSessionHandler interface {
+	ISessionHandler
+	// ConnectALPN is Connect offering the protocols through ALPN. It
+	// returns the protocol the server selected, empty if none.
+	ConnectALPN(ctx context.Context, protocols []string) (string, error)
+}
+
+// Implemented by the session layer results of TLS sessions
+type ITlsSessionLayerDiscoveryResult interface {
+	ISessionLayerDiscoveryResult
+	GetConnectionState() tls.ConnectionState
+	GetVerification() TlsVerification
+	// nil if the server did not ask for a client certificate
+	GetClientCertificateRequest() *TlsClientCertificateRequest
+	// Enumerate tries every TLS version and cipher suite on the server.
+	// The result is also added to the properties.
+	Enumerate(ctx context.Context) (TlsEnumeration, error)
+}
+
+// Whether the server of an application protocol upgrades to TLS in-band
+type StartTlsStatus struct {
+	// The server accepted to start TLS
+	Offered bool
+	// The server refuses to go on in plaintext. Only known for some
+	// protocols, see sessionlayerdiscovery.DiscoverStartTls.
+	Required bool
+}
+
+// What an SSH server tells before authentication
+type SshServerInfo struct {
+	ProtocolVersion string // e.g. 2.0
+	Software        string // e.g. OpenSSH
+	SoftwareVersion string // e.g. 9.6p1
+	Comments        string // Text after the software version, e.g. Ubuntu-3ubuntu13
+	// Algorithms offered in the server KEXINIT, in order of preference
+	KexAlgorithms     []string
+	HostKeyAlgorithms []string
+	Ciphers           []string
+	MACs              []string
+	Compressions      []string
+	// Offered algorithms considered weak
+	WeakAlgorithms []string
+	HostKeyType    string
+	// SHA256 fingerprint of the host key, as printed by ssh-keygen
+	HostKeyFingerprint string
+	// Authentication methods the server offers, empty if the check failed
+	AuthMethods []string
+	// Whether the server let the scanner in with the none method
+	NoneAuthentication bool
+}
+
+// Implemented by the session layer results of SSH sessions
+type ISshSessionLayerDiscoveryResult interface {
+	ISessionLayerDiscoveryResult
+	GetServerInfo() SshServerInfo
+}
+
 type SessionLayerProtocolDiscovery interface {
 	Protocol() TransportProtocol
-	SessionLayerDiscover(hostAddr string, port int) (ISessionLayerDiscoveryResult, error)
+	SessionLayerDiscover(ctx context.Context, hostAddr string, port int) (ISessionLayerDiscoveryResult, error)
 }
 
 ///////////////////////////////////////////////////////////////////////////////
@@ -48,23 +115,69 @@ type IPresentationDiscoveryResult interface {
 	GetProperties() map[string]interface{}
 }
 
+// Implemented by the presentation layer results of HTTP
+type IHttpPresentationDiscoveryResult interface {
+	IPresentationDiscoveryResult
+	GetFingerprint() HttpFingerprint
+}
+
+// Implemented by the presentation layer results of HTTP/2
+type IHttp2PresentationDiscoveryResult interface {
+	IPresentationDiscoveryResult
+	GetHttp2Info() Http2Info
+}
+
+// Implemented by the presentation layer results of WebSocket
+type IWebSocketPresentationDiscoveryResult interface {
+	IPresentationDiscoveryResult
+	GetWebSocketEndpoints() []WebSocketEndpoint
+}
+
 type PresentationLayerDiscovery interface {
 	Protocol() PresentationLayerProtocol
-	Discover(sessionHandler ISessionHandler) (IPresentationDiscoveryResult, error)
+	Discover(ctx context.Context, sessionHandler ISessionHandler) (IPresentationDiscoveryResult, error)
 }
 
 ///////////////////////////////////////////////////////////////////////////////
 // Application Layer Protocols
 ///////////////////////////////////////////////////////////////////////////////
 
+// Whether a service lets clients in without credentials. The values match
+// the AUTHENTICATION_STATUS_* constants of the networkscanner package.
+type AuthenticationStatus string
+
+const (
+	AUTHENTICATED           AuthenticationStatus = "AUTHENTICATED"           // Credentials are required
+	UNAUTHENTICATED         AuthenticationStatus = "UNAUTHENTICATED"         // Open without credentials
+	PARTIALLY_AUTHENTICATED AuthenticationStatus = "PARTIALLY_AUTHENTICATED" // Some operations are open without credentials
+	AUTHENTICATION_UNKNOWN  AuthenticationStatus = "UNKNOWN"                 // The probe could not tell
+)
+
+type Authentication struct {
+	Status AuthenticationStatus
+	// What the status is based on, in plain words
+	Reason string
+}
+
+// Confidence of an application layer detection, from 0 to 100
+const (
+	CONFIDENCE_LOW    = 30
+	CONFIDENCE_MEDIUM = 60
+	CONFIDENCE_HIGH   = 90
+)
+
 type IApplicationDiscoveryResult interface {
 	Protocol() string
 	GetIsDetected() bool
 	GetProperties() map[string]interface{}
-	GetIsAuthRequired() bool
+	GetAuthentication() Authentication
+	// How sure the detection is, from 0 to 100
+	GetConfidence() int
+	// What the detection is based on, in plain words
+	GetEvidence() []string
 }
 
 type ApplicationLayerDiscovery interface {
 	Protocol() string
-	Discover(sessionHandler ISessionHandler, presenationLayerDiscoveryResult IPresentationDiscoveryResult) (IApplicationDiscoveryResult, error)
+	Discover(ctx context.Context, sessionHandler ISessionHandler, presenationLayerDiscoveryResult IPresentationDiscoveryResult) (IApplicationDiscoveryResult, error)
 }
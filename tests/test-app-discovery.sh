@@ -181,10 +181,12 @@ kubectl exec bash-pod -n $namespace -- kubescape-network-scanner scan --tcp $ser
 # Get the output json file from the pod
 kubectl cp bash-pod:/tmp/output.json /tmp/$random_name-output.json -n $namespace 2>&1 | tee /tmp/$random_name-log.txt || cleanupandexit $application_name "failed to copy output.json from the pod"
 
-# Compare the output json file with the expected output json file (ignore whitespace and "properties" field)
-jq --sort-keys -S 'map(.properties |= {})' /tmp/$random_name-output.json > /tmp/$random_name-output.json.tmp \
+# Compare the output json file with the expected output json file (ignore whitespace and the fields that
+# change between runs, such as properties, matches, TLS certificates and timings)
+projection='.results | map({host, port, transport, state, status, sessionLayer, presentationLayer, applicationLayer, authentication: .authentication.status})'
+jq --sort-keys -S "$projection" /tmp/$random_name-output.json > /tmp/$random_name-output.json.tmp \
   && mv /tmp/$random_name-output.json.tmp /tmp/$random_name-output.json
-jq --sort-keys -S 'map(.properties |= {})' apps/$application_name/expected-output.json > /tmp/$random_name-expected-output.json
+jq --sort-keys -S "$projection" apps/$application_name/expected-output.json > /tmp/$random_name-expected-output.json
 diff -w /tmp/$random_name-output.json /tmp/$random_name-expected-output.json > /tmp/$random_name-diff.txt
 result=$?
 